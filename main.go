@@ -10,6 +10,7 @@ import (
 	"github.com/sirupsen/logrus"
 	"github.com/streadway/amqp"
 
+	"github.com/scalify/puppet-master-gateway/pkg/artifact"
 	"github.com/scalify/puppet-master-gateway/pkg/database"
 	"github.com/scalify/puppet-master-gateway/pkg/gateway"
 )
@@ -28,8 +29,27 @@ type env struct {
 	CouchDbUsername string `required:"true" split_words:"true"`
 	CouchDbPassword string `required:"true" split_words:"true"`
 	APIToken        string `required:"true" split_words:"true" envconfig:"API_TOKEN"`
+	// ArtifactStore is local or s3, without one large results stay within the jobs
+	ArtifactStore       string `default:"" split_words:"true"`
+	ArtifactDir         string `default:"/var/lib/puppet-master/artifacts" split_words:"true"`
+	ArtifactS3Endpoint  string `default:"" envconfig:"ARTIFACT_S3_ENDPOINT"`
+	ArtifactS3Region    string `default:"us-east-1" envconfig:"ARTIFACT_S3_REGION"`
+	ArtifactS3Bucket    string `default:"" envconfig:"ARTIFACT_S3_BUCKET"`
+	ArtifactS3AccessKey string `default:"" envconfig:"ARTIFACT_S3_ACCESS_KEY"`
+	ArtifactS3SecretKey string `default:"" envconfig:"ARTIFACT_S3_SECRET_KEY"`
+	// BlockPrivateCallbacks rejects callbacks to loopback and private addresses
+	BlockPrivateCallbacks bool `default:"false" split_words:"true"`
+	// IndexedLabels are the comma separated label keys jobs are frequently filtered by, each gets an index
+	IndexedLabels []string `default:"" split_words:"true"`
 }
 
+const (
+	// couchTimeout limits the duration of a single request to couchdb
+	couchTimeout = 1 * time.Second
+	// artifactTimeout limits the duration of a single request to the s3 artifact store
+	artifactTimeout = 30 * time.Second
+)
+
 func main() {
 	logger := logrus.New()
 	ctx := exitcontext.New()
@@ -51,9 +71,39 @@ func main() {
 	}()
 
 	setupLogger(logger, cfg.Verbose)
-	db := connectJobDB(logger, cfg)
+	couch := connectCouchDB(logger, cfg)
+	db := connectJobDB(logger, couch, cfg)
+	scheduleDB := database.NewScheduleDB(selectDB(couch, cfg, database.DBNameSchedules))
+	ensureIndexes(logger, database.DBNameSchedules, scheduleDB)
+
+	workflowDB := database.NewVersionDB(selectDB(couch, cfg, database.DBNameWorkflows))
+	ensureIndexes(logger, database.DBNameWorkflows, workflowDB)
+
+	workflowRunDB := database.NewWorkflowRunDB(selectDB(couch, cfg, database.DBNameWorkflowRuns))
+	ensureIndexes(logger, database.DBNameWorkflowRuns, workflowRunDB)
+
+	templateDB := database.NewVersionDB(selectDB(couch, cfg, database.DBNameTemplates))
+	ensureIndexes(logger, database.DBNameTemplates, templateDB)
+
+	moduleDB := database.NewVersionDB(selectDB(couch, cfg, database.DBNameModules))
+	ensureIndexes(logger, database.DBNameModules, moduleDB)
+
+	opts := []gateway.Option{
+		gateway.WithScheduleDB(scheduleDB),
+		gateway.WithWorkflowDB(workflowDB, workflowRunDB),
+		gateway.WithTemplateDB(templateDB),
+		gateway.WithModuleDB(moduleDB),
+	}
+
+	if store := newArtifactStore(logger, cfg); store != nil {
+		opts = append(opts, gateway.WithArtifactStore(store))
+	}
+
+	if cfg.BlockPrivateCallbacks {
+		opts = append(opts, gateway.WithPrivateCallbacksBlocked())
+	}
 
-	server, err := gateway.NewServer(db, queue, logger.WithFields(logrus.Fields{}), cfg.APIToken, cfg.EnableAPI, cfg.EnableJobs)
+	server, err := gateway.NewServer(db, queue, logger.WithFields(logrus.Fields{}), cfg.APIToken, cfg.EnableAPI, cfg.EnableJobs, opts...)
 	if err != nil {
 		logger.Fatalf("Failed to create gateway: %v", err)
 	}
@@ -93,14 +143,16 @@ func connectQueue(logger *logrus.Logger, user, password, host string, port int)
 	return queueConn, queueChannel
 }
 
-func connectJobDB(logger *logrus.Logger, cfg env) *database.JobDB {
-	couch, err := couchdb.NewConnection(cfg.CouchDbHost, cfg.CouchDbPort, 1*time.Second)
+func connectCouchDB(logger *logrus.Logger, cfg env) *couchdb.Connection {
+	couch, err := couchdb.NewConnection(cfg.CouchDbHost, cfg.CouchDbPort, couchTimeout)
 	if err != nil {
 		logger.Fatalf("Failed to open couchdb connection: %v", err)
 	}
 
-	for _, db := range []string{"_global_changes", "_metadata", "_replicator", "_users", "jobs"} {
-		if err := couch.CreateDB(db, &couchdb.BasicAuth{Username: cfg.CouchDbUsername, Password: cfg.CouchDbPassword}); err != nil {
+	for _, db := range []string{"_global_changes", "_metadata", "_replicator", "_users", database.DBNameJobs, database.DBNameSchedules,
+		database.DBNameWorkflows, database.DBNameWorkflowRuns, database.DBNameTemplates,
+		database.DBNameModules} {
+		if err := couch.CreateDB(db, couchAuth(cfg)); err != nil {
 			if cErr, ok := err.(*couchdb.Error); ok {
 				if cErr.StatusCode == 412 {
 					logger.Debugf("Database %s already exists", db)
@@ -111,8 +163,93 @@ func connectJobDB(logger *logrus.Logger, cfg env) *database.JobDB {
 		}
 	}
 
-	db := database.NewJobDB(couch.SelectDB("jobs", &couchdb.BasicAuth{Username: cfg.CouchDbUsername, Password: cfg.CouchDbPassword}))
-	logger.Infof("Using database on http://%s:%d", cfg.CouchDbHost, cfg.CouchDbPort)
+	logger.Infof("Using database on %s", couchURL(cfg))
+
+	return couch
+}
+
+func connectJobDB(logger *logrus.Logger, couch *couchdb.Connection, cfg env) *database.JobDB {
+	finder := database.NewFinder(couchURL(cfg), database.DBNameJobs, couchAuth(cfg), couchTimeout)
+	db := database.NewJobDB(selectDB(couch, cfg, database.DBNameJobs), finder)
+	if err := db.IndexLabels(cfg.IndexedLabels); err != nil {
+		logger.Fatalf("Invalid indexed labels: %v", err)
+	}
+	ensureIndexes(logger, database.DBNameJobs, db)
+
+	migrated, err := db.MigratePriorities()
+	if err != nil {
+		logger.Fatalf("Failed to migrate job priorities: %v", err)
+	}
+	if migrated > 0 {
+		logger.Infof("Set the priority of %d jobs without priority", migrated)
+	}
 
 	return db
 }
+
+// indexedDB is a database with mango indexes that must exist before it is queried
+type indexedDB interface {
+	EnsureIndexes() (*database.IndexChanges, error)
+}
+
+func ensureIndexes(logger *logrus.Logger, name string, db indexedDB) {
+	changes, err := db.EnsureIndexes()
+	if err != nil {
+		logger.Fatalf("Failed to ensure indexes of database %s: %v", name, err)
+	}
+
+	for _, index := range changes.Created {
+		logger.Infof("Created index %s of database %s", index, name)
+	}
+	for _, index := range changes.Updated {
+		logger.Infof("Updated index %s of database %s", index, name)
+	}
+	for _, index := range changes.Dropped {
+		logger.Infof("Dropped obsolete index %s of database %s", index, name)
+	}
+}
+
+// newArtifactStore returns the configured artifact store, or nil if there is none
+func newArtifactStore(logger *logrus.Logger, cfg env) artifact.Store {
+	switch cfg.ArtifactStore {
+	case "":
+		return nil
+	case "local":
+		store, err := artifact.NewFileStore(cfg.ArtifactDir)
+		if err != nil {
+			logger.Fatalf("Failed to create artifact directory: %v", err)
+		}
+
+		logger.Infof("Using local artifact store in %s", cfg.ArtifactDir)
+		return store
+	case "s3":
+		store, err := artifact.NewS3Store(artifact.S3Config{
+			Endpoint:  cfg.ArtifactS3Endpoint,
+			Region:    cfg.ArtifactS3Region,
+			Bucket:    cfg.ArtifactS3Bucket,
+			AccessKey: cfg.ArtifactS3AccessKey,
+			SecretKey: cfg.ArtifactS3SecretKey,
+		}, artifactTimeout)
+		if err != nil {
+			logger.Fatalf("Failed to configure s3 artifact store: %v", err)
+		}
+
+		logger.Infof("Using s3 artifact store with bucket %s on %s", cfg.ArtifactS3Bucket, cfg.ArtifactS3Endpoint)
+		return store
+	default:
+		logger.Fatalf("Unknown artifact store %q, must be local or s3", cfg.ArtifactStore)
+		return nil
+	}
+}
+
+func couchURL(cfg env) string {
+	return fmt.Sprintf("http://%s:%d", cfg.CouchDbHost, cfg.CouchDbPort)
+}
+
+func selectDB(couch *couchdb.Connection, cfg env, name string) *couchdb.Database {
+	return couch.SelectDB(name, couchAuth(cfg))
+}
+
+func couchAuth(cfg env) *couchdb.BasicAuth {
+	return &couchdb.BasicAuth{Username: cfg.CouchDbUsername, Password: cfg.CouchDbPassword}
+}
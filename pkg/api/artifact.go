@@ -0,0 +1,62 @@
+package api
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// MaxInlineResultSize is the maximum size of a single json encoded result that is kept within the
+// job, larger results are moved to the artifact store if there is one
+const MaxInlineResultSize = 64 << 10
+
+// ArtifactNamePattern is matched by the names of all artifacts
+var ArtifactNamePattern = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]*$`)
+
+// An Artifact is a file produced by a job, like a screenshot or a large result. Its content is
+// kept in the artifact store, the job only references it. Result is the key of the result the
+// artifact has been extracted from, if any.
+type Artifact struct {
+	Name        string   `json:"name"`
+	ContentType string   `json:"content_type"`
+	Size        int      `json:"size"`
+	Result      string   `json:"result,omitempty"`
+	CreatedAt   JSONTime `json:"created_at"`
+}
+
+// An ArtifactUpload is a file sent by an executor along with the result of a job
+type ArtifactUpload struct {
+	Name        string `json:"name"`
+	ContentType string `json:"content_type"`
+	Data        []byte `json:"data"`
+}
+
+// ValidateArtifactName checks the name of an artifact, which is used as file name by the stores
+func ValidateArtifactName(name string) error {
+	if !ArtifactNamePattern.MatchString(name) || strings.Contains(name, "..") {
+		return fmt.Errorf("the artifact name must match %s and must not contain .., got %q", ArtifactNamePattern, name)
+	}
+
+	return nil
+}
+
+// Artifact returns the artifact of the job with the given name
+func (j *Job) Artifact(name string) (*Artifact, bool) {
+	for i := range j.Artifacts {
+		if j.Artifacts[i].Name == name {
+			return &j.Artifacts[i], true
+		}
+	}
+
+	return nil, false
+}
+
+// AddArtifact adds the artifact to the job, replacing an existing artifact with the same name
+func (j *Job) AddArtifact(artifact Artifact) {
+	if existing, ok := j.Artifact(artifact.Name); ok {
+		*existing = artifact
+		return
+	}
+
+	j.Artifacts = append(j.Artifacts, artifact)
+}
@@ -0,0 +1,93 @@
+package api
+
+// Batch item status
+const (
+	BatchItemStatusCreated  = "created"
+	BatchItemStatusConflict = "conflict"
+	BatchItemStatusError    = "error"
+)
+
+// A BatchItemResult is the outcome of a single job of a batch submission
+type BatchItemResult struct {
+	Index  int          `json:"index"`
+	UUID   string       `json:"uuid"`
+	Status string       `json:"status"`
+	Error  string       `json:"error,omitempty"`
+	Fields []FieldError `json:"fields,omitempty"`
+}
+
+// A BatchResult holds the outcome of all jobs of a batch submission
+type BatchResult struct {
+	BatchID string            `json:"batch_id"`
+	Items   []BatchItemResult `json:"items"`
+}
+
+// BatchResultResponse is the wrapper around a batch result when returned through API
+type BatchResultResponse struct {
+	Data *BatchResult `json:"data"`
+}
+
+// A Batch summarizes the state of all jobs that have been submitted together
+type Batch struct {
+	UUID            string         `json:"uuid"`
+	Total           int            `json:"total"`
+	Counts          map[string]int `json:"counts"`
+	Progress        float64        `json:"progress"`
+	FirstFinishedAt *JSONTime      `json:"first_finished_at"`
+	LastFinishedAt  *JSONTime      `json:"last_finished_at"`
+	Errors          []BatchError   `json:"errors"`
+}
+
+// A BatchError is the error of a single failed job of a batch
+type BatchError struct {
+	UUID  string    `json:"uuid"`
+	Error *JobError `json:"error"`
+}
+
+// NewBatch aggregates the given jobs of a batch. The progress is the percentage of jobs which
+// have reached a final status.
+func NewBatch(id string, jobs []*Job) *Batch {
+	batch := &Batch{
+		UUID:   id,
+		Total:  len(jobs),
+		Counts: make(map[string]int),
+		Errors: make([]BatchError, 0),
+	}
+
+	finished := 0
+	for _, job := range jobs {
+		batch.Counts[job.Status]++
+
+		if !job.Error.IsEmpty() {
+			batch.Errors = append(batch.Errors, BatchError{UUID: job.UUID, Error: job.Error})
+		}
+
+		if !job.IsFinished() {
+			continue
+		}
+
+		finished++
+		if job.FinishedAt == nil {
+			continue
+		}
+
+		if batch.FirstFinishedAt == nil || job.FinishedAt.Before(batch.FirstFinishedAt.Time) {
+			batch.FirstFinishedAt = job.FinishedAt
+		}
+
+		if batch.LastFinishedAt == nil || job.FinishedAt.After(batch.LastFinishedAt.Time) {
+			batch.LastFinishedAt = job.FinishedAt
+		}
+	}
+
+	if batch.Total > 0 {
+		batch.Progress = float64(finished) * 100 / float64(batch.Total)
+	}
+
+	return batch
+}
+
+// BatchResponse is the wrapper around a batch when returned through API
+type BatchResponse struct {
+	Data *Batch `json:"data"`
+}
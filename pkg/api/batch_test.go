@@ -0,0 +1,52 @@
+package api
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewBatch(t *testing.T) {
+	first := &JSONTime{Time: time.Date(2019, 1, 1, 10, 0, 0, 0, time.UTC)}
+	last := &JSONTime{Time: time.Date(2019, 1, 1, 12, 0, 0, 0, time.UTC)}
+	jobErr := &JobError{Kind: JobErrorKindUnknown, Message: "boom"}
+
+	jobs := []*Job{
+		{UUID: "1", Status: JobStatusDone, FinishedAt: last},
+		{UUID: "2", Status: JobStatusFailed, FinishedAt: first, Error: jobErr},
+		{UUID: "3", Status: JobStatusRunning},
+		{UUID: "4", Status: JobStatusCreated},
+	}
+
+	batch := NewBatch("batch", jobs)
+
+	if batch.UUID != "batch" || batch.Total != 4 {
+		t.Errorf("Unexpected batch: %+v", batch)
+	}
+
+	expectedCounts := map[string]int{JobStatusDone: 1, JobStatusFailed: 1, JobStatusRunning: 1, JobStatusCreated: 1}
+	for status, count := range expectedCounts {
+		if batch.Counts[status] != count {
+			t.Errorf("Expected %d jobs with status %s, got %d", count, status, batch.Counts[status])
+		}
+	}
+
+	if batch.Progress != 50 {
+		t.Errorf("Expected progress 50, got %v", batch.Progress)
+	}
+
+	if batch.FirstFinishedAt != first || batch.LastFinishedAt != last {
+		t.Errorf("Unexpected finish times: %v - %v", batch.FirstFinishedAt, batch.LastFinishedAt)
+	}
+
+	if len(batch.Errors) != 1 || batch.Errors[0].UUID != "2" || batch.Errors[0].Error != jobErr {
+		t.Errorf("Unexpected errors: %+v", batch.Errors)
+	}
+}
+
+func TestNewBatchEmpty(t *testing.T) {
+	batch := NewBatch("batch", nil)
+
+	if batch.Total != 0 || batch.Progress != 0 || batch.FirstFinishedAt != nil {
+		t.Errorf("Unexpected batch: %+v", batch)
+	}
+}
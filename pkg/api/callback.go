@@ -0,0 +1,49 @@
+package api
+
+import (
+	"time"
+)
+
+// Callback delivery status
+const (
+	CallbackStatusPending   = "pending"
+	CallbackStatusDelivered = "delivered"
+	CallbackStatusFailed    = "failed"
+)
+
+// Callback HTTP header constants
+const (
+	CallbackSignatureHeader = "X-Puppet-Master-Signature"
+	CallbackJobIDHeader     = "X-Puppet-Master-Job-Id"
+	CallbackAttemptHeader   = "X-Puppet-Master-Delivery-Attempt"
+)
+
+// A JobCallback tracks the delivery of the job to its callback url
+type JobCallback struct {
+	Status        string             `json:"status"`
+	NextAttemptAt *JSONTime          `json:"next_attempt_at"`
+	Deliveries    []CallbackDelivery `json:"deliveries"`
+}
+
+// A CallbackDelivery is a single attempt to deliver the job to its callback url
+type CallbackDelivery struct {
+	Attempt    int      `json:"attempt"`
+	Time       JSONTime `json:"time"`
+	StatusCode int      `json:"status_code"`
+	Error      string   `json:"error"`
+	Duration   int      `json:"duration"`
+}
+
+// ScheduleCallback marks the callback of a finished job as pending, if the job has a callback url
+// and no delivery has been scheduled before.
+func (j *Job) ScheduleCallback(now time.Time) {
+	if j.CallbackURL == "" || j.Callback != nil {
+		return
+	}
+
+	j.Callback = &JobCallback{
+		Status:        CallbackStatusPending,
+		NextAttemptAt: &JSONTime{Time: now},
+		Deliveries:    make([]CallbackDelivery, 0),
+	}
+}
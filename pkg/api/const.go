@@ -2,24 +2,57 @@ package api
 
 // Job status
 const (
-	JobStatusCreated = "created"
-	JobStatusQueued  = "queued"
-	JobStatusDone    = "done"
+	JobStatusWaiting   = "waiting"
+	JobStatusCreated   = "created"
+	JobStatusQueued    = "queued"
+	JobStatusRunning   = "running"
+	JobStatusDone      = "done"
+	JobStatusFailed    = "failed"
+	JobStatusTimedOut  = "timed_out"
+	JobStatusCancelled = "cancelled"
+	JobStatusSkipped   = "skipped"
 )
 
-// Job queue names
+// Job queue names. The jobs queue is a priority queue with the x-max-priority argument set to
+// JobPriorityMax, executors have to declare it with the same argument. It replaces the former
+// queue puppet-master-jobs, as the arguments of an existing queue can't be changed.
 const (
-	QueueNameJobs       = "puppet-master-jobs"
+	QueueNameJobs       = "puppet-master-prioritized-jobs"
+	QueueNameJobStarts  = "puppet-master-job-starts"
+	QueueNameJobLogs    = "puppet-master-job-logs"
 	QueueNameJobResults = "puppet-master-job-results"
 )
 
+// JobPriorityMax is the highest job priority, jobs with a higher priority are executed first
+const JobPriorityMax = 10
+
+// Exchange names
+const (
+	ExchangeNameJobCancellations = "puppet-master-job-cancellations"
+	// ExchangeNameJobEvents fans the job events out to the event streams of all gateways
+	ExchangeNameJobEvents = "puppet-master-job-events"
+)
+
+// LabelHeaderPrefix prefixes the keys of the job labels within the headers of a published job
+const LabelHeaderPrefix = "label."
+
 // Logger field names
 const (
-	LogFieldJobID = "job_id"
+	LogFieldJobID         = "job_id"
+	LogFieldScheduleID    = "schedule_id"
+	LogFieldBatchID       = "batch_id"
+	LogFieldWorkflow      = "workflow"
+	LogFieldWorkflowRunID = "workflow_run_id"
+	LogFieldTemplate      = "template"
+	LogFieldModule        = "module"
+	// LogFieldLabelPrefix prefixes the keys of the job labels
+	LogFieldLabelPrefix = "label."
 )
 
 // HTTP header constants
 const (
-	ContentTypeHeader = "Content-Type"
-	ContentTypeJSON   = "application/json"
+	ContentTypeHeader  = "Content-Type"
+	ContentTypeJSON    = "application/json"
+	ContentTypeProblem = "application/problem+json"
+	RequestIDHeader    = "X-Request-ID"
 )
@@ -0,0 +1,139 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// HasDependencies returns true when the job must wait for other jobs before it is executed
+func (j *Job) HasDependencies() bool {
+	return len(j.DependsOn) > 0
+}
+
+// ValidateDependencies checks the dependencies of new jobs, which must be either existing jobs or
+// other new jobs and must not form a cycle, as the jobs would wait forever otherwise. It returns a
+// *ValidationError by uuid for every new job that must not be created, jobs depending on such a
+// job are rejected as well. Only the uuid and the dependencies of the existing jobs are used.
+func ValidateDependencies(jobs, existing []*Job) map[string]error {
+	graph := make(map[string][]string, len(jobs)+len(existing))
+	for _, job := range existing {
+		graph[job.UUID] = job.DependsOn
+	}
+	for _, job := range jobs {
+		graph[job.UUID] = job.DependsOn
+	}
+
+	invalid := make(map[string]*ValidationError)
+	reject := func(job *Job, field, format string, args ...interface{}) {
+		if invalid[job.UUID] == nil {
+			invalid[job.UUID] = &ValidationError{}
+		}
+		invalid[job.UUID].add(field, format, args...)
+	}
+
+	for _, job := range jobs {
+		for i, dep := range job.DependsOn {
+			if _, ok := graph[dep]; !ok {
+				reject(job, fmt.Sprintf("depends_on[%d]", i), "job %s does not exist", dep)
+			}
+		}
+
+		if cycle := dependencyCycle(graph, job.UUID); cycle != nil {
+			reject(job, "depends_on", "the dependencies form a cycle %s", strings.Join(cycle, " -> "))
+		}
+	}
+
+	for rejected := true; rejected; {
+		rejected = false
+		for _, job := range jobs {
+			if invalid[job.UUID] != nil {
+				continue
+			}
+
+			for i, dep := range job.DependsOn {
+				if invalid[dep] != nil {
+					reject(job, fmt.Sprintf("depends_on[%d]", i), "job %s is invalid", dep)
+					rejected = true
+					break
+				}
+			}
+		}
+	}
+
+	errs := make(map[string]error, len(invalid))
+	for id, err := range invalid {
+		errs[id] = err
+	}
+
+	return errs
+}
+
+// dependencyCycle returns the path from the job back to itself if its dependencies lead to it
+func dependencyCycle(graph map[string][]string, id string) []string {
+	visited := make(map[string]bool)
+
+	var visit func(path []string) []string
+	visit = func(path []string) []string {
+		for _, dep := range graph[path[len(path)-1]] {
+			if dep == id {
+				return append(path, dep)
+			}
+
+			if visited[dep] {
+				continue
+			}
+			visited[dep] = true
+
+			if cycle := visit(append(path, dep)); cycle != nil {
+				return cycle
+			}
+		}
+
+		return nil
+	}
+
+	return visit([]string{id})
+}
+
+// Skip marks the job as skipped because the given dependency did not finish successfully
+func (j *Job) Skip(dependency string, reason string, now time.Time) {
+	j.Status = JobStatusSkipped
+	j.Error = &JobError{
+		Kind:    JobErrorKindDependency,
+		Message: fmt.Sprintf("dependency %s %s", dependency, reason),
+	}
+	j.FinishedAt = &JSONTime{Time: now}
+	j.ScheduleCallback(now)
+}
+
+// InjectResultsOf copies the results of the given upstream jobs into the vars of the job. Vars
+// that are set already are kept, so the own vars of a job and earlier dependencies take precedence.
+// Results that are no strings are set as their json representation.
+func (j *Job) InjectResultsOf(upstream []*Job) {
+	if j.Vars == nil {
+		j.Vars = make(map[string]string)
+	}
+
+	for _, u := range upstream {
+		for key, value := range u.Results {
+			if _, ok := j.Vars[key]; ok {
+				continue
+			}
+
+			if str, ok := value.(string); ok {
+				j.Vars[key] = str
+				continue
+			}
+
+			b, err := json.Marshal(value)
+			if err != nil {
+				j.Vars[key] = fmt.Sprint(value)
+				continue
+			}
+
+			j.Vars[key] = string(b)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"testing"
+	"time"
+)
+
+func TestJob_InjectResultsOf(t *testing.T) {
+	job := &Job{Vars: map[string]string{"user": "own"}}
+	upstream := []*Job{
+		{UUID: "1", Results: map[string]interface{}{"user": "first", "cookies": []interface{}{"a", "b"}}},
+		{UUID: "2", Results: map[string]interface{}{"cookies": "second", "count": 2}},
+	}
+
+	job.InjectResultsOf(upstream)
+
+	expected := map[string]string{
+		"user":    "own",
+		"cookies": `["a","b"]`,
+		"count":   "2",
+	}
+
+	for key, value := range expected {
+		if job.Vars[key] != value {
+			t.Errorf("Expected var %s to be %q, got %q", key, value, job.Vars[key])
+		}
+	}
+}
+
+func TestJob_Skip(t *testing.T) {
+	now := time.Now()
+	job := &Job{Status: JobStatusWaiting, CallbackURL: "http://localhost"}
+	job.Skip("1234", "has status failed", now)
+
+	if job.Status != JobStatusSkipped || !job.IsFinished() {
+		t.Errorf("Expected job to be skipped, got status %s", job.Status)
+	}
+
+	if job.Error.Kind != JobErrorKindDependency || job.Error.Message != "dependency 1234 has status failed" {
+		t.Errorf("Unexpected error: %v", job.Error)
+	}
+
+	if job.Callback == nil {
+		t.Errorf("Expected callback to be scheduled")
+	}
+}
+
+func TestValidateDependencies(t *testing.T) {
+	existing := []*Job{
+		{UUID: "login"},
+		{UUID: "legacy", DependsOn: []string{"via-existing"}},
+	}
+
+	jobs := []*Job{
+		{UUID: "scrape", DependsOn: []string{"login"}},
+		{UUID: "report", DependsOn: []string{"scrape", "login"}},
+		{UUID: "unknown", DependsOn: []string{"login", "never-created"}},
+		{UUID: "downstream", DependsOn: []string{"unknown"}},
+		{UUID: "cycle-a", DependsOn: []string{"cycle-b"}},
+		{UUID: "cycle-b", DependsOn: []string{"cycle-a"}},
+		{UUID: "via-existing", DependsOn: []string{"legacy"}},
+	}
+
+	errs := ValidateDependencies(jobs, existing)
+
+	expected := map[string]string{
+		"unknown":      "depends_on[1]: job never-created does not exist",
+		"downstream":   "depends_on[0]: job unknown is invalid",
+		"cycle-a":      "depends_on: the dependencies form a cycle cycle-a -> cycle-b -> cycle-a",
+		"cycle-b":      "depends_on: the dependencies form a cycle cycle-b -> cycle-a -> cycle-b",
+		"via-existing": "depends_on: the dependencies form a cycle via-existing -> legacy -> via-existing",
+	}
+
+	if len(errs) != len(expected) {
+		t.Errorf("Expected %d invalid jobs, got %v", len(expected), errs)
+	}
+
+	for id, message := range expected {
+		if err := errs[id]; err == nil || err.Error() != message {
+			t.Errorf("Expected job %s to be invalid with %q, got %v", id, message, err)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// Error codes of API error responses
+const (
+	ErrorCodeUnauthorized     = "unauthorized"
+	ErrorCodeNotFound         = "not_found"
+	ErrorCodeMethodNotAllowed = "method_not_allowed"
+	ErrorCodeInvalidBody      = "invalid_body"
+	ErrorCodeBodyTooLarge     = "body_too_large"
+	ErrorCodeInvalidParameter = "invalid_parameter"
+	ErrorCodeInvalidResource  = "invalid_resource"
+	ErrorCodeValidationFailed = "validation_failed"
+	ErrorCodeAlreadyExists    = "already_exists"
+	ErrorCodeConflict         = "conflict"
+	ErrorCodeNotCancellable   = "not_cancellable"
+	ErrorCodeTimeout          = "timeout"
+	ErrorCodeInternal         = "internal_error"
+)
+
+// errorTypeDefault is the RFC 7807 problem type of errors that are described by their status code
+const errorTypeDefault = "about:blank"
+
+// An Error is the body of every failed API request, following the RFC 7807 problem details format.
+// Code is a machine readable identifier of the error, Details optionally holds structured
+// information about it, like the invalid fields of a request.
+type Error struct {
+	Type      string      `json:"type"`
+	Title     string      `json:"title"`
+	Status    int         `json:"status"`
+	Code      string      `json:"code"`
+	Message   string      `json:"detail"`
+	Details   interface{} `json:"details,omitempty"`
+	RequestID string      `json:"request_id,omitempty"`
+}
+
+// NewError returns a new Error with the given status, code and formatted message
+func NewError(status int, code, format string, args ...interface{}) *Error {
+	return &Error{
+		Type:    errorTypeDefault,
+		Title:   http.StatusText(status),
+		Status:  status,
+		Code:    code,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+// WithDetails sets the details of the error and returns it
+func (e *Error) WithDetails(details interface{}) *Error {
+	e.Details = details
+	return e
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
@@ -0,0 +1,20 @@
+package api
+
+// Job event types
+const (
+	JobEventStatus  = "status"
+	JobEventResult  = "result"
+	JobEventDeleted = "deleted"
+	JobEventLog     = "log"
+)
+
+// A JobEvent is streamed to clients whenever a job changes. Offset is the position of the first of
+// the Logs within all logs of the job.
+type JobEvent struct {
+	Type   string   `json:"type"`
+	UUID   string   `json:"uuid"`
+	Time   JSONTime `json:"time"`
+	Data   *Job     `json:"data,omitempty"`
+	Logs   []Log    `json:"logs,omitempty"`
+	Offset int      `json:"offset,omitempty"`
+}
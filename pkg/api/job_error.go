@@ -0,0 +1,55 @@
+package api
+
+import (
+	"encoding/json"
+)
+
+// Job error kinds set by the gateway itself
+const (
+	JobErrorKindUnknown    = "Error"
+	JobErrorKindTimeout    = "TimeoutError"
+	JobErrorKindDependency = "DependencyError"
+	JobErrorKindModule     = "ModuleError"
+)
+
+// A JobError describes why the execution of a job failed
+type JobError struct {
+	Kind    string `json:"kind"`
+	Message string `json:"message"`
+	Stack   string `json:"stack,omitempty"`
+	Line    int    `json:"line,omitempty"`
+}
+
+// UnmarshalJSON parses the error either from an object or from a plain error message string,
+// as sent by older executors and stored in older job documents.
+func (e *JobError) UnmarshalJSON(b []byte) error {
+	var message string
+	if err := json.Unmarshal(b, &message); err == nil {
+		*e = JobError{Message: message}
+		if message != "" {
+			e.Kind = JobErrorKindUnknown
+		}
+		return nil
+	}
+
+	type jobError JobError
+	return json.Unmarshal(b, (*jobError)(e))
+}
+
+// IsEmpty returns true when the error does not describe anything
+func (e *JobError) IsEmpty() bool {
+	return e == nil || (e.Kind == "" && e.Message == "")
+}
+
+// String returns a string representation of the error
+func (e *JobError) String() string {
+	if e.IsEmpty() {
+		return ""
+	}
+
+	if e.Kind == "" {
+		return e.Message
+	}
+
+	return e.Kind + ": " + e.Message
+}
@@ -0,0 +1,47 @@
+package api
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestJobError_UnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  *JobError
+	}{
+		{"object", `{"error":{"kind":"TypeError","message":"x is undefined","stack":"at line 2","line":2}}`, &JobError{Kind: "TypeError", Message: "x is undefined", Stack: "at line 2", Line: 2}},
+		{"string", `{"error":"x is undefined"}`, &JobError{Kind: JobErrorKindUnknown, Message: "x is undefined"}},
+		{"empty string", `{"error":""}`, &JobError{}},
+		{"null", `{"error":null}`, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var res JobResult
+			if err := json.Unmarshal([]byte(test.input), &res); err != nil {
+				t.Fatal(err)
+			}
+
+			if (res.Error == nil) != (test.want == nil) || (res.Error != nil && *res.Error != *test.want) {
+				t.Fatalf("Expected error %+v, got %+v", test.want, res.Error)
+			}
+		})
+	}
+}
+
+func TestJobError_IsEmpty(t *testing.T) {
+	var e *JobError
+	if !e.IsEmpty() {
+		t.Errorf("Expected nil error to be empty")
+	}
+
+	if !(&JobError{}).IsEmpty() {
+		t.Errorf("Expected zero error to be empty")
+	}
+
+	if (&JobError{Message: "failed"}).IsEmpty() {
+		t.Errorf("Expected error with message not to be empty")
+	}
+}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// A Module is a named and versioned module source, jobs reference it by name@version instead
+// of shipping the source inline.
+type Module struct {
+	VersionMeta
+	Source string `json:"source"`
+	Hash   string `json:"hash"`
+}
+
+// Validate checks the user supplied fields of the module
+func (m *Module) Validate() error {
+	if err := validateName(m.Name); err != nil {
+		return err
+	}
+
+	if m.Source == "" {
+		return errors.New("the source must not be empty")
+	}
+
+	return nil
+}
+
+// SetHash sets the hash of the module to the hex encoded sha256 sum of its source
+func (m *Module) SetHash() {
+	sum := sha256.Sum256([]byte(m.Source))
+	m.Hash = hex.EncodeToString(sum[:])
+}
+
+// ParseModuleRef splits a module reference of the form name@version into its parts. A reference
+// without version refers to the latest version and returns version 0.
+func ParseModuleRef(ref string) (string, int, error) {
+	parts := strings.SplitN(ref, "@", 2)
+	if err := validateName(parts[0]); err != nil {
+		return "", 0, fmt.Errorf("invalid module reference %q: %v", ref, err)
+	}
+
+	if len(parts) == 1 {
+		return parts[0], 0, nil
+	}
+
+	version, err := strconv.Atoi(parts[1])
+	if err != nil || version < 1 {
+		return "", 0, fmt.Errorf("invalid module reference %q: the version must be a positive number", ref)
+	}
+
+	return parts[0], version, nil
+}
+
+// ModuleResponse is the wrapper around a module when returned through API
+type ModuleResponse struct {
+	Data *Module `json:"data"`
+}
+
+// ModulesResponse is the wrapper around a list of modules when returned through API
+type ModulesResponse struct {
+	Data []*Module `json:"data"`
+}
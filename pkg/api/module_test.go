@@ -0,0 +1,43 @@
+package api
+
+import (
+	"testing"
+)
+
+func TestParseModuleRef(t *testing.T) {
+	tests := []struct {
+		ref     string
+		name    string
+		version int
+		valid   bool
+	}{
+		{"helper@3", "helper", 3, true},
+		{"helper", "helper", 0, true},
+		{"helper@0", "", 0, false},
+		{"helper@latest", "", 0, false},
+		{"Helper@1", "", 0, false},
+		{"", "", 0, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.ref, func(t *testing.T) {
+			name, version, err := ParseModuleRef(test.ref)
+			if (err == nil) != test.valid {
+				t.Fatalf("Expected valid=%v, got error %v", test.valid, err)
+			}
+
+			if name != test.name || version != test.version {
+				t.Errorf("Expected %s@%d, got %s@%d", test.name, test.version, name, version)
+			}
+		})
+	}
+}
+
+func TestModule_SetHash(t *testing.T) {
+	m := &Module{VersionMeta: VersionMeta{Name: "helper"}, Source: "export default 1"}
+	m.SetHash()
+
+	if m.Hash != "f2ed650f15f224fa0836d26fabb81f0e219e1e3515d41640040073b222ffcbfd" {
+		t.Errorf("Unexpected hash: %s", m.Hash)
+	}
+}
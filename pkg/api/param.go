@@ -0,0 +1,63 @@
+package api
+
+import (
+	"fmt"
+	"regexp"
+)
+
+var namePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// A Param is a declared variable with an optional default value
+type Param struct {
+	Name     string `json:"name"`
+	Required bool   `json:"required"`
+	Default  string `json:"default"`
+}
+
+func validateName(name string) error {
+	if !namePattern.MatchString(name) {
+		return fmt.Errorf("the name %q must match %s", name, namePattern)
+	}
+
+	return nil
+}
+
+func validateParams(params []Param) error {
+	names := make(map[string]bool, len(params))
+	for _, p := range params {
+		if p.Name == "" || names[p.Name] {
+			return fmt.Errorf("the param name %q is empty or used more than once", p.Name)
+		}
+		names[p.Name] = true
+	}
+
+	return nil
+}
+
+// ApplyParams checks the given values against the declared params and returns them with the
+// defaults of all missing params. Required params must be given, unknown ones are rejected.
+func ApplyParams(params []Param, values map[string]string) (map[string]string, error) {
+	known := make(map[string]bool, len(params))
+	result := make(map[string]string, len(params))
+	for _, p := range params {
+		known[p.Name] = true
+
+		value, ok := values[p.Name]
+		if !ok && p.Required {
+			return nil, fmt.Errorf("the param %s is required", p.Name)
+		}
+		if !ok {
+			value = p.Default
+		}
+
+		result[p.Name] = value
+	}
+
+	for name := range values {
+		if !known[name] {
+			return nil, fmt.Errorf("the param %s is unknown", name)
+		}
+	}
+
+	return result, nil
+}
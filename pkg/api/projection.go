@@ -0,0 +1,103 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// JobFieldsAll selects all fields of a job when given as list of fields
+const JobFieldsAll = "*"
+
+// JobSummaryFields are the fields of the summary of a job, which leaves out the code, modules,
+// vars, logs, results and attempts that make up most of the size of a job
+var JobSummaryFields = []string{
+	"uuid", "status", "priority", "labels", "error", "artifacts", "created_at", "run_at", "queued_at",
+	"started_at", "finished_at", "cancelled_at", "duration", "timeout", "attempt", "max_retries",
+	"batch_id", "depends_on", "workflow_run_id", "template",
+}
+
+// jobFields are the names of all fields of a job that are returned through API
+var jobFields = publicFieldNames(reflect.TypeOf(Job{}), "_rev", "callback_secret")
+
+func publicFieldNames(t reflect.Type, private ...string) map[string]bool {
+	names := make(map[string]bool, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name != "" && name != "-" {
+			names[name] = true
+		}
+	}
+
+	for _, name := range private {
+		delete(names, name)
+	}
+
+	return names
+}
+
+// ParseJobFields parses a comma separated list of job fields. The uuid is always part of the
+// result, all fields are selected by JobFieldsAll, which is returned as nil.
+func ParseJobFields(str string) ([]string, error) {
+	if str == JobFieldsAll {
+		return nil, nil
+	}
+
+	fields := []string{"uuid"}
+	for _, field := range strings.Split(str, ",") {
+		field = strings.TrimSpace(field)
+		if !jobFields[field] {
+			return nil, fmt.Errorf("unknown job field %q", field)
+		}
+
+		if field != "uuid" {
+			fields = append(fields, field)
+		}
+	}
+
+	return fields, nil
+}
+
+// A PartialJob holds the selected fields of a job, it is encoded just like a job but leaves out
+// all other fields instead of encoding their zero values
+type PartialJob map[string]json.RawMessage
+
+// NewPartialJob returns the given fields of the job, nil fields select all of them
+func NewPartialJob(job *Job, fields []string) (PartialJob, error) {
+	b, err := json.Marshal(job)
+	if err != nil {
+		return nil, err
+	}
+
+	all := PartialJob{}
+	if err := json.Unmarshal(b, &all); err != nil {
+		return nil, err
+	}
+
+	if fields == nil {
+		return all, nil
+	}
+
+	partial := make(PartialJob, len(fields))
+	for _, field := range fields {
+		if value, ok := all[field]; ok {
+			partial[field] = value
+		}
+	}
+
+	return partial, nil
+}
+
+// PartialJobResponse is the wrapper around a partial job when returned through API
+type PartialJobResponse struct {
+	Data PartialJob `json:"data"`
+}
+
+// PartialJobsResponse is the wrapper around a list of partial jobs when returned through API, it
+// is decoded just like a JobsResponse
+type PartialJobsResponse struct {
+	Data  []PartialJob `json:"data"`
+	Meta  *ListMeta    `json:"meta,omitempty"`
+	Links *ListLinks   `json:"links,omitempty"`
+}
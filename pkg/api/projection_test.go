@@ -0,0 +1,58 @@
+package api
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseJobFields(t *testing.T) {
+	fields, err := ParseJobFields("status, code,uuid")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(fields, []string{"uuid", "status", "code"}) {
+		t.Errorf("Unexpected fields: %v", fields)
+	}
+
+	if fields, err := ParseJobFields(JobFieldsAll); err != nil || fields != nil {
+		t.Errorf("Expected all fields, got %v, %v", fields, err)
+	}
+
+	for _, str := range []string{"unknown", "status,", "_rev", "callback_secret"} {
+		if _, err := ParseJobFields(str); err == nil {
+			t.Errorf("Expected %q to be invalid", str)
+		}
+	}
+
+	for _, field := range JobSummaryFields {
+		if !jobFields[field] {
+			t.Errorf("Summary field %s is no field of a job", field)
+		}
+	}
+}
+
+func TestNewPartialJob(t *testing.T) {
+	job := NewJob()
+	job.UUID = "asdf-1234"
+	job.Code = "export default 1"
+	job.Status = JobStatusDone
+
+	partial, err := NewPartialJob(job, []string{"uuid", "status"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(partial) != 2 || string(partial["uuid"]) != `"asdf-1234"` || string(partial["status"]) != `"done"` {
+		t.Errorf("Unexpected partial job: %s", partial)
+	}
+
+	all, err := NewPartialJob(job, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(all["code"]) != `"export default 1"` {
+		t.Errorf("Expected all fields, got %s", all)
+	}
+}
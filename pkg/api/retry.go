@@ -0,0 +1,50 @@
+package api
+
+import (
+	"time"
+)
+
+// Backoff types
+const (
+	BackoffTypeFixed       = "fixed"
+	BackoffTypeExponential = "exponential"
+)
+
+// maxBackoffShift limits the exponential growth of the retry delay to avoid overflows
+const maxBackoffShift = 20
+
+// A Backoff defines how long to wait before a failed job is retried
+type Backoff struct {
+	Type      string `json:"type"`
+	BaseDelay int    `json:"base_delay"`
+}
+
+// Duration returns the time to wait before starting the given attempt, where attempt
+// is the number of the already failed attempts
+func (b *Backoff) Duration(attempt int) time.Duration {
+	if b == nil || b.BaseDelay <= 0 || attempt < 1 {
+		return 0
+	}
+
+	delay := time.Duration(b.BaseDelay) * time.Millisecond
+	if b.Type != BackoffTypeExponential {
+		return delay
+	}
+
+	shift := attempt - 1
+	if shift > maxBackoffShift {
+		shift = maxBackoffShift
+	}
+
+	return delay << uint(shift)
+}
+
+// A JobAttempt holds the outcome of a single execution of a job
+type JobAttempt struct {
+	Attempt    int       `json:"attempt"`
+	Error      *JobError `json:"error"`
+	Logs       []Log     `json:"logs"`
+	StartedAt  *JSONTime `json:"started_at"`
+	FinishedAt *JSONTime `json:"finished_at"`
+	Duration   int       `json:"duration"`
+}
@@ -0,0 +1,30 @@
+package api
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoff_Duration(t *testing.T) {
+	tests := []struct {
+		name     string
+		backoff  *Backoff
+		attempt  int
+		expected time.Duration
+	}{
+		{"nil", nil, 1, 0},
+		{"fixed first", &Backoff{Type: BackoffTypeFixed, BaseDelay: 500}, 1, 500 * time.Millisecond},
+		{"fixed third", &Backoff{Type: BackoffTypeFixed, BaseDelay: 500}, 3, 500 * time.Millisecond},
+		{"exponential first", &Backoff{Type: BackoffTypeExponential, BaseDelay: 500}, 1, 500 * time.Millisecond},
+		{"exponential third", &Backoff{Type: BackoffTypeExponential, BaseDelay: 500}, 3, 2 * time.Second},
+		{"exponential capped", &Backoff{Type: BackoffTypeExponential, BaseDelay: 1}, 100, time.Millisecond << maxBackoffShift},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if d := test.backoff.Duration(test.attempt); d != test.expected {
+				t.Errorf("Expected duration %v, got %v", test.expected, d)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"reflect"
+)
+
+// A Schedule creates jobs from its job template whenever its cron expression is due
+type Schedule struct {
+	UUID        string       `json:"uuid"`
+	Rev         string       `json:"_rev,omitempty"`
+	Name        string       `json:"name"`
+	Cron        string       `json:"cron"`
+	Timezone    string       `json:"timezone"`
+	Paused      bool         `json:"paused"`
+	Job         *ScheduleJob `json:"job"`
+	CreatedAt   JSONTime     `json:"created_at"`
+	LastRunAt   *JSONTime    `json:"last_run_at"`
+	LastJobUUID string       `json:"last_job_uuid"`
+	NextRunAt   *JSONTime    `json:"next_run_at"`
+}
+
+// A ScheduleJob is the template of the jobs created by a schedule
+type ScheduleJob struct {
+	Code    string            `json:"code"`
+	Vars    map[string]string `json:"vars"`
+	Modules map[string]string `json:"modules"`
+	Labels  map[string]string `json:"labels"`
+}
+
+// NewSchedule creates a new Schedule instance
+func NewSchedule() *Schedule {
+	return &Schedule{
+		Job: &ScheduleJob{
+			Vars:    make(map[string]string),
+			Modules: make(map[string]string),
+		},
+	}
+}
+
+// NewJob creates a new job from the job template of the schedule
+func (s *Schedule) NewJob(uuid string, createdAt JSONTime) *Job {
+	job := s.Job.Job()
+	job.UUID = uuid
+	job.Status = JobStatusCreated
+	job.CreatedAt = createdAt
+
+	return job
+}
+
+// Job returns a job with the user supplied fields of the template only, as submitted by a client
+func (j *ScheduleJob) Job() *Job {
+	job := NewJob()
+	job.Code = j.Code
+
+	for k, v := range j.Vars {
+		job.Vars[k] = v
+	}
+
+	for k, v := range j.Modules {
+		job.Modules[k] = v
+	}
+
+	if len(j.Labels) > 0 {
+		job.Labels = make(map[string]string, len(j.Labels))
+		for k, v := range j.Labels {
+			job.Labels[k] = v
+		}
+	}
+
+	return job
+}
+
+// Equal returns true when both given Schedules are equal
+func (s *Schedule) Equal(s2 *Schedule) bool {
+	return s.UUID == s2.UUID &&
+		s.Name == s2.Name &&
+		s.Cron == s2.Cron &&
+		s.Timezone == s2.Timezone &&
+		s.Paused == s2.Paused &&
+		reflect.DeepEqual(s.Job, s2.Job) &&
+		datesAreEqual(&s.CreatedAt, &s2.CreatedAt) &&
+		datesAreEqual(s.LastRunAt, s2.LastRunAt) &&
+		s.LastJobUUID == s2.LastJobUUID &&
+		datesAreEqual(s.NextRunAt, s2.NextRunAt)
+}
+
+// ScheduleResponse is the wrapper around a schedule when returned through API
+type ScheduleResponse struct {
+	Data *Schedule `json:"data"`
+}
+
+// SchedulesResponse is the wrapper around a list of schedules when returned through API
+type SchedulesResponse struct {
+	Data []*Schedule `json:"data"`
+}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"errors"
+)
+
+// A Template is a named and versioned bundle of code and modules, jobs are created from it
+// by passing vars that are checked against the declared vars of the template.
+type Template struct {
+	VersionMeta
+	Code       string            `json:"code"`
+	Modules    map[string]string `json:"modules"`
+	ModuleRefs []string          `json:"module_refs"`
+	Vars       []Param           `json:"vars"`
+}
+
+// Validate checks the user supplied fields of the template
+func (t *Template) Validate() error {
+	if err := validateName(t.Name); err != nil {
+		return err
+	}
+
+	if t.Code == "" {
+		return errors.New("the code must not be empty")
+	}
+
+	for _, ref := range t.ModuleRefs {
+		if _, _, err := ParseModuleRef(ref); err != nil {
+			return err
+		}
+	}
+
+	return validateParams(t.Vars)
+}
+
+// Apply sets the code and modules of the template on the job and replaces its vars with the
+// given ones, completed by the defaults of the template.
+func (t *Template) Apply(job *Job) error {
+	if job.Code != "" || len(job.Modules) > 0 || len(job.ModuleRefs) > 0 {
+		return errors.New("code and modules are defined by the template")
+	}
+
+	vars, err := ApplyParams(t.Vars, job.Vars)
+	if err != nil {
+		return err
+	}
+
+	job.Code = t.Code
+	job.Vars = vars
+	job.Modules = make(map[string]string, len(t.Modules))
+	for k, v := range t.Modules {
+		job.Modules[k] = v
+	}
+	job.ModuleRefs = append([]string(nil), t.ModuleRefs...)
+
+	return nil
+}
+
+// TemplateResponse is the wrapper around a template when returned through API
+type TemplateResponse struct {
+	Data *Template `json:"data"`
+}
+
+// TemplatesResponse is the wrapper around a list of templates when returned through API
+type TemplatesResponse struct {
+	Data []*Template `json:"data"`
+}
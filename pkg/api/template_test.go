@@ -0,0 +1,65 @@
+package api
+
+import (
+	"testing"
+)
+
+func newTestTemplate() *Template {
+	return &Template{
+		VersionMeta: VersionMeta{Name: "scrape", Version: 1},
+		Code:        "scrape()",
+		Modules:     map[string]string{"helper": "export default 1"},
+		Vars: []Param{
+			{Name: "url", Required: true},
+			{Name: "depth", Default: "1"},
+		},
+	}
+}
+
+func TestTemplate_Validate(t *testing.T) {
+	if err := newTestTemplate().Validate(); err != nil {
+		t.Errorf("Expected template to be valid: %v", err)
+	}
+
+	noCode := newTestTemplate()
+	noCode.Code = ""
+	if err := noCode.Validate(); err == nil {
+		t.Errorf("Expected template without code to be invalid")
+	}
+
+	duplicateVar := newTestTemplate()
+	duplicateVar.Vars[1].Name = "url"
+	if err := duplicateVar.Validate(); err == nil {
+		t.Errorf("Expected template with duplicate var to be invalid")
+	}
+}
+
+func TestTemplate_Apply(t *testing.T) {
+	tpl := newTestTemplate()
+
+	job := NewJob()
+	job.Vars["url"] = "https://example.com"
+	if err := tpl.Apply(job); err != nil {
+		t.Fatal(err)
+	}
+
+	if job.Code != tpl.Code || job.Modules["helper"] != tpl.Modules["helper"] {
+		t.Errorf("Expected code and modules of the template, got %+v", job)
+	}
+
+	if job.Vars["url"] != "https://example.com" || job.Vars["depth"] != "1" {
+		t.Errorf("Unexpected vars: %v", job.Vars)
+	}
+
+	missing := NewJob()
+	if err := tpl.Apply(missing); err == nil {
+		t.Errorf("Expected missing required var to fail")
+	}
+
+	withCode := NewJob()
+	withCode.Vars["url"] = "https://example.com"
+	withCode.Code = "other()"
+	if err := tpl.Apply(withCode); err == nil {
+		t.Errorf("Expected job with own code to fail")
+	}
+}
@@ -15,8 +15,9 @@ func (t JSONTime) String() string {
 	return t.Format(time.RFC3339)
 }
 
-// MarshalJSON formats the timestamp as JSON
+// MarshalJSON formats the timestamp as JSON. Timestamps are always written in UTC, as the database
+// compares them as strings, which only gives the right order if all of them share the time zone.
 func (t JSONTime) MarshalJSON() ([]byte, error) {
-	date := fmt.Sprintf("%q", t.String())
+	date := fmt.Sprintf("%q", t.UTC().Format(time.RFC3339))
 	return []byte(date), nil
 }
@@ -12,8 +12,9 @@ type testJSON struct {
 }
 
 var (
-	jsonDate = []byte("{\"test\":\"2018-08-18T10:31:17+02:00\"}")
-	rawDate  = "2018-08-18T10:31:17+02:00"
+	jsonDate    = []byte("{\"test\":\"2018-08-18T10:31:17+02:00\"}")
+	jsonUTCDate = []byte("{\"test\":\"2018-08-18T08:31:17Z\"}")
+	rawDate     = "2018-08-18T10:31:17+02:00"
 )
 
 func getTestTime(t *testing.T) JSONTime {
@@ -35,8 +36,8 @@ func TestJSONTime_MarshalJSON(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	if !bytes.Equal(b, jsonDate) {
-		t.Fatalf("Expected to get %q, got %q", string(jsonDate), string(b))
+	if !bytes.Equal(b, jsonUTCDate) {
+		t.Fatalf("Expected to get %q, got %q", string(jsonUTCDate), string(b))
 	}
 }
 
@@ -2,24 +2,45 @@ package api
 
 import (
 	"reflect"
+	"time"
 )
 
 // A Job is executed by the executor and stored in the database and holds all information
 // required to let the puppets dance in the browser
 type Job struct {
-	UUID       string                 `json:"uuid"`
-	Rev        string                 `json:"_rev,omitempty"`
-	Code       string                 `json:"code"`
-	Status     string                 `json:"status"`
-	Vars       map[string]string      `json:"vars"`
-	Modules    map[string]string      `json:"modules"`
-	Error      string                 `json:"error"`
-	Logs       []Log                  `json:"logs"`
-	Results    map[string]interface{} `json:"results"`
-	CreatedAt  JSONTime               `json:"created_at"`
-	StartedAt  *JSONTime              `json:"started_at"`
-	FinishedAt *JSONTime              `json:"finished_at"`
-	Duration   int                    `json:"duration"`
+	UUID           string                 `json:"uuid"`
+	Rev            string                 `json:"_rev,omitempty"`
+	Code           string                 `json:"code"`
+	Status         string                 `json:"status"`
+	Priority       uint8                  `json:"priority"`
+	Vars           map[string]string      `json:"vars"`
+	Labels         map[string]string      `json:"labels"`
+	Modules        map[string]string      `json:"modules"`
+	ModuleRefs     []string               `json:"module_refs"`
+	Error          *JobError              `json:"error"`
+	Logs           []Log                  `json:"logs"`
+	Results        map[string]interface{} `json:"results"`
+	Artifacts      []Artifact             `json:"artifacts"`
+	CreatedAt      JSONTime               `json:"created_at"`
+	RunAt          *JSONTime              `json:"run_at"`
+	QueuedAt       *JSONTime              `json:"queued_at"`
+	StartedAt      *JSONTime              `json:"started_at"`
+	FinishedAt     *JSONTime              `json:"finished_at"`
+	CancelledAt    *JSONTime              `json:"cancelled_at"`
+	Duration       int                    `json:"duration"`
+	Timeout        int                    `json:"timeout"`
+	MaxRetries     int                    `json:"max_retries"`
+	Backoff        *Backoff               `json:"backoff"`
+	Attempt        int                    `json:"attempt"`
+	Attempts       []JobAttempt           `json:"attempts"`
+	CallbackURL    string                 `json:"callback_url"`
+	CallbackSecret string                 `json:"callback_secret,omitempty"`
+	Callback       *JobCallback           `json:"callback"`
+	BatchID        string                 `json:"batch_id"`
+	DependsOn      []string               `json:"depends_on"`
+	InjectResults  bool                   `json:"inject_results"`
+	WorkflowRunID  string                 `json:"workflow_run_id"`
+	Template       string                 `json:"template"`
 }
 
 // NewJob creates a new Job instance
@@ -36,22 +57,140 @@ func (j *Job) Equal(j2 *Job) bool {
 	return j.UUID == j2.UUID &&
 		j.Code == j2.Code &&
 		j.Status == j2.Status &&
+		j.Priority == j2.Priority &&
 		reflect.DeepEqual(j.Modules, j2.Modules) &&
+		reflect.DeepEqual(j.ModuleRefs, j2.ModuleRefs) &&
 		reflect.DeepEqual(j.Vars, j2.Vars) &&
+		reflect.DeepEqual(j.Labels, j2.Labels) &&
 		datesAreEqual(&j.CreatedAt, &j2.CreatedAt) &&
+		datesAreEqual(j.RunAt, j2.RunAt) &&
+		datesAreEqual(j.QueuedAt, j2.QueuedAt) &&
 		datesAreEqual(j.StartedAt, j2.StartedAt) &&
 		datesAreEqual(j.FinishedAt, j2.FinishedAt) &&
-		j.Error == j2.Error &&
+		datesAreEqual(j.CancelledAt, j2.CancelledAt) &&
+		j.Timeout == j2.Timeout &&
+		j.MaxRetries == j2.MaxRetries &&
+		reflect.DeepEqual(j.Backoff, j2.Backoff) &&
+		j.Attempt == j2.Attempt &&
+		reflect.DeepEqual(j.Attempts, j2.Attempts) &&
+		j.CallbackURL == j2.CallbackURL &&
+		j.CallbackSecret == j2.CallbackSecret &&
+		reflect.DeepEqual(j.Callback, j2.Callback) &&
+		j.BatchID == j2.BatchID &&
+		reflect.DeepEqual(j.DependsOn, j2.DependsOn) &&
+		j.InjectResults == j2.InjectResults &&
+		j.WorkflowRunID == j2.WorkflowRunID &&
+		j.Template == j2.Template &&
+		reflect.DeepEqual(j.Error, j2.Error) &&
 		reflect.DeepEqual(j.Results, j2.Results) &&
+		reflect.DeepEqual(j.Artifacts, j2.Artifacts) &&
 		reflect.DeepEqual(j.Logs, j2.Logs)
 }
 
+// ClearPrivateFields removes all fields that must not be returned through API
+func (j *Job) ClearPrivateFields() {
+	j.Rev = ""
+	j.CallbackSecret = ""
+}
+
+// ShouldRetry returns true when the job has retries left after a failed attempt
+func (j *Job) ShouldRetry() bool {
+	return j.Attempt <= j.MaxRetries
+}
+
+// RecordAttempt increments the attempt counter and keeps the outcome of the current attempt
+func (j *Job) RecordAttempt() {
+	j.Attempt++
+	j.Attempts = append(j.Attempts, JobAttempt{
+		Attempt:    j.Attempt,
+		Error:      j.Error,
+		Logs:       j.Logs,
+		StartedAt:  j.StartedAt,
+		FinishedAt: j.FinishedAt,
+		Duration:   j.Duration,
+	})
+}
+
+// Retry moves the job back to created, so it is queued again once its backoff delay has passed.
+// The logs of the failed attempt are only kept in its attempt.
+func (j *Job) Retry(now time.Time) {
+	runAt := JSONTime{Time: now.Add(j.Backoff.Duration(j.Attempt))}
+	j.Status = JobStatusCreated
+	j.RunAt = &runAt
+	j.Logs = nil
+}
+
+// IsTimedOut returns true when the job has a timeout and has been queued for longer than that
+func (j *Job) IsTimedOut(now time.Time) bool {
+	if j.Timeout <= 0 || j.QueuedAt == nil {
+		return false
+	}
+
+	return now.Sub(j.QueuedAt.Time) > time.Duration(j.Timeout)*time.Millisecond
+}
+
+// IsFinished returns true when the job has reached a final status
+func (j *Job) IsFinished() bool {
+	return IsFinishedStatus(j.Status)
+}
+
+// IsFinishedStatus returns true when the given job status is a final one
+func IsFinishedStatus(status string) bool {
+	switch status {
+	case JobStatusDone, JobStatusFailed, JobStatusCancelled, JobStatusTimedOut, JobStatusSkipped:
+		return true
+	}
+
+	return false
+}
+
+// IsCancellable returns true when the job has not reached a final status yet
+func (j *Job) IsCancellable() bool {
+	switch j.Status {
+	case JobStatusWaiting, JobStatusCreated, JobStatusQueued, JobStatusRunning:
+		return true
+	}
+
+	return false
+}
+
+// IsCurrentAttempt returns true if a message of an executor belongs to the current attempt of the
+// job. The attempt of a message is the attempt field of the job published to the executor, messages
+// without one are accepted, as older executors don't send it.
+func (j *Job) IsCurrentAttempt(attempt *int) bool {
+	return attempt == nil || *attempt == j.Attempt
+}
+
+// A JobCancellation is published when a job got cancelled, so executors are able to abort it.
+// Executors only abort the execution of the given attempt, a retry of the job keeps running.
+type JobCancellation struct {
+	UUID        string   `json:"uuid"`
+	Attempt     int      `json:"attempt"`
+	CancelledAt JSONTime `json:"cancelled_at"`
+}
+
+// A JobStart is emitted by a worker as soon as it begins to execute a job
+type JobStart struct {
+	UUID      string    `json:"uuid"`
+	Attempt   *int      `json:"attempt,omitempty"`
+	StartedAt *JSONTime `json:"started_at"`
+}
+
+// JobLogs are emitted by a worker while executing a job, containing the log lines since the last JobLogs
+type JobLogs struct {
+	UUID    string `json:"uuid"`
+	Attempt *int   `json:"attempt,omitempty"`
+	Logs    []Log  `json:"logs"`
+}
+
 // A JobResult is emitted after a worker did the job and synced to database
 type JobResult struct {
 	UUID       string                 `json:"uuid"`
-	Error      string                 `json:"error"`
+	Attempt    *int                   `json:"attempt,omitempty"`
+	Error      *JobError              `json:"error"`
 	Logs       []Log                  `json:"logs"`
 	Results    map[string]interface{} `json:"results"`
+	Artifacts  []ArtifactUpload       `json:"artifacts"`
 	StartedAt  *JSONTime              `json:"started_at"`
 	FinishedAt *JSONTime              `json:"finished_at"`
 	Duration   int                    `json:"duration"`
@@ -65,13 +204,19 @@ func NewJobResult() *JobResult {
 	}
 }
 
+// Failed returns true when the executor reported an error
+func (j *JobResult) Failed() bool {
+	return !j.Error.IsEmpty()
+}
+
 // Equal returns true when both given JobResults are equal
 func (j *JobResult) Equal(j2 *JobResult) bool {
 	return j.UUID == j2.UUID &&
 		datesAreEqual(j.StartedAt, j2.StartedAt) &&
 		datesAreEqual(j.FinishedAt, j2.FinishedAt) &&
-		j.Error == j2.Error &&
+		reflect.DeepEqual(j.Error, j2.Error) &&
 		reflect.DeepEqual(j.Results, j2.Results) &&
+		reflect.DeepEqual(j.Artifacts, j2.Artifacts) &&
 		reflect.DeepEqual(j.Logs, j2.Logs)
 }
 
@@ -99,7 +244,31 @@ type JobResponse struct {
 	Data *Job `json:"data"`
 }
 
+// LogsResponse is the wrapper around a list of job logs when returned through API
+type LogsResponse struct {
+	Data []Log `json:"data"`
+}
+
 // JobsResponse is the wrapper around a list of jobs when returned through API
 type JobsResponse struct {
-	Data []*Job `json:"data"`
+	Data  []*Job     `json:"data"`
+	Meta  *ListMeta  `json:"meta,omitempty"`
+	Links *ListLinks `json:"links,omitempty"`
+}
+
+// ListMeta describes the page of a list returned through API. Total is not set if the list
+// can't be counted, Page is not set for pages requested by cursor, NextCursor is set if there
+// might be a next page.
+type ListMeta struct {
+	Total      *int   `json:"total,omitempty"`
+	Page       int    `json:"page,omitempty"`
+	PerPage    int    `json:"per_page"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// ListLinks holds the urls of the current, next and previous page of a list returned through API
+type ListLinks struct {
+	Self string `json:"self"`
+	Next string `json:"next,omitempty"`
+	Prev string `json:"prev,omitempty"`
 }
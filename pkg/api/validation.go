@@ -0,0 +1,206 @@
+package api
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Size limits of the user supplied fields of a job, in bytes
+const (
+	MaxJobUUIDSize   = 128
+	MaxJobCodeSize   = 1 << 20
+	MaxJobModuleSize = 1 << 20
+	MaxJobVarsSize   = 1 << 20
+)
+
+// Limits of the labels of a job
+const (
+	MaxJobLabels         = 64
+	MaxJobLabelKeySize   = 63
+	MaxJobLabelValueSize = 255
+)
+
+var (
+	moduleNamePattern = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]*$`)
+	labelKeyPattern   = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)
+)
+
+// A FieldError describes why the value of a single field is invalid
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// A ValidationError lists all invalid fields of a request
+type ValidationError struct {
+	Fields []FieldError `json:"fields"`
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		messages[i] = fmt.Sprintf("%s: %s", f.Field, f.Message)
+	}
+
+	return strings.Join(messages, ", ")
+}
+
+func (e *ValidationError) add(field, format string, args ...interface{}) {
+	e.Fields = append(e.Fields, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+func (e *ValidationError) errorOrNil() error {
+	if len(e.Fields) == 0 {
+		return nil
+	}
+
+	return e
+}
+
+// ValidateNewJob checks a job submitted by a client. It returns a *ValidationError listing all
+// invalid fields, including server owned fields the client must not set.
+// nolint: gocyclo
+func ValidateNewJob(job *Job) error {
+	e := &ValidationError{}
+
+	validateServerOwnedFields(job, e)
+
+	if job.UUID != "" {
+		if err := ValidateJobUUID(job.UUID); err != nil {
+			e.add("uuid", "%v", err)
+		}
+	}
+
+	if strings.TrimSpace(job.Code) == "" {
+		e.add("code", "must not be empty")
+	} else if len(job.Code) > MaxJobCodeSize {
+		e.add("code", "must not be larger than %d bytes", MaxJobCodeSize)
+	}
+
+	for name, source := range job.Modules {
+		field := "modules." + name
+		if !moduleNamePattern.MatchString(name) || strings.Contains(name, "..") {
+			e.add(field, "the module name must match %s and must not contain ..", moduleNamePattern)
+		}
+		if len(source) > MaxJobModuleSize {
+			e.add(field, "must not be larger than %d bytes", MaxJobModuleSize)
+		}
+	}
+
+	for i, ref := range job.ModuleRefs {
+		if _, _, err := ParseModuleRef(ref); err != nil {
+			e.add(fmt.Sprintf("module_refs[%d]", i), "%v", err)
+		}
+	}
+
+	varsSize := 0
+	for key, value := range job.Vars {
+		varsSize += len(key) + len(value)
+	}
+	if varsSize > MaxJobVarsSize {
+		e.add("vars", "must not be larger than %d bytes", MaxJobVarsSize)
+	}
+
+	if len(job.Labels) > MaxJobLabels {
+		e.add("labels", "must not have more than %d labels", MaxJobLabels)
+	}
+	for key, value := range job.Labels {
+		field := "labels." + key
+		if err := ValidateLabel(key, value); err != nil {
+			e.add(field, "%v", err)
+		}
+	}
+
+	if job.Priority > JobPriorityMax {
+		e.add("priority", "must not be greater than %d", JobPriorityMax)
+	}
+
+	if job.Timeout < 0 {
+		e.add("timeout", "must not be negative")
+	}
+
+	if job.MaxRetries < 0 {
+		e.add("max_retries", "must not be negative")
+	}
+
+	if job.Backoff != nil {
+		if job.Backoff.Type != BackoffTypeFixed && job.Backoff.Type != BackoffTypeExponential {
+			e.add("backoff.type", "must be one of %s, %s", BackoffTypeFixed, BackoffTypeExponential)
+		}
+		if job.Backoff.BaseDelay < 0 {
+			e.add("backoff.base_delay", "must not be negative")
+		}
+	}
+
+	if job.CallbackURL != "" {
+		if u, err := url.Parse(job.CallbackURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			e.add("callback_url", "must be an absolute http or https url")
+		}
+	}
+
+	for i, dep := range job.DependsOn {
+		if dep == "" || (job.UUID != "" && dep == job.UUID) {
+			e.add(fmt.Sprintf("depends_on[%d]", i), "must be the uuid of another job")
+		}
+	}
+
+	return e.errorOrNil()
+}
+
+// validateServerOwnedFields adds an error for every field that is set by the server only
+func validateServerOwnedFields(job *Job, e *ValidationError) {
+	fields := []struct {
+		name string
+		set  bool
+	}{
+		{"_rev", job.Rev != ""},
+		{"status", job.Status != ""},
+		{"error", job.Error != nil},
+		{"logs", len(job.Logs) > 0},
+		{"results", len(job.Results) > 0},
+		{"artifacts", len(job.Artifacts) > 0},
+		{"created_at", !job.CreatedAt.IsZero()},
+		{"queued_at", job.QueuedAt != nil},
+		{"started_at", job.StartedAt != nil},
+		{"finished_at", job.FinishedAt != nil},
+		{"cancelled_at", job.CancelledAt != nil},
+		{"duration", job.Duration != 0},
+		{"attempt", job.Attempt != 0},
+		{"attempts", len(job.Attempts) > 0},
+		{"callback", job.Callback != nil},
+		{"batch_id", job.BatchID != ""},
+		{"workflow_run_id", job.WorkflowRunID != ""},
+		{"template", job.Template != ""},
+	}
+
+	for _, f := range fields {
+		if f.set {
+			e.add(f.name, "is set by the server and must not be given")
+		}
+	}
+}
+
+// ValidateJobUUID checks a uuid chosen by a client. It is used within the keys of the artifact
+// store, so it has to be a valid artifact name.
+func ValidateJobUUID(uuid string) error {
+	if !ArtifactNamePattern.MatchString(uuid) || strings.Contains(uuid, "..") || len(uuid) > MaxJobUUIDSize {
+		return fmt.Errorf("the uuid must match %s, must not contain .. and must not be longer than %d bytes", ArtifactNamePattern, MaxJobUUIDSize)
+	}
+
+	return nil
+}
+
+// ValidateLabel checks the key and value of a single label
+func ValidateLabel(key, value string) error {
+	if !labelKeyPattern.MatchString(key) || len(key) > MaxJobLabelKeySize {
+		return fmt.Errorf("the label key must match %s and must not be longer than %d bytes", labelKeyPattern, MaxJobLabelKeySize)
+	}
+
+	if len(value) > MaxJobLabelValueSize {
+		return fmt.Errorf("the label value must not be longer than %d bytes", MaxJobLabelValueSize)
+	}
+
+	return nil
+}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateNewJob(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(job *Job)
+		fields []string
+	}{
+		{"valid", func(job *Job) {}, nil},
+		{"uuid", func(job *Job) { job.UUID = "team/1" }, []string{"uuid"}},
+		{"uuid too long", func(job *Job) { job.UUID = strings.Repeat("a", MaxJobUUIDSize+1) }, []string{"uuid"}},
+		{"empty code", func(job *Job) { job.Code = " " }, []string{"code"}},
+		{"code too large", func(job *Job) { job.Code = strings.Repeat("a", MaxJobCodeSize+1) }, []string{"code"}},
+		{"module name", func(job *Job) { job.Modules["../helper"] = "x" }, []string{"modules.../helper"}},
+		{"module ref", func(job *Job) { job.ModuleRefs = []string{"helper@latest"} }, []string{"module_refs[0]"}},
+		{"labels", func(job *Job) { job.Labels = map[string]string{"team": "growth"} }, nil},
+		{"label key", func(job *Job) { job.Labels = map[string]string{"team.name": "growth"} }, []string{"labels.team.name"}},
+		{"label value", func(job *Job) { job.Labels = map[string]string{"team": strings.Repeat("a", MaxJobLabelValueSize+1)} }, []string{"labels.team"}},
+		{"priority", func(job *Job) { job.Priority = JobPriorityMax + 1 }, []string{"priority"}},
+		{"callback url", func(job *Job) { job.CallbackURL = "/relative" }, []string{"callback_url"}},
+		{"depends on itself", func(job *Job) { job.DependsOn = []string{job.UUID} }, []string{"depends_on[0]"}},
+		{"server owned", func(job *Job) {
+			job.Status = JobStatusDone
+			job.Results = map[string]interface{}{"a": 1}
+			job.CreatedAt = JSONTime{Time: time.Now()}
+		}, []string{"status", "results", "created_at"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			job := NewJob()
+			job.UUID = "asdf-1234"
+			job.Code = "export default 1"
+			job.Modules["helper.js"] = "export default 2"
+			test.modify(job)
+
+			err := ValidateNewJob(job)
+			if test.fields == nil {
+				if err != nil {
+					t.Fatalf("Expected job to be valid, got %v", err)
+				}
+				return
+			}
+
+			validationErr, ok := err.(*ValidationError)
+			if !ok {
+				t.Fatalf("Expected a *ValidationError, got %v", err)
+			}
+
+			if len(validationErr.Fields) != len(test.fields) {
+				t.Fatalf("Expected fields %v, got %+v", test.fields, validationErr.Fields)
+			}
+
+			for i, field := range test.fields {
+				if validationErr.Fields[i].Field != field {
+					t.Errorf("Expected field %s at %d, got %+v", field, i, validationErr.Fields[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package api
+
+import (
+	"fmt"
+)
+
+// VersionMeta identifies a version of a named resource of which every change is stored as a new
+// version, like templates, modules and workflows. These resources embed it.
+type VersionMeta struct {
+	UUID      string   `json:"uuid"`
+	Rev       string   `json:"_rev,omitempty"`
+	Name      string   `json:"name"`
+	Version   int      `json:"version"`
+	CreatedAt JSONTime `json:"created_at"`
+}
+
+// Meta returns the identity of the version, it is promoted to the resources embedding VersionMeta
+func (m *VersionMeta) Meta() *VersionMeta {
+	return m
+}
+
+// Versioned is implemented by all versioned resources
+type Versioned interface {
+	Meta() *VersionMeta
+	// Validate checks the user supplied fields of the resource
+	Validate() error
+}
+
+// VersionedID returns the document id of the given version of a named resource
+func VersionedID(name string, version int) string {
+	return fmt.Sprintf("%s@%d", name, version)
+}
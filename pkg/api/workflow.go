@@ -0,0 +1,358 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Workflow run status
+const (
+	WorkflowRunStatusRunning = "running"
+	WorkflowRunStatusDone    = "done"
+	WorkflowRunStatusFailed  = "failed"
+)
+
+// WorkflowStepStatusPending is the status of a workflow run step that has no job yet
+const WorkflowStepStatusPending = "pending"
+
+var (
+	workflowVarPlaceholder = regexp.MustCompile(`\{\{\s*([^{}\s]+)\s*\}\}`)
+	workflowResultRef      = regexp.MustCompile(`^steps\.([^.]+)\.results\.(.+)$`)
+)
+
+// A Workflow is a named and versioned DAG of job templates. Every change of a workflow is stored
+// as a new version, runs always refer to the version they have been started with.
+type Workflow struct {
+	VersionMeta
+	Params []Param        `json:"params"`
+	Steps  []WorkflowStep `json:"steps"`
+}
+
+// A WorkflowStep is the job template of a single step of a workflow. The vars of a step may
+// refer to params with {{params.<name>}} and to results of its dependencies with
+// {{steps.<step>.results.<key>}}.
+type WorkflowStep struct {
+	Name       string             `json:"name"`
+	Code       string             `json:"code"`
+	Vars       map[string]string  `json:"vars"`
+	Modules    map[string]string  `json:"modules"`
+	Priority   uint8              `json:"priority"`
+	Timeout    int                `json:"timeout"`
+	MaxRetries int                `json:"max_retries"`
+	Backoff    *Backoff           `json:"backoff"`
+	DependsOn  []string           `json:"depends_on"`
+	Condition  *WorkflowCondition `json:"condition"`
+}
+
+// A WorkflowCondition lets a step only run when a result of one of its dependencies has the
+// given value, non string results are compared by their json representation. Otherwise the
+// step and all steps depending on it are skipped.
+type WorkflowCondition struct {
+	Step   string `json:"step"`
+	Result string `json:"result"`
+	Equals string `json:"equals"`
+}
+
+// Step returns the step with the given name or nil if it does not exist
+func (w *Workflow) Step(name string) *WorkflowStep {
+	for i := range w.Steps {
+		if w.Steps[i].Name == name {
+			return &w.Steps[i]
+		}
+	}
+
+	return nil
+}
+
+// Validate checks the user supplied fields of the workflow and makes sure its steps form a DAG
+// nolint: gocyclo
+func (w *Workflow) Validate() error {
+	if err := validateName(w.Name); err != nil {
+		return err
+	}
+
+	if err := validateParams(w.Params); err != nil {
+		return err
+	}
+
+	if len(w.Steps) == 0 {
+		return errors.New("the workflow has no steps")
+	}
+
+	steps := make(map[string]*WorkflowStep, len(w.Steps))
+	for i := range w.Steps {
+		step := &w.Steps[i]
+		if step.Name == "" || steps[step.Name] != nil {
+			return fmt.Errorf("the step name %q is empty or used more than once", step.Name)
+		}
+
+		if step.Code == "" {
+			return fmt.Errorf("the code of step %s must not be empty", step.Name)
+		}
+
+		steps[step.Name] = step
+	}
+
+	for _, step := range w.Steps {
+		dependencies := make(map[string]bool, len(step.DependsOn))
+		for _, dep := range step.DependsOn {
+			if steps[dep] == nil {
+				return fmt.Errorf("step %s depends on the unknown step %s", step.Name, dep)
+			}
+			dependencies[dep] = true
+		}
+
+		if step.Condition != nil && !dependencies[step.Condition.Step] {
+			return fmt.Errorf("the condition of step %s refers to %q, which is no dependency", step.Name, step.Condition.Step)
+		}
+
+		if err := step.validateRefs(dependencies); err != nil {
+			return err
+		}
+	}
+
+	return w.checkCycles(steps)
+}
+
+// validateRefs checks the placeholders within the vars of the step, results may only be referred
+// to if their step is a dependency, as the results of other steps are not known when it starts
+func (s *WorkflowStep) validateRefs(dependencies map[string]bool) error {
+	for key, value := range s.Vars {
+		for _, m := range workflowVarPlaceholder.FindAllStringSubmatch(value, -1) {
+			ref := m[1]
+			if strings.HasPrefix(ref, "params.") {
+				continue
+			}
+
+			r := workflowResultRef.FindStringSubmatch(ref)
+			if r == nil {
+				return fmt.Errorf("var %s of step %s has the invalid reference %q", key, s.Name, ref)
+			}
+
+			if !dependencies[r[1]] {
+				return fmt.Errorf("var %s of step %s refers to the results of %q, which is no dependency", key, s.Name, r[1])
+			}
+		}
+	}
+
+	return nil
+}
+
+func (w *Workflow) checkCycles(steps map[string]*WorkflowStep) error {
+	const (
+		visiting = 1
+		visited  = 2
+	)
+
+	state := make(map[string]int, len(steps))
+
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case visiting:
+			return fmt.Errorf("the steps contain a cycle at step %s", name)
+		case visited:
+			return nil
+		}
+
+		state[name] = visiting
+		for _, dep := range steps[name].DependsOn {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		state[name] = visited
+
+		return nil
+	}
+
+	for _, step := range w.Steps {
+		if err := visit(step.Name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// NewRun creates a new run of the workflow with all steps pending. Missing params are set to
+// their defaults, required params must be given.
+func (w *Workflow) NewRun(uuid string, params map[string]string, now time.Time) (*WorkflowRun, error) {
+	runParams, err := ApplyParams(w.Params, params)
+	if err != nil {
+		return nil, err
+	}
+
+	run := &WorkflowRun{
+		UUID:      uuid,
+		Workflow:  w.Name,
+		Version:   w.Version,
+		Params:    runParams,
+		Status:    WorkflowRunStatusRunning,
+		Steps:     make([]WorkflowRunStep, len(w.Steps)),
+		CreatedAt: JSONTime{Time: now},
+	}
+
+	for i, step := range w.Steps {
+		run.Steps[i] = WorkflowRunStep{Name: step.Name, Status: WorkflowStepStatusPending}
+	}
+
+	return run, nil
+}
+
+// NewJob creates a new job from the template of the step with the given, already resolved vars
+func (s *WorkflowStep) NewJob(uuid string, runID string, vars map[string]string, createdAt JSONTime) *Job {
+	job := NewJob()
+	job.UUID = uuid
+	job.Status = JobStatusCreated
+	job.CreatedAt = createdAt
+	job.Code = s.Code
+	job.Vars = vars
+	job.Priority = s.Priority
+	job.Timeout = s.Timeout
+	job.MaxRetries = s.MaxRetries
+	job.Backoff = s.Backoff
+	job.WorkflowRunID = runID
+
+	for k, v := range s.Modules {
+		job.Modules[k] = v
+	}
+
+	return job
+}
+
+// ResolveVars replaces the placeholders within the vars of the step with the given params and
+// results of the previous steps
+func (s *WorkflowStep) ResolveVars(params map[string]string, results map[string]map[string]interface{}) (map[string]string, error) {
+	vars := make(map[string]string, len(s.Vars))
+	for key, value := range s.Vars {
+		var err error
+		vars[key] = workflowVarPlaceholder.ReplaceAllStringFunc(value, func(placeholder string) string {
+			ref := workflowVarPlaceholder.FindStringSubmatch(placeholder)[1]
+			resolved, rerr := resolveWorkflowRef(ref, params, results)
+			if rerr != nil && err == nil {
+				err = fmt.Errorf("var %s: %v", key, rerr)
+			}
+			return resolved
+		})
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return vars, nil
+}
+
+func resolveWorkflowRef(ref string, params map[string]string, results map[string]map[string]interface{}) (string, error) {
+	if strings.HasPrefix(ref, "params.") {
+		name := strings.TrimPrefix(ref, "params.")
+		value, ok := params[name]
+		if !ok {
+			return "", fmt.Errorf("unknown param %s", name)
+		}
+		return value, nil
+	}
+
+	if m := workflowResultRef.FindStringSubmatch(ref); m != nil {
+		step, key := m[1], m[2]
+		stepResults, ok := results[step]
+		if !ok {
+			return "", fmt.Errorf("step %s has no results", step)
+		}
+
+		value, ok := stepResults[key]
+		if !ok {
+			return "", fmt.Errorf("step %s has no result %s", step, key)
+		}
+		return resultString(value), nil
+	}
+
+	return "", fmt.Errorf("invalid reference %q", ref)
+}
+
+// Matches returns true when the result of the condition has the expected value
+func (c *WorkflowCondition) Matches(results map[string]interface{}) bool {
+	value, ok := results[c.Result]
+	if !ok {
+		return false
+	}
+
+	return resultString(value) == c.Equals
+}
+
+func resultString(value interface{}) string {
+	if str, ok := value.(string); ok {
+		return str
+	}
+
+	b, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+
+	return string(b)
+}
+
+// A WorkflowRun is a single execution of a workflow version
+type WorkflowRun struct {
+	UUID       string            `json:"uuid"`
+	Rev        string            `json:"_rev,omitempty"`
+	Workflow   string            `json:"workflow"`
+	Version    int               `json:"version"`
+	Params     map[string]string `json:"params"`
+	Status     string            `json:"status"`
+	Error      string            `json:"error"`
+	Steps      []WorkflowRunStep `json:"steps"`
+	CreatedAt  JSONTime          `json:"created_at"`
+	FinishedAt *JSONTime         `json:"finished_at"`
+}
+
+// A WorkflowRunStep shows the job of a step within a workflow run
+type WorkflowRunStep struct {
+	Name    string `json:"name"`
+	JobUUID string `json:"job_uuid"`
+	Status  string `json:"status"`
+}
+
+// Step returns the run step with the given name or nil if it does not exist
+func (r *WorkflowRun) Step(name string) *WorkflowRunStep {
+	for i := range r.Steps {
+		if r.Steps[i].Name == name {
+			return &r.Steps[i]
+		}
+	}
+
+	return nil
+}
+
+// IsFinished returns true when the run has reached a final status
+func (r *WorkflowRun) IsFinished() bool {
+	return r.Status != WorkflowRunStatusRunning
+}
+
+// WorkflowRunRequest is the body used to start a new workflow run, the latest version of the
+// workflow is used when no version is given
+type WorkflowRunRequest struct {
+	Version int               `json:"version"`
+	Params  map[string]string `json:"params"`
+}
+
+// WorkflowResponse is the wrapper around a workflow when returned through API
+type WorkflowResponse struct {
+	Data *Workflow `json:"data"`
+}
+
+// WorkflowsResponse is the wrapper around a list of workflows when returned through API
+type WorkflowsResponse struct {
+	Data []*Workflow `json:"data"`
+}
+
+// WorkflowRunResponse is the wrapper around a workflow run when returned through API
+type WorkflowRunResponse struct {
+	Data *WorkflowRun `json:"data"`
+}
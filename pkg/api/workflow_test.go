@@ -0,0 +1,115 @@
+package api
+
+import (
+	"testing"
+	"time"
+)
+
+func newTestWorkflow() *Workflow {
+	return &Workflow{
+		VersionMeta: VersionMeta{Name: "login-and-scrape", Version: 1},
+		Params: []Param{
+			{Name: "user", Required: true},
+			{Name: "page", Default: "1"},
+		},
+		Steps: []WorkflowStep{
+			{Name: "login", Code: "login", Vars: map[string]string{"user": "{{ params.user }}"}},
+			{
+				Name:      "scrape",
+				Code:      "scrape",
+				DependsOn: []string{"login"},
+				Vars:      map[string]string{"cookies": "{{steps.login.results.cookies}}", "url": "/page/{{params.page}}"},
+				Condition: &WorkflowCondition{Step: "login", Result: "success", Equals: "true"},
+			},
+		},
+	}
+}
+
+func TestWorkflow_Validate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(w *Workflow)
+		valid  bool
+	}{
+		{"valid", func(w *Workflow) {}, true},
+		{"invalid name", func(w *Workflow) { w.Name = "Login And Scrape" }, false},
+		{"no steps", func(w *Workflow) { w.Steps = nil }, false},
+		{"duplicate step", func(w *Workflow) { w.Steps[1].Name = "login" }, false},
+		{"empty code", func(w *Workflow) { w.Steps[0].Code = "" }, false},
+		{"unknown dependency", func(w *Workflow) { w.Steps[1].DependsOn = []string{"unknown"} }, false},
+		{"condition without dependency", func(w *Workflow) { w.Steps[1].Condition.Step = "scrape" }, false},
+		{"result of no dependency", func(w *Workflow) { w.Steps[0].Vars["page"] = "{{steps.scrape.results.page}}" }, false},
+		{"invalid reference", func(w *Workflow) { w.Steps[1].Vars["url"] = "{{login.cookies}}" }, false},
+		{"cycle", func(w *Workflow) { w.Steps[0].DependsOn = []string{"scrape"} }, false},
+		{"duplicate param", func(w *Workflow) { w.Params[1].Name = "user" }, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := newTestWorkflow()
+			test.modify(w)
+
+			if err := w.Validate(); (err == nil) != test.valid {
+				t.Errorf("Expected valid=%v, got error %v", test.valid, err)
+			}
+		})
+	}
+}
+
+func TestWorkflow_NewRun(t *testing.T) {
+	w := newTestWorkflow()
+
+	if _, err := w.NewRun("1234", map[string]string{}, time.Now()); err == nil {
+		t.Errorf("Expected missing required param to fail")
+	}
+
+	if _, err := w.NewRun("1234", map[string]string{"user": "a", "unknown": "b"}, time.Now()); err == nil {
+		t.Errorf("Expected unknown param to fail")
+	}
+
+	run, err := w.NewRun("1234", map[string]string{"user": "a"}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if run.Params["page"] != "1" || run.Status != WorkflowRunStatusRunning || len(run.Steps) != 2 {
+		t.Errorf("Unexpected run: %+v", run)
+	}
+
+	if run.Step("scrape").Status != WorkflowStepStatusPending {
+		t.Errorf("Expected step to be pending, got %s", run.Step("scrape").Status)
+	}
+}
+
+func TestWorkflowStep_ResolveVars(t *testing.T) {
+	step := newTestWorkflow().Step("scrape")
+	params := map[string]string{"user": "a", "page": "2"}
+	results := map[string]map[string]interface{}{
+		"login": {"cookies": []interface{}{"session=1"}},
+	}
+
+	vars, err := step.ResolveVars(params, results)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if vars["cookies"] != `["session=1"]` || vars["url"] != "/page/2" {
+		t.Errorf("Unexpected vars: %v", vars)
+	}
+
+	if _, err := step.ResolveVars(params, map[string]map[string]interface{}{}); err == nil {
+		t.Errorf("Expected missing results to fail")
+	}
+}
+
+func TestWorkflowCondition_Matches(t *testing.T) {
+	c := &WorkflowCondition{Step: "login", Result: "success", Equals: "true"}
+
+	if !c.Matches(map[string]interface{}{"success": true}) {
+		t.Errorf("Expected condition to match")
+	}
+
+	if c.Matches(map[string]interface{}{"success": false}) || c.Matches(nil) {
+		t.Errorf("Expected condition not to match")
+	}
+}
@@ -0,0 +1,82 @@
+package artifact
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// FileStore keeps artifacts on the local filesystem, within a directory per job
+type FileStore struct {
+	dir string
+}
+
+// NewFileStore returns a new FileStore keeping the artifacts below the given directory, which is
+// created if missing
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, err
+	}
+
+	return &FileStore{dir: dir}, nil
+}
+
+// Put writes the artifact to a temporary file first, so readers never see a partially written artifact
+func (s *FileStore) Put(jobID, name, contentType string, data []byte) error {
+	if err := checkKey(jobID, name); err != nil {
+		return err
+	}
+
+	dir := filepath.Join(s.dir, jobID)
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(dir, "."+name+".*")
+	if err != nil {
+		return err
+	}
+
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), filepath.Join(dir, name))
+}
+
+// Get opens the file of the artifact
+func (s *FileStore) Get(jobID, name string) (io.ReadCloser, error) {
+	if err := checkKey(jobID, name); err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(filepath.Join(s.dir, jobID, name))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+
+	return f, err
+}
+
+// Delete removes the file of the artifact, along with the directory of the job once it is empty
+func (s *FileStore) Delete(jobID, name string) error {
+	if err := checkKey(jobID, name); err != nil {
+		return err
+	}
+
+	dir := filepath.Join(s.dir, jobID)
+	if err := os.Remove(filepath.Join(dir, name)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	// fails as long as other artifacts of the job are left
+	_ = os.Remove(dir)
+	return nil
+}
@@ -0,0 +1,67 @@
+package artifact
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testStore puts, reads and deletes an artifact of the given store
+func testStore(t *testing.T, store Store) {
+	if err := store.Put("asdf-1234", "screenshot.png", "image/png", []byte("png")); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := store.Get("asdf-1234", "screenshot.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if string(data) != "png" {
+		t.Errorf("Unexpected artifact content: %q", data)
+	}
+
+	if err := store.Delete("asdf-1234", "screenshot.png"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.Get("asdf-1234", "screenshot.png"); err != ErrNotFound {
+		t.Errorf("Expected deleted artifact to be not found, got %v", err)
+	}
+
+	if err := store.Put("../asdf-1234", "screenshot.png", "image/png", []byte("png")); err == nil {
+		t.Errorf("Expected job id with path to be invalid")
+	}
+
+	if err := store.Put("asdf-1234", "..", "image/png", []byte("png")); err == nil {
+		t.Errorf("Expected artifact name .. to be invalid")
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "artifacts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store, err := NewFileStore(filepath.Join(dir, "store"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testStore(t, store)
+
+	if _, err := os.Stat(filepath.Join(dir, "store", "asdf-1234")); !os.IsNotExist(err) {
+		t.Errorf("Expected the empty job directory to be removed, got %v", err)
+	}
+}
@@ -0,0 +1,213 @@
+package artifact
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	s3Algorithm  = "AWS4-HMAC-SHA256"
+	s3TimeFormat = "20060102T150405Z"
+	s3DateFormat = "20060102"
+)
+
+// S3Config configures the bucket of a S3Store. The endpoint is the url of any S3 compatible
+// server, like https://s3.eu-central-1.amazonaws.com or a minio server.
+type S3Config struct {
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+}
+
+// S3Store keeps artifacts as objects of a bucket on a S3 compatible server, below a prefix per
+// job. The objects are addressed path style and the requests are signed with signature version 4.
+type S3Store struct {
+	cfg      S3Config
+	endpoint *url.URL
+	client   *http.Client
+}
+
+// NewS3Store returns a new S3Store for the configured bucket, requests time out after the given duration
+func NewS3Store(cfg S3Config, timeout time.Duration) (*S3Store, error) {
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid s3 endpoint: %v", err)
+	}
+
+	if endpoint.Scheme != "http" && endpoint.Scheme != "https" || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid s3 endpoint: must be an absolute http or https url, got %q", cfg.Endpoint)
+	}
+
+	if cfg.Bucket == "" || cfg.Region == "" {
+		return nil, fmt.Errorf("the s3 bucket and region must not be empty")
+	}
+
+	return &S3Store{
+		cfg:      cfg,
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: timeout},
+	}, nil
+}
+
+// Put uploads the artifact as object
+func (s *S3Store) Put(jobID, name, contentType string, data []byte) error {
+	if err := checkKey(jobID, name); err != nil {
+		return err
+	}
+
+	req, err := s.newRequest(http.MethodPut, jobID, name, data)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := s.do(req, data)
+	if err != nil {
+		return err
+	}
+
+	return resp.Body.Close()
+}
+
+// Get downloads the object of the artifact
+func (s *S3Store) Get(jobID, name string) (io.ReadCloser, error) {
+	if err := checkKey(jobID, name); err != nil {
+		return nil, err
+	}
+
+	req, err := s.newRequest(http.MethodGet, jobID, name, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.do(req, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Body, nil
+}
+
+// Delete removes the object of the artifact
+func (s *S3Store) Delete(jobID, name string) error {
+	if err := checkKey(jobID, name); err != nil {
+		return err
+	}
+
+	req, err := s.newRequest(http.MethodDelete, jobID, name, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.do(req, nil)
+	if err == ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return resp.Body.Close()
+}
+
+func (s *S3Store) newRequest(method, jobID, name string, data []byte) (*http.Request, error) {
+	u := *s.endpoint
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + s.cfg.Bucket + "/" + jobID + "/" + name
+
+	return http.NewRequest(method, u.String(), bytes.NewReader(data))
+}
+
+// do signs and sends the request, error responses are returned as error
+func (s *S3Store) do(req *http.Request, data []byte) (*http.Response, error) {
+	s.sign(req, data, time.Now())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 300 {
+		return resp, nil
+	}
+
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<10))
+	if err := resp.Body.Close(); err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+
+	return nil, fmt.Errorf("s3 %s %s failed with %s: %s", req.Method, req.URL.Path, resp.Status, body)
+}
+
+// sign adds the signature version 4 authorization to the request, which covers the host and all
+// headers that are set on the request
+func (s *S3Store) sign(req *http.Request, payload []byte, now time.Time) {
+	now = now.UTC()
+	payloadHash := sha256Hex(payload)
+	req.Header.Set("X-Amz-Date", now.Format(s3TimeFormat))
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.Query().Encode(),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := strings.Join([]string{now.Format(s3DateFormat), s.cfg.Region, "s3", "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{s3Algorithm, now.Format(s3TimeFormat), scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+
+	key := []byte("AWS4" + s.cfg.SecretKey)
+	for _, part := range []string{now.Format(s3DateFormat), s.cfg.Region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3Algorithm, s.cfg.AccessKey, scope, signedHeaders, signature))
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data)) // nolint: errcheck
+	return h.Sum(nil)
+}
@@ -0,0 +1,33 @@
+// Package artifact keeps the artifacts of jobs, like screenshots and large results, outside of
+// the job database.
+package artifact
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/scalify/puppet-master-gateway/pkg/api"
+)
+
+// ErrNotFound is returned when reading an artifact that doesn't exist
+var ErrNotFound = errors.New("artifact not found")
+
+// A Store keeps the content of the artifacts of jobs, identified by the job id and the artifact name
+type Store interface {
+	// Put stores the content of the artifact, replacing an existing one with the same name
+	Put(jobID, name, contentType string, data []byte) error
+	// Get opens the content of the artifact, it returns ErrNotFound if there is none
+	Get(jobID, name string) (io.ReadCloser, error)
+	// Delete removes the artifact, deleting an artifact that doesn't exist is no error
+	Delete(jobID, name string) error
+}
+
+// checkKey validates the job id and the artifact name, as both are used within file paths and urls
+func checkKey(jobID, name string) error {
+	if err := api.ValidateArtifactName(jobID); err != nil {
+		return fmt.Errorf("invalid job id %q", jobID)
+	}
+
+	return api.ValidateArtifactName(name)
+}
@@ -0,0 +1,72 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/rhinoman/couchdb-go"
+)
+
+var rawMessageType = reflect.TypeOf(json.RawMessage{})
+
+// bulkDocument converts the document into a flat struct with one field per json key. The couchdb
+// client uses the raw json struct tags as keys of bulk documents, which would keep tag options
+// like omitempty in the key names.
+func bulkDocument(doc interface{}) (interface{}, error) {
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal(b, &values); err != nil {
+		return nil, err
+	}
+
+	// both are set by the bulk document itself
+	delete(values, "_id")
+	delete(values, "_rev")
+
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	fields := make([]reflect.StructField, len(keys))
+	for i, k := range keys {
+		fields[i] = reflect.StructField{
+			Name: fmt.Sprintf("F%d", i),
+			Type: rawMessageType,
+			Tag:  reflect.StructTag(fmt.Sprintf("json:%q", k)),
+		}
+	}
+
+	v := reflect.New(reflect.StructOf(fields)).Elem()
+	for i, k := range keys {
+		v.Field(i).Set(reflect.ValueOf(values[k]))
+	}
+
+	return v.Addr().Interface(), nil
+}
+
+// bulkResultError converts the error of a single bulk document result
+func bulkResultError(result couchdb.BulkDocumentResult) error {
+	if result.Error == nil {
+		return nil
+	}
+
+	switch *result.Error {
+	case "conflict":
+		return ErrConflict
+	}
+
+	if result.Reason != nil {
+		return fmt.Errorf("%s: %s", *result.Error, *result.Reason)
+	}
+
+	return errors.New(*result.Error)
+}
@@ -2,7 +2,18 @@ package database
 
 import "errors"
 
+// database names
+const (
+	DBNameJobs         = "jobs"
+	DBNameSchedules    = "schedules"
+	DBNameWorkflows    = "workflows"
+	DBNameWorkflowRuns = "workflow_runs"
+	DBNameTemplates    = "templates"
+	DBNameModules      = "modules"
+)
+
 // database error constants
 var (
 	ErrNotFound = errors.New("document not found")
+	ErrConflict = errors.New("document update conflict")
 )
@@ -0,0 +1,22 @@
+package database
+
+import (
+	"github.com/rhinoman/couchdb-go"
+)
+
+func checkKnownErrors(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if couchErr, ok := err.(*couchdb.Error); ok {
+		switch couchErr.StatusCode {
+		case 404:
+			return ErrNotFound
+		case 409:
+			return ErrConflict
+		}
+	}
+
+	return err
+}
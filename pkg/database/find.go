@@ -0,0 +1,134 @@
+package database
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/rhinoman/couchdb-go"
+)
+
+// findQuery is a mango query. Unlike the query params of the couchdb client it supports the
+// bookmark of a previous page. Fields limits the found documents to the given fields.
+type findQuery struct {
+	Selector interface{} `json:"selector"`
+	Fields   []string    `json:"fields,omitempty"`
+	Limit    int         `json:"limit,omitempty"`
+	Skip     int         `json:"skip,omitempty"`
+	Sort     interface{} `json:"sort,omitempty"`
+	UseIndex []string    `json:"use_index,omitempty"`
+	Bookmark string      `json:"bookmark,omitempty"`
+}
+
+type findResponse struct {
+	Docs     json.RawMessage `json:"docs"`
+	Bookmark string          `json:"bookmark"`
+}
+
+// A Finder sends mango queries to the _find endpoint of a database. The couchdb client can't pass
+// bookmarks, which continue a query where its previous page ended.
+type Finder struct {
+	client *http.Client
+	url    string
+	auth   couchdb.Auth
+}
+
+// NewFinder returns a new Finder for the database with the given name on the couchdb server
+// reachable at serverURL
+func NewFinder(serverURL, dbName string, auth couchdb.Auth, timeout time.Duration) *Finder {
+	return &Finder{
+		client: &http.Client{Timeout: timeout},
+		url:    fmt.Sprintf("%s/%s/_find", serverURL, url.PathEscape(dbName)),
+		auth:   auth,
+	}
+}
+
+// find runs the query and decodes the found documents into docs, it returns the bookmark of the
+// next page.
+func (f *Finder) find(query *findQuery, docs interface{}) (string, error) {
+	body, err := json.Marshal(query)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, f.url, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if f.auth != nil {
+		f.auth.AddAuthHeaders(req)
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		couchErr := &couchdb.Error{StatusCode: resp.StatusCode, URL: f.url, Method: http.MethodPost}
+		var reply struct{ Error, Reason string }
+		if err := json.NewDecoder(resp.Body).Decode(&reply); err == nil {
+			couchErr.ErrorCode = reply.Error
+			couchErr.Reason = reply.Reason
+		}
+		return "", couchErr
+	}
+
+	result := &findResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return "", err
+	}
+
+	if err := json.Unmarshal(result.Docs, docs); err != nil {
+		return "", err
+	}
+
+	return result.Bookmark, nil
+}
+
+type countResult struct {
+	Rows []struct {
+		Value int `json:"value"`
+	} `json:"rows"`
+}
+
+// countBy counts the documents within the view of the index, optionally limited to keys that
+// start with the given prefix. The views of all indexes reduce with _count.
+func countBy(db *couchdb.Database, index Index, prefix ...interface{}) (int, error) {
+	params := url.Values{}
+	params.Set("reduce", "true")
+
+	if len(prefix) > 0 {
+		start, err := json.Marshal(prefix)
+		if err != nil {
+			return 0, err
+		}
+
+		// an empty object sorts after all other values within the view
+		end, err := json.Marshal(append(append([]interface{}{}, prefix...), map[string]interface{}{}))
+		if err != nil {
+			return 0, err
+		}
+
+		params.Set("start_key", string(start))
+		params.Set("end_key", string(end))
+	}
+
+	result := &countResult{}
+	if err := db.GetView(index.Name, index.Name, result, &params); err != nil {
+		return 0, checkKnownErrors(err)
+	}
+
+	if len(result.Rows) == 0 {
+		return 0, nil
+	}
+
+	return result.Rows[0].Value, nil
+}
@@ -0,0 +1,194 @@
+package database
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/rhinoman/couchdb-go"
+)
+
+// An Index is a mango json index stored in its own design document
+type Index struct {
+	Name   string
+	Fields []string
+}
+
+type indexDesignDoc struct {
+	Language string                   `json:"language"`
+	Views    map[string]indexViewSpec `json:"views"`
+}
+
+type indexViewSpec struct {
+	Map     indexMapSpec     `json:"map"`
+	Reduce  string           `json:"reduce"`
+	Options indexViewOptions `json:"options"`
+}
+
+type indexMapSpec struct {
+	Fields                indexFields            `json:"fields"`
+	PartialFilterSelector map[string]interface{} `json:"partial_filter_selector"`
+}
+
+// indexFields are the fields of an index map, encoded as json object of the fields and their
+// direction. Mango takes the column order of the index from this object, so it has to keep the
+// order of the fields, which a go map doesn't.
+type indexFields []string
+
+func (f indexFields) MarshalJSON() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	buf.WriteByte('{')
+	for i, field := range f {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+
+		name, err := json.Marshal(field)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(name)
+		buf.WriteString(`:"asc"`)
+	}
+	buf.WriteByte('}')
+
+	return buf.Bytes(), nil
+}
+
+func (f *indexFields) UnmarshalJSON(b []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	if t, err := dec.Token(); err != nil || t != json.Delim('{') {
+		return fmt.Errorf("index fields must be an object, got %s", b)
+	}
+
+	*f = indexFields{}
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return err
+		}
+
+		var direction string
+		if err := dec.Decode(&direction); err != nil {
+			return err
+		}
+
+		*f = append(*f, t.(string))
+	}
+
+	return nil
+}
+
+type indexViewOptions struct {
+	Def indexDefinition `json:"def"`
+}
+
+type indexDefinition struct {
+	Fields []string `json:"fields"`
+}
+
+func (i Index) designDoc() *indexDesignDoc {
+	return &indexDesignDoc{
+		Language: "query",
+		Views: map[string]indexViewSpec{
+			i.Name: {
+				Map: indexMapSpec{
+					Fields:                indexFields(i.Fields),
+					PartialFilterSelector: map[string]interface{}{},
+				},
+				Reduce:  "_count",
+				Options: indexViewOptions{Def: indexDefinition{Fields: i.Fields}},
+			},
+		},
+	}
+}
+
+// matches returns true if the design document defines the index with the same fields. The fields
+// of the map are compared as well, design documents written with a wrong column order don't match.
+func (i Index) matches(doc *indexDesignDoc) bool {
+	view, ok := doc.Views[i.Name]
+	return ok && reflect.DeepEqual(view.Options.Def.Fields, i.Fields) && reflect.DeepEqual([]string(view.Map.Fields), i.Fields)
+}
+
+// sortIndex returns the index with exactly the fields of the sort, in the same order
+func sortIndex(indexes []Index, sort []interface{}) (Index, bool) {
+	fields := make([]string, 0, len(sort))
+	for _, s := range sort {
+		m, ok := s.(map[string]string)
+		if !ok || len(m) != 1 {
+			return Index{}, false
+		}
+
+		for field := range m {
+			fields = append(fields, field)
+		}
+	}
+
+	for _, index := range indexes {
+		if reflect.DeepEqual(index.Fields, fields) {
+			return index, true
+		}
+	}
+
+	return Index{}, false
+}
+
+// IndexChanges lists the names of the indexes changed while ensuring the indexes of a database
+type IndexChanges struct {
+	Created []string
+	Updated []string
+	Dropped []string
+}
+
+// readIndex reads the design document of the named index, it returns ErrNotFound if there is none
+func readIndex(db *couchdb.Database, name string) (*indexDesignDoc, string, error) {
+	doc := &indexDesignDoc{}
+	rev, err := db.Read("_design/"+name, doc, nil)
+	if err != nil {
+		return nil, "", checkKnownErrors(err)
+	}
+
+	return doc, rev, nil
+}
+
+// ensureIndexes creates all given indexes that don't exist yet and updates the ones whose fields
+// or column order have changed. The obsolete indexes, which have been replaced or aren't used anymore, are dropped.
+func ensureIndexes(db *couchdb.Database, indexes []Index, obsolete []string) (*IndexChanges, error) {
+	changes := &IndexChanges{}
+
+	for _, index := range indexes {
+		existing, rev, err := readIndex(db, index.Name)
+		switch {
+		case err == ErrNotFound:
+			changes.Created = append(changes.Created, index.Name)
+		case err != nil:
+			return changes, err
+		case index.matches(existing):
+			continue
+		default:
+			changes.Updated = append(changes.Updated, index.Name)
+		}
+
+		if _, err := db.SaveDesignDoc(index.Name, index.designDoc(), rev); err != nil {
+			return changes, err
+		}
+	}
+
+	for _, name := range obsolete {
+		_, rev, err := readIndex(db, name)
+		if err == ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return changes, err
+		}
+
+		if _, err := db.Delete("_design/"+name, rev); err != nil {
+			return changes, checkKnownErrors(err)
+		}
+		changes.Dropped = append(changes.Dropped, name)
+	}
+
+	return changes, nil
+}
@@ -0,0 +1,72 @@
+package database
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestIndexDesignDocFieldOrder(t *testing.T) {
+	index := Index{Name: "status-priority", Fields: []string{"status", "priority"}}
+
+	b, err := json.Marshal(index.designDoc())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(b), `"map":{"fields":{"status":"asc","priority":"asc"}`) {
+		t.Errorf("Expected the map fields in the order of the index, got %s", b)
+	}
+
+	doc := &indexDesignDoc{}
+	if err := json.Unmarshal(b, doc); err != nil {
+		t.Fatal(err)
+	}
+
+	if fields := doc.Views[index.Name].Map.Fields; !reflect.DeepEqual([]string(fields), index.Fields) {
+		t.Errorf("Expected decoded map fields %v, got %v", index.Fields, fields)
+	}
+}
+
+func TestIndexMatches(t *testing.T) {
+	index := Index{Name: "status-priority", Fields: []string{"status", "priority"}}
+
+	if !index.matches(index.designDoc()) {
+		t.Errorf("Expected index to match its own design doc")
+	}
+
+	misordered := index.designDoc()
+	view := misordered.Views[index.Name]
+	view.Map.Fields = indexFields{"priority", "status"}
+	misordered.Views[index.Name] = view
+
+	if index.matches(misordered) {
+		t.Errorf("Expected index not to match a design doc with a different column order")
+	}
+
+	renamed := Index{Name: "status", Fields: index.Fields}
+	if renamed.matches(index.designDoc()) {
+		t.Errorf("Expected index not to match the design doc of another index")
+	}
+}
+
+func TestJobDBIndexLabels(t *testing.T) {
+	db := NewJobDB(nil, nil)
+	if err := db.IndexLabels([]string{"customer", "env"}); err != nil {
+		t.Fatal(err)
+	}
+
+	indexes := db.indexes()
+	if len(indexes) != len(jobIndexes)+2 {
+		t.Fatalf("Unexpected count of indexes: %d", len(indexes))
+	}
+
+	if index := indexes[len(indexes)-1]; index.Name != "labels.env" || !reflect.DeepEqual(index.Fields, []string{"labels.env"}) {
+		t.Errorf("Unexpected label index: %+v", index)
+	}
+
+	if err := db.IndexLabels([]string{"no spaces"}); err == nil {
+		t.Errorf("Expected invalid label key to be rejected")
+	}
+}
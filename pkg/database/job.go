@@ -1,6 +1,9 @@
 package database
 
 import (
+	"fmt"
+	"time"
+
 	"github.com/rhinoman/couchdb-go"
 	"github.com/satori/go.uuid"
 
@@ -9,61 +12,283 @@ import (
 
 // JobDB talks to a couchDB server and handles Job instances
 type JobDB struct {
-	db *couchdb.Database
+	db           *couchdb.Database
+	finder       *Finder
+	labelIndexes []Index
 }
 
-// NewJobDB returns a new JobDB instance
-func NewJobDB(db *couchdb.Database) *JobDB {
+// the mango indexes required by the job queries, their views are used to count the jobs as well.
+// Every sortable field has an index of its own, created_at is sortable within a status as well.
+// The pending callbacks are polled every second, so they have an index as well.
+var (
+	jobIndexStatus         = Index{Name: "status", Fields: []string{"status"}}
+	jobIndexStatusPriority = Index{Name: "status-priority", Fields: []string{"status", "priority"}}
+	jobIndexBatchIDStatus  = Index{Name: "batch_id-status", Fields: []string{"batch_id", "status"}}
+	jobIndexCreatedAt      = Index{Name: "created_at", Fields: []string{"created_at"}}
+
+	jobIndexes = []Index{
+		jobIndexStatus,
+		jobIndexStatusPriority,
+		{Name: "status-created_at", Fields: []string{"status", "created_at"}},
+		jobIndexBatchIDStatus,
+		jobIndexCreatedAt,
+		{Name: "started_at", Fields: []string{"started_at"}},
+		{Name: "finished_at", Fields: []string{"finished_at"}},
+		{Name: "duration", Fields: []string{"duration"}},
+		{Name: "priority", Fields: []string{"priority"}},
+		{Name: "callback.status-callback.next_attempt_at", Fields: []string{"callback.status", "callback.next_attempt_at"}},
+	}
+
+	// obsoleteJobIndexes have been replaced by other indexes
+	obsoleteJobIndexes = []string{"batch_id"}
+)
+
+// NewJobDB returns a new JobDB instance, the finder runs the queries of paginated job lists
+func NewJobDB(db *couchdb.Database, finder *Finder) *JobDB {
 	return &JobDB{
-		db: db,
+		db:     db,
+		finder: finder,
 	}
 }
 
+// IndexLabels adds an index per label key to the indexes ensured by EnsureIndexes, so jobs
+// filtered by one of these labels are found without scanning all jobs. The index of a key that is
+// not given anymore is kept, it has to be dropped manually.
+func (db *JobDB) IndexLabels(keys []string) error {
+	for _, key := range keys {
+		if err := api.ValidateLabel(key, ""); err != nil {
+			return fmt.Errorf("invalid label %q: %v", key, err)
+		}
+
+		field := "labels." + key
+		db.labelIndexes = append(db.labelIndexes, Index{Name: field, Fields: []string{field}})
+	}
+
+	return nil
+}
+
+func (db *JobDB) indexes() []Index {
+	indexes := make([]Index, 0, len(jobIndexes)+len(db.labelIndexes))
+	return append(append(indexes, jobIndexes...), db.labelIndexes...)
+}
+
+// EnsureIndexes creates or updates the indexes required by the job queries, including the label
+// indexes, and drops the obsolete ones
+func (db *JobDB) EnsureIndexes() (*IndexChanges, error) {
+	return ensureIndexes(db.db, db.indexes(), obsoleteJobIndexes)
+}
+
 // Get fetches a job from database, identified by given UUID
 func (db *JobDB) Get(id string) (*api.Job, error) {
 	job := api.NewJob()
 	rev, err := db.db.Read(id, job, nil)
 	if err != nil {
-		return nil, db.checkKnownErrors(err)
+		return nil, checkKnownErrors(err)
 	}
 
 	job.Rev = rev
 	return job, nil
 }
 
-type jobList struct {
-	Docs []*api.Job `json:"docs"`
-}
-
-func (db *JobDB) getListBy(selector map[string]interface{}, page, perPage int) ([]*api.Job, error) {
-	result := &jobList{}
-	query := &couchdb.FindQueryParams{
+// getListBy returns the jobs matching the selector and the bookmark of the next page. A given
+// bookmark continues the query of a previous page instead of skipping the jobs of former pages.
+// Queries sorted by exactly the fields of an index are bound to that index. Given fields limit
+// the jobs to these fields, the others are left at their zero values.
+func (db *JobDB) getListBy(selector map[string]interface{}, sort []interface{}, fields []string, page, perPage int, bookmark string) ([]*api.Job, string, error) {
+	query := &findQuery{
 		Selector: selector,
+		Fields:   fields,
 		Limit:    perPage,
-		Skip:     perPage * (page - 1),
+		Bookmark: bookmark,
+	}
+
+	if bookmark == "" {
+		query.Skip = perPage * (page - 1)
+	}
+
+	if len(sort) > 0 {
+		query.Sort = sort
+		if index, ok := sortIndex(jobIndexes, sort); ok {
+			query.UseIndex = []string{"_design/" + index.Name, index.Name}
+		}
+	}
+
+	jobs := make([]*api.Job, 0, perPage)
+	next, err := db.finder.find(query, &jobs)
+	if err != nil {
+		return nil, "", checkKnownErrors(err)
+	}
+
+	return jobs, next, nil
+}
+
+func (db *JobDB) getJobsBy(selector map[string]interface{}, sort []interface{}, page, perPage int) ([]*api.Job, error) {
+	jobs, _, err := db.getListBy(selector, sort, nil, page, perPage, "")
+	return jobs, err
+}
+
+// GetPage returns the page of jobs selected by the query. The total count of selected jobs is
+// only known for queries filtering by status and batch, as other filters can't be counted by an index.
+func (db *JobDB) GetPage(query *JobQuery) (*JobPage, error) {
+	selector := query.selector()
+	jobs, bookmark, err := db.getListBy(selector, query.sort(selector), query.Fields, query.Page, query.PerPage, query.Bookmark)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &JobPage{Jobs: jobs, Bookmark: bookmark}
+	if !query.countable() {
+		return result, nil
 	}
 
-	if err := db.db.Find(result, query); err != nil {
+	var total int
+	switch {
+	case query.BatchID != "" && query.Status != "":
+		total, err = countBy(db.db, jobIndexBatchIDStatus, query.BatchID, query.Status)
+	case query.BatchID != "":
+		total, err = countBy(db.db, jobIndexBatchIDStatus, query.BatchID)
+	case query.Status != "":
+		total, err = countBy(db.db, jobIndexStatus, query.Status)
+	default:
+		total, err = countBy(db.db, jobIndexCreatedAt)
+	}
+
+	if err != nil {
 		return nil, err
 	}
 
-	return result.Docs, nil
+	result.Total = &total
+	return result, nil
 }
 
-// GetListByStatus returns a paginated list of jobs with the given status
-func (db *JobDB) GetListByStatus(status string, page, perPage int) ([]*api.Job, error) {
+// GetListByStatus returns a paginated list of jobs with the given status, limited to the given
+// fields if there are any
+func (db *JobDB) GetListByStatus(status string, fields []string, page, perPage int) ([]*api.Job, error) {
 	selector := map[string]interface{}{
 		"status": map[string]interface{}{
 			"$eq": status,
 		},
 	}
 
-	return db.getListBy(selector, page, perPage)
+	jobs, _, err := db.getListBy(selector, nil, fields, page, perPage, "")
+	return jobs, err
+}
+
+// GetListByUUIDs returns the jobs with the given uuids that exist, limited to the given fields if
+// there are any. The jobs are looked up by the primary index.
+func (db *JobDB) GetListByUUIDs(ids []string, fields []string) ([]*api.Job, error) {
+	if len(ids) == 0 {
+		return []*api.Job{}, nil
+	}
+
+	selector := map[string]interface{}{
+		"_id": map[string]interface{}{
+			"$in": ids,
+		},
+	}
+
+	jobs, _, err := db.getListBy(selector, nil, fields, 1, len(ids), "")
+	return jobs, err
+}
+
+// GetListByBatchID returns a page of jobs of the given batch, optionally limited to the given
+// status and fields, along with the bookmark of the next page. The first page is returned for an
+// empty bookmark.
+func (db *JobDB) GetListByBatchID(batchID, status string, fields []string, bookmark string, perPage int) ([]*api.Job, string, error) {
+	selector := map[string]interface{}{
+		"batch_id": map[string]interface{}{
+			"$eq": batchID,
+		},
+	}
+
+	if status != "" {
+		selector["status"] = map[string]interface{}{
+			"$eq": status,
+		}
+	}
+
+	return db.getListBy(selector, nil, fields, 1, perPage, bookmark)
+}
+
+// GetDueListByStatus returns a paginated list of jobs with the given status that have
+// either no run_at timestamp or one that is not after now, highest priority first
+func (db *JobDB) GetDueListByStatus(status string, now time.Time, page, perPage int) ([]*api.Job, error) {
+	selector := map[string]interface{}{
+		"status": map[string]interface{}{
+			"$eq": status,
+		},
+		"priority": map[string]interface{}{
+			"$gte": 0,
+		},
+		"$or": []interface{}{
+			map[string]interface{}{"run_at": map[string]interface{}{"$exists": false}},
+			map[string]interface{}{"run_at": map[string]interface{}{"$eq": nil}},
+			map[string]interface{}{"run_at": map[string]interface{}{"$lte": api.JSONTime{Time: now}}},
+		},
+	}
+
+	sort := []interface{}{
+		map[string]string{"status": "desc"},
+		map[string]string{"priority": "desc"},
+	}
+
+	return db.getJobsBy(selector, sort, page, perPage)
+}
+
+// GetPendingCallbackList returns a paginated list of jobs with a pending callback delivery
+// which is due at now
+func (db *JobDB) GetPendingCallbackList(now time.Time, page, perPage int) ([]*api.Job, error) {
+	selector := map[string]interface{}{
+		"callback.status": map[string]interface{}{
+			"$eq": api.CallbackStatusPending,
+		},
+		"callback.next_attempt_at": map[string]interface{}{
+			"$lte": api.JSONTime{Time: now},
+		},
+	}
+
+	return db.getJobsBy(selector, nil, page, perPage)
+}
+
+// MigratePriorities sets the priority of all jobs written before jobs had a priority to zero, as
+// the indexes of the due jobs only contain jobs with a priority. It returns the count of migrated jobs.
+// Jobs with a conflict are skipped, they are read again as long as they have no priority.
+func (db *JobDB) MigratePriorities() (int, error) {
+	selector := map[string]interface{}{
+		"priority": map[string]interface{}{
+			"$exists": false,
+		},
+	}
+
+	migrated := 0
+	for {
+		// the saved jobs have a priority, so the next batch is found on the first page again
+		jobs, err := db.getJobsBy(selector, nil, 1, 100)
+		if err != nil || len(jobs) == 0 {
+			return migrated, err
+		}
+
+		errs, err := db.SaveMany(jobs)
+		if err != nil {
+			return migrated, err
+		}
+
+		for i, err := range errs {
+			switch err {
+			case nil:
+				migrated++
+			case ErrConflict:
+				// the job has been changed meanwhile, by another gateway migrating it as well
+			default:
+				return migrated, fmt.Errorf("failed to migrate job %s: %v", jobs[i].UUID, err)
+			}
+		}
+	}
 }
 
 // GetList returns a paginated list of jobs
 func (db *JobDB) GetList(page, perPage int) ([]*api.Job, error) {
-	return db.getListBy(map[string]interface{}{}, page, perPage)
+	return db.getJobsBy(map[string]interface{}{}, nil, page, perPage)
 }
 
 // Save writes the job to DB
@@ -74,29 +299,80 @@ func (db *JobDB) Save(job *api.Job) error {
 
 	rev, err := db.db.Save(job, job.UUID, job.Rev)
 	if err != nil {
-		return err
+		return checkKnownErrors(err)
 	}
 
 	job.Rev = rev
 	return nil
 }
 
-// Delete removes the job from the database
-func (db *JobDB) Delete(job *api.Job) error {
-	_, err := db.db.Delete(job.UUID, job.Rev)
-	return db.checkKnownErrors(err)
-}
+// SaveMany writes all jobs to DB within a single bulk request. The returned slice holds an error
+// for every job that could not be saved, at the index of the job.
+func (db *JobDB) SaveMany(jobs []*api.Job) ([]error, error) {
+	bulk := db.db.NewBulkDocument()
+	for _, job := range jobs {
+		if job.UUID == "" {
+			job.UUID = uuid.NewV4().String()
+		}
 
-func (db *JobDB) checkKnownErrors(err error) error {
-	if err == nil {
-		return nil
+		doc, err := bulkDocument(job)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := bulk.Save(doc, job.UUID, job.Rev); err != nil {
+			return nil, err
+		}
 	}
 
-	if couchErr, ok := err.(*couchdb.Error); ok {
-		if couchErr.StatusCode == 404 {
-			return ErrNotFound
+	results, err := bulk.Commit()
+	if err != nil {
+		return nil, checkKnownErrors(err)
+	}
+
+	if len(results) != len(jobs) {
+		return nil, fmt.Errorf("got %d bulk results for %d jobs", len(results), len(jobs))
+	}
+
+	errs := make([]error, len(jobs))
+	for i, result := range results {
+		if errs[i] = bulkResultError(result); errs[i] == nil {
+			jobs[i].Rev = result.Revision
 		}
 	}
 
-	return err
+	return errs, nil
+}
+
+// DeleteMany removes all jobs from the database within a single bulk request. The returned slice
+// holds an error for every job that could not be deleted, at the index of the job.
+func (db *JobDB) DeleteMany(jobs []*api.Job) ([]error, error) {
+	bulk := db.db.NewBulkDocument()
+	for _, job := range jobs {
+		if err := bulk.Delete(job.UUID, job.Rev); err != nil {
+			return nil, err
+		}
+	}
+
+	results, err := bulk.Commit()
+	if err != nil {
+		return nil, checkKnownErrors(err)
+	}
+
+	if len(results) != len(jobs) {
+		return nil, fmt.Errorf("got %d bulk results for %d jobs", len(results), len(jobs))
+	}
+
+	errs := make([]error, len(jobs))
+	for i, result := range results {
+		errs[i] = bulkResultError(result)
+	}
+
+	return errs, nil
+}
+
+// Delete removes the job from the database
+func (db *JobDB) Delete(job *api.Job) error {
+	_, err := db.db.Delete(job.UUID, job.Rev)
+	return checkKnownErrors(err)
 }
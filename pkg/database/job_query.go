@@ -0,0 +1,165 @@
+package database
+
+import (
+	"regexp"
+	"time"
+
+	"github.com/scalify/puppet-master-gateway/pkg/api"
+)
+
+// Fields jobs can be sorted by
+const (
+	JobSortCreatedAt  = "created_at"
+	JobSortStartedAt  = "started_at"
+	JobSortFinishedAt = "finished_at"
+	JobSortDuration   = "duration"
+	JobSortPriority   = "priority"
+)
+
+// JobSortFields are all fields jobs can be sorted by
+var JobSortFields = []string{JobSortCreatedAt, JobSortStartedAt, JobSortFinishedAt, JobSortDuration, JobSortPriority}
+
+// A JobFilter limits a list of jobs, all conditions that are set have to match. Time ranges
+// include their start and exclude their end, durations are given in milliseconds. Jobs match the
+// labels if they have all of them with equal values.
+type JobFilter struct {
+	Status                       string
+	BatchID                      string
+	CreatedSince, CreatedUntil   *time.Time
+	StartedSince, StartedUntil   *time.Time
+	FinishedSince, FinishedUntil *time.Time
+	MinDuration, MaxDuration     *int
+	HasError                     *bool
+	Search                       string
+	Labels                       map[string]string
+}
+
+// A JobSort orders a list of jobs by a single field. Jobs without a value for the field, like
+// jobs that have not been started yet when sorting by started_at, are left out.
+type JobSort struct {
+	Field      string
+	Descending bool
+}
+
+// A JobQuery selects a page of filtered and sorted jobs. A bookmark continues the query where its
+// previous page ended, the page number is ignored then. Fields limits the jobs to the given
+// fields, all fields are returned if it is empty.
+type JobQuery struct {
+	JobFilter
+	Sort     *JobSort
+	Fields   []string
+	Page     int
+	PerPage  int
+	Bookmark string
+}
+
+// A JobPage is a page of the jobs selected by a JobQuery, along with the total count of selected
+// jobs, if known, and the bookmark of the next page
+type JobPage struct {
+	Jobs     []*api.Job
+	Total    *int
+	Bookmark string
+}
+
+// countable returns true if the selected jobs can be counted by the views of the indexes
+func (f *JobFilter) countable() bool {
+	return f.CreatedSince == nil && f.CreatedUntil == nil &&
+		f.StartedSince == nil && f.StartedUntil == nil &&
+		f.FinishedSince == nil && f.FinishedUntil == nil &&
+		f.MinDuration == nil && f.MaxDuration == nil &&
+		f.HasError == nil && f.Search == "" && len(f.Labels) == 0
+}
+
+// selector translates the filter into a mango selector
+func (f *JobFilter) selector() map[string]interface{} {
+	selector := map[string]interface{}{}
+	condition := func(field, operator string, value interface{}) {
+		c, ok := selector[field].(map[string]interface{})
+		if !ok {
+			c = map[string]interface{}{}
+			selector[field] = c
+		}
+		c[operator] = value
+	}
+
+	timeRange := func(field string, since, until *time.Time) {
+		if since != nil {
+			condition(field, "$gte", api.JSONTime{Time: *since})
+		}
+		if until != nil {
+			condition(field, "$lt", api.JSONTime{Time: *until})
+		}
+	}
+
+	if f.Status != "" {
+		condition("status", "$eq", f.Status)
+	}
+
+	if f.BatchID != "" {
+		condition("batch_id", "$eq", f.BatchID)
+	}
+
+	timeRange("created_at", f.CreatedSince, f.CreatedUntil)
+	timeRange("started_at", f.StartedSince, f.StartedUntil)
+	timeRange("finished_at", f.FinishedSince, f.FinishedUntil)
+
+	if f.MinDuration != nil {
+		condition("duration", "$gte", *f.MinDuration)
+	}
+
+	if f.MaxDuration != nil {
+		condition("duration", "$lte", *f.MaxDuration)
+	}
+
+	if f.HasError != nil {
+		if *f.HasError {
+			condition("error", "$gt", nil)
+		} else {
+			selector["$or"] = []interface{}{
+				map[string]interface{}{"error": map[string]interface{}{"$exists": false}},
+				map[string]interface{}{"error": map[string]interface{}{"$eq": nil}},
+			}
+		}
+	}
+
+	if f.Search != "" {
+		condition("code", "$regex", "(?i)"+regexp.QuoteMeta(f.Search))
+	}
+
+	// label keys can't contain dots, so they are safe to use within a field path
+	for key, value := range f.Labels {
+		condition("labels."+key, "$eq", value)
+	}
+
+	return selector
+}
+
+// sort translates the sort of the query into a mango sort. The sorted field is added to the
+// selector if missing, as mango only uses an index for sorting if the selector covers its field.
+func (q *JobQuery) sort(selector map[string]interface{}) []interface{} {
+	if q.Sort == nil {
+		return nil
+	}
+
+	if _, ok := selector[q.Sort.Field]; !ok {
+		// null sorts before all other values, so this matches every job with a value
+		selector[q.Sort.Field] = map[string]interface{}{"$gt": nil}
+	}
+
+	direction := "asc"
+	if q.Sort.Descending {
+		direction = "desc"
+	}
+
+	sort := []interface{}{map[string]string{q.Sort.Field: direction}}
+
+	// a status filter is sorted by the index of the status and the field, if there is one
+	if q.Status != "" {
+		byStatus := append([]interface{}{map[string]string{"status": direction}}, sort...)
+		if _, ok := sortIndex(jobIndexes, byStatus); ok {
+			return byStatus
+		}
+	}
+
+	return sort
+}
@@ -0,0 +1,104 @@
+package database
+
+import (
+	"time"
+
+	"github.com/rhinoman/couchdb-go"
+	"github.com/satori/go.uuid"
+
+	"github.com/scalify/puppet-master-gateway/pkg/api"
+)
+
+// ScheduleDB talks to a couchDB server and handles Schedule instances
+type ScheduleDB struct {
+	db *couchdb.Database
+}
+
+// scheduleIndexes are the mango indexes required by the schedule queries
+var scheduleIndexes = []Index{
+	{Name: "paused-next_run_at", Fields: []string{"paused", "next_run_at"}},
+}
+
+// NewScheduleDB returns a new ScheduleDB instance
+func NewScheduleDB(db *couchdb.Database) *ScheduleDB {
+	return &ScheduleDB{
+		db: db,
+	}
+}
+
+// EnsureIndexes creates or updates the indexes required by the schedule queries
+func (db *ScheduleDB) EnsureIndexes() (*IndexChanges, error) {
+	return ensureIndexes(db.db, scheduleIndexes, nil)
+}
+
+// Get fetches a schedule from database, identified by given UUID
+func (db *ScheduleDB) Get(id string) (*api.Schedule, error) {
+	schedule := api.NewSchedule()
+	rev, err := db.db.Read(id, schedule, nil)
+	if err != nil {
+		return nil, checkKnownErrors(err)
+	}
+
+	schedule.Rev = rev
+	return schedule, nil
+}
+
+type scheduleList struct {
+	Docs []*api.Schedule `json:"docs"`
+}
+
+func (db *ScheduleDB) getListBy(selector map[string]interface{}, page, perPage int) ([]*api.Schedule, error) {
+	result := &scheduleList{}
+	query := &couchdb.FindQueryParams{
+		Selector: selector,
+		Limit:    perPage,
+		Skip:     perPage * (page - 1),
+	}
+
+	if err := db.db.Find(result, query); err != nil {
+		return nil, err
+	}
+
+	return result.Docs, nil
+}
+
+// GetList returns a paginated list of schedules
+func (db *ScheduleDB) GetList(page, perPage int) ([]*api.Schedule, error) {
+	return db.getListBy(map[string]interface{}{}, page, perPage)
+}
+
+// GetDueList returns a paginated list of schedules which are not paused and have
+// a next_run_at timestamp that is not after now
+func (db *ScheduleDB) GetDueList(now time.Time, page, perPage int) ([]*api.Schedule, error) {
+	selector := map[string]interface{}{
+		"paused": map[string]interface{}{
+			"$eq": false,
+		},
+		"next_run_at": map[string]interface{}{
+			"$lte": api.JSONTime{Time: now},
+		},
+	}
+
+	return db.getListBy(selector, page, perPage)
+}
+
+// Save writes the schedule to DB
+func (db *ScheduleDB) Save(schedule *api.Schedule) error {
+	if schedule.UUID == "" {
+		schedule.UUID = uuid.NewV4().String()
+	}
+
+	rev, err := db.db.Save(schedule, schedule.UUID, schedule.Rev)
+	if err != nil {
+		return checkKnownErrors(err)
+	}
+
+	schedule.Rev = rev
+	return nil
+}
+
+// Delete removes the schedule from the database
+func (db *ScheduleDB) Delete(schedule *api.Schedule) error {
+	_, err := db.db.Delete(schedule.UUID, schedule.Rev)
+	return checkKnownErrors(err)
+}
@@ -0,0 +1,129 @@
+package database
+
+import (
+	"encoding/json"
+
+	"github.com/rhinoman/couchdb-go"
+
+	"github.com/scalify/puppet-master-gateway/pkg/api"
+)
+
+// VersionDB talks to a couchDB server and handles the versions of a versioned resource, like
+// templates, modules or workflows. Every version is a document of its own, identified by
+// api.VersionedID, which is never updated.
+type VersionDB struct {
+	db *couchdb.Database
+}
+
+// versionIndexes are the mango indexes required by the version queries
+var versionIndexes = []Index{
+	{Name: "name-version", Fields: []string{"name", "version"}},
+}
+
+// NewVersionDB returns a new VersionDB instance
+func NewVersionDB(db *couchdb.Database) *VersionDB {
+	return &VersionDB{
+		db: db,
+	}
+}
+
+// EnsureIndexes creates or updates the indexes required by the version queries
+func (db *VersionDB) EnsureIndexes() (*IndexChanges, error) {
+	return ensureIndexes(db.db, versionIndexes, nil)
+}
+
+// GetVersion reads the given version of the resource with the given name into doc
+func (db *VersionDB) GetVersion(name string, version int, doc api.Versioned) error {
+	rev, err := db.db.Read(api.VersionedID(name, version), doc, nil)
+	if err != nil {
+		return checkKnownErrors(err)
+	}
+
+	doc.Meta().Rev = rev
+	return nil
+}
+
+type versionList struct {
+	Docs []json.RawMessage `json:"docs"`
+}
+
+func (db *VersionDB) getListBy(selector map[string]interface{}, sort []interface{}, page, perPage int) ([]json.RawMessage, error) {
+	result := &versionList{}
+	query := &couchdb.FindQueryParams{
+		Selector: selector,
+		Limit:    perPage,
+		Skip:     perPage * (page - 1),
+	}
+
+	if len(sort) > 0 {
+		query.Sort = sort
+	}
+
+	if err := db.db.Find(result, query); err != nil {
+		return nil, err
+	}
+
+	return result.Docs, nil
+}
+
+// GetLatest reads the highest version of the resource with the given name into doc
+func (db *VersionDB) GetLatest(name string, doc api.Versioned) error {
+	selector := map[string]interface{}{
+		"name": map[string]interface{}{
+			"$eq": name,
+		},
+		"version": map[string]interface{}{
+			"$gt": 0,
+		},
+	}
+
+	sort := []interface{}{
+		map[string]string{"name": "desc"},
+		map[string]string{"version": "desc"},
+	}
+
+	docs, err := db.getListBy(selector, sort, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	if len(docs) == 0 {
+		return ErrNotFound
+	}
+
+	return json.Unmarshal(docs[0], doc)
+}
+
+// GetList returns a paginated list of all versions of all resources, each decoded into a new
+// document returned by newDoc
+func (db *VersionDB) GetList(page, perPage int, newDoc func() api.Versioned) ([]api.Versioned, error) {
+	docs, err := db.getListBy(map[string]interface{}{}, nil, page, perPage)
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]api.Versioned, len(docs))
+	for i, raw := range docs {
+		list[i] = newDoc()
+		if err := json.Unmarshal(raw, list[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return list, nil
+}
+
+// Save writes the version to DB, versions are never updated so an existing version
+// results in ErrConflict
+func (db *VersionDB) Save(doc api.Versioned) error {
+	meta := doc.Meta()
+	meta.UUID = api.VersionedID(meta.Name, meta.Version)
+
+	rev, err := db.db.Save(doc, meta.UUID, "")
+	if err != nil {
+		return checkKnownErrors(err)
+	}
+
+	meta.Rev = rev
+	return nil
+}
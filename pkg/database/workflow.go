@@ -0,0 +1,81 @@
+package database
+
+import (
+	"github.com/rhinoman/couchdb-go"
+	"github.com/satori/go.uuid"
+
+	"github.com/scalify/puppet-master-gateway/pkg/api"
+)
+
+// WorkflowRunDB talks to a couchDB server and handles WorkflowRun instances
+type WorkflowRunDB struct {
+	db *couchdb.Database
+}
+
+// workflowRunIndexes are the mango indexes required by the workflow run queries
+var workflowRunIndexes = []Index{
+	{Name: "status", Fields: []string{"status"}},
+}
+
+// NewWorkflowRunDB returns a new WorkflowRunDB instance
+func NewWorkflowRunDB(db *couchdb.Database) *WorkflowRunDB {
+	return &WorkflowRunDB{
+		db: db,
+	}
+}
+
+// EnsureIndexes creates or updates the indexes required by the workflow run queries
+func (db *WorkflowRunDB) EnsureIndexes() (*IndexChanges, error) {
+	return ensureIndexes(db.db, workflowRunIndexes, nil)
+}
+
+// Get fetches a workflow run from database, identified by given UUID
+func (db *WorkflowRunDB) Get(id string) (*api.WorkflowRun, error) {
+	run := &api.WorkflowRun{}
+	rev, err := db.db.Read(id, run, nil)
+	if err != nil {
+		return nil, checkKnownErrors(err)
+	}
+
+	run.Rev = rev
+	return run, nil
+}
+
+type workflowRunList struct {
+	Docs []*api.WorkflowRun `json:"docs"`
+}
+
+// GetListByStatus returns a paginated list of workflow runs with the given status
+func (db *WorkflowRunDB) GetListByStatus(status string, page, perPage int) ([]*api.WorkflowRun, error) {
+	result := &workflowRunList{}
+	query := &couchdb.FindQueryParams{
+		Selector: map[string]interface{}{
+			"status": map[string]interface{}{
+				"$eq": status,
+			},
+		},
+		Limit: perPage,
+		Skip:  perPage * (page - 1),
+	}
+
+	if err := db.db.Find(result, query); err != nil {
+		return nil, err
+	}
+
+	return result.Docs, nil
+}
+
+// Save writes the workflow run to DB
+func (db *WorkflowRunDB) Save(run *api.WorkflowRun) error {
+	if run.UUID == "" {
+		run.UUID = uuid.NewV4().String()
+	}
+
+	rev, err := db.db.Save(run, run.UUID, run.Rev)
+	if err != nil {
+		return checkKnownErrors(err)
+	}
+
+	run.Rev = rev
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
 	"time"
 
@@ -27,22 +28,76 @@ func (s *Server) getQueryParamAsInt(req *http.Request, param string, defaultValu
 
 func (s *Server) getPageAndPerPage(req *http.Request) (int, int, error) {
 	page, err := s.getQueryParamAsInt(req, "page", 1)
-	if err != nil {
-		return 0, 0, err
+	if err != nil || page < 1 {
+		return 0, 0, fmt.Errorf("page must be a positive integer, got %q", req.URL.Query().Get("page"))
 	}
 
 	perPage, err := s.getQueryParamAsInt(req, "per_page", 10)
-	if err != nil {
-		return 0, 0, err
+	if err != nil || perPage < 1 {
+		return 0, 0, fmt.Errorf("per_page must be a positive integer, got %q", req.URL.Query().Get("per_page"))
 	}
 
 	return page, perPage, nil
 }
 
-func (s *Server) loggerForJob(id string) logging.Logger {
+// listLinks returns the links of the list page described by meta, based on the url of the
+// request. There is a next page if meta has a cursor for it, pages requested by cursor link the
+// next page only, as cursors can't go backwards.
+func listLinks(u *url.URL, meta *api.ListMeta) *api.ListLinks {
+	link := func(param, value string) string {
+		query := u.Query()
+		query.Del("page")
+		query.Del("cursor")
+		query.Set(param, value)
+		return (&url.URL{Path: u.Path, RawQuery: query.Encode()}).String()
+	}
+
+	links := &api.ListLinks{Self: u.RequestURI()}
+	if meta.Page == 0 {
+		if meta.NextCursor != "" {
+			links.Next = link("cursor", meta.NextCursor)
+		}
+		return links
+	}
+
+	if meta.NextCursor != "" {
+		links.Next = link("page", strconv.Itoa(meta.Page+1))
+	}
+
+	if meta.Page > 1 {
+		links.Prev = link("page", strconv.Itoa(meta.Page-1))
+	}
+
+	return links
+}
+
+// loggerForJob returns a logger whose lines carry the id and the labels of the job
+func (s *Server) loggerForJob(job *api.Job) logging.Logger {
+	entry, ok := s.logger.(*logrus.Entry)
+	if !ok {
+		return s.logger
+	}
+
+	fields := logrus.Fields{api.LogFieldJobID: job.UUID}
+	for key, value := range job.Labels {
+		fields[api.LogFieldLabelPrefix+key] = value
+	}
+
+	return entry.WithFields(fields)
+}
+
+// loggerForJobID returns a logger for a job that has not been loaded yet
+func (s *Server) loggerForJobID(id string) logging.Logger {
+	return s.loggerWithField(api.LogFieldJobID, id)
+}
 
+func (s *Server) loggerForSchedule(id string) logging.Logger {
+	return s.loggerWithField(api.LogFieldScheduleID, id)
+}
+
+func (s *Server) loggerWithField(field, value string) logging.Logger {
 	if entry, ok := s.logger.(*logrus.Entry); ok {
-		return entry.WithField(api.LogFieldJobID, id)
+		return entry.WithField(field, value)
 	}
 
 	return s.logger
@@ -53,42 +108,100 @@ func (s *Server) CreateJob(rw http.ResponseWriter, req *http.Request) {
 	rw.Header().Add(api.ContentTypeHeader, api.ContentTypeJSON)
 
 	job := api.NewJob()
-	if err := json.NewDecoder(req.Body).Decode(job); err != nil {
-		s.logger.Errorf("Failed to decode json body: %v", err)
-		rw.WriteHeader(http.StatusBadRequest)
-		if _, errw := fmt.Fprintf(rw, jsonErrFailedToDecodeBody, err); errw != nil {
-			s.logger.Error(errw)
-		}
+	if err := json.NewDecoder(http.MaxBytesReader(rw, req.Body, maxJobRequestSize)).Decode(job); err != nil {
+		s.writeDecodeError(rw, err, maxJobRequestSize, s.logger)
 		return
 	}
 
-	job.Status = api.JobStatusCreated
-	job.CreatedAt = api.JSONTime{Time: time.Now()}
-	if job.UUID == "" {
-		job.UUID = uuid.NewV4().String()
-	} else if s.checkForExistingJob(rw, job.UUID) {
+	if err := api.ValidateNewJob(job); err != nil {
+		s.writeInvalidJob(rw, err, s.loggerForJob(job))
+		return
+	}
+
+	s.createJob(rw, job)
+}
+
+// errBodyTooLarge is the message of the error returned by readers of http.MaxBytesReader once the
+// limit is exceeded, older go versions have no dedicated error type for it
+const errBodyTooLarge = "http: request body too large"
+
+// writeDecodeError responds to a request body that could not be decoded, bodies exceeding the
+// given limit are rejected as too large.
+func (s *Server) writeDecodeError(rw http.ResponseWriter, err error, limit int64, logger logging.Logger) {
+	if err.Error() == errBodyTooLarge {
+		logger.Debugf("Request body too large: %v", err)
+		writeError(rw, api.NewError(http.StatusRequestEntityTooLarge, api.ErrorCodeBodyTooLarge, "the body must not be larger than %d bytes", limit), logger)
+		return
+	}
+
+	logger.Errorf("Failed to decode json body: %v", err)
+	writeError(rw, api.NewError(http.StatusBadRequest, api.ErrorCodeInvalidBody, "failed to decode json body: %v", err), logger)
+}
+
+// writeInvalidJob responds to a job that failed validation with a list of the invalid fields
+func (s *Server) writeInvalidJob(rw http.ResponseWriter, err error, logger logging.Logger) {
+	logger.Debugf("Invalid job: %v", err)
+
+	e := api.NewError(http.StatusUnprocessableEntity, api.ErrorCodeValidationFailed, "invalid job: %v", err)
+	if validationErr, ok := err.(*api.ValidationError); ok {
+		e.WithDetails(validationErr.Fields)
+	}
+
+	writeError(rw, e, logger)
+}
+
+// createJob stores a job submitted through the API in the database and writes it as response
+func (s *Server) createJob(rw http.ResponseWriter, job *api.Job) {
+	hasUUID := job.UUID != ""
+	prepareNewJob(job, time.Now())
+	if hasUUID && s.checkForExistingJob(rw, job.UUID) {
 		// job already exists in db
 		return
 	}
 
-	logger := s.loggerForJob(job.UUID)
+	logger := s.loggerForJob(job)
+	if job.HasDependencies() {
+		errs, err := s.validateDependencies([]*api.Job{job})
+		if err != nil {
+			logger.Errorf("Failed to load dependencies: %v", err)
+			writeError(rw, api.NewError(http.StatusInternalServerError, api.ErrorCodeInternal, "failed to load dependencies: %v", err), logger)
+			return
+		}
+
+		if err := errs[job.UUID]; err != nil {
+			s.writeInvalidJob(rw, err, logger)
+			return
+		}
+	}
+
 	if err := s.db.Save(job); err != nil {
 		logger.Errorf("Failed to save job: %v", err)
-		rw.WriteHeader(http.StatusInternalServerError)
-		if _, errw := fmt.Fprintf(rw, jsonErrFailedToSaveJob, err); errw != nil {
-			logger.Error(errw)
-		}
+		writeError(rw, api.NewError(http.StatusInternalServerError, api.ErrorCodeInternal, "failed to save job: %v", err), logger)
 		return
 	}
 
+	s.publishJobEvent(api.JobEventStatus, job)
 	rw.WriteHeader(http.StatusCreated)
-	job.Rev = ""
+	job.ClearPrivateFields()
 	jobResponse := &api.JobResponse{Data: job}
 	if err := json.NewEncoder(rw).Encode(jobResponse); err != nil {
 		logger.Errorf("Failed to encode job: %v", err)
 	}
 }
 
+// prepareNewJob sets all fields owned by the server on a job submitted through the API, jobs
+// with dependencies wait for them before they are queued.
+func prepareNewJob(job *api.Job, now time.Time) {
+	job.Status = api.JobStatusCreated
+	if job.HasDependencies() {
+		job.Status = api.JobStatusWaiting
+	}
+	job.CreatedAt = api.JSONTime{Time: now}
+	if job.UUID == "" {
+		job.UUID = uuid.NewV4().String()
+	}
+}
+
 func (s *Server) checkForExistingJob(rw http.ResponseWriter, uuid string) bool {
 	existingJob, err := s.db.Get(uuid)
 	if err == database.ErrNotFound {
@@ -97,104 +210,138 @@ func (s *Server) checkForExistingJob(rw http.ResponseWriter, uuid string) bool {
 
 	if err != nil {
 		s.logger.Errorf("Failed to look for existing job on explicit uuid %s: %v", uuid, err)
-		rw.WriteHeader(http.StatusInternalServerError)
-		if _, errw := fmt.Fprintf(rw, jsonErrFailedToSaveJob, err); errw != nil {
-			s.logger.Error(errw)
-		}
+		writeError(rw, api.NewError(http.StatusInternalServerError, api.ErrorCodeInternal, "failed to save job: %v", err), s.logger)
 		return true
 	}
 
 	s.logger.Errorf("Job does already exist with given UUID %s: %v", uuid, err)
-	rw.WriteHeader(http.StatusConflict)
-	err = fmt.Errorf("A job with the given UUID %s does already exist, created at %s", uuid, existingJob.CreatedAt.String())
-
-	if _, errw := fmt.Fprintf(rw, jsonErrJobExists, uuid, err); errw != nil {
-		s.logger.Error(errw)
-	}
+	writeError(rw, api.NewError(http.StatusConflict, api.ErrorCodeAlreadyExists, "a job with the given uuid %s does already exist, created at %s", uuid, existingJob.CreatedAt.String()), s.logger)
 
 	return true
 }
 
-// GetJobs returns a paginated list of jobs
+// GetJobs returns a paginated list of jobs. Pages are either selected by number or by the cursor
+// returned along with the previous page, which is faster for pages deep within the list.
 func (s *Server) GetJobs(rw http.ResponseWriter, req *http.Request) {
 	rw.Header().Add(api.ContentTypeHeader, api.ContentTypeJSON)
 
 	page, perPage, err := s.getPageAndPerPage(req)
 	if err != nil {
-		s.logger.Errorf("Failed to get request params page and per_page from request: %v", err)
-		rw.WriteHeader(http.StatusInternalServerError)
-		if _, errw := fmt.Fprintf(rw, jsonErrFailedToFetchJobs, err); errw != nil {
-			s.logger.Error(errw)
-		}
+		s.logger.Debugf("Invalid pagination params: %v", err)
+		writeError(rw, api.NewError(http.StatusBadRequest, api.ErrorCodeInvalidParameter, "%v", err), s.logger)
 		return
 	}
 
-	var jobs []*api.Job
-	status := req.URL.Query().Get("status")
-	if status != "" {
-		jobs, err = s.db.GetListByStatus(status, page, perPage)
-	} else {
-		jobs, err = s.db.GetList(page, perPage)
+	query, err := newJobQuery(req, page, perPage)
+	if err != nil {
+		s.logger.Debugf("Invalid job list params: %v", err)
+		writeError(rw, api.NewError(http.StatusBadRequest, api.ErrorCodeInvalidParameter, "%v", err), s.logger)
+		return
 	}
 
+	result, err := s.db.GetPage(query)
 	if err != nil {
 		s.logger.Errorf("Failed to load jobs: %v", err)
-		rw.WriteHeader(http.StatusInternalServerError)
-		if _, errw := fmt.Fprintf(rw, jsonErrFailedToFetchJobs, err); errw != nil {
-			s.logger.Error(errw)
-		}
+		writeError(rw, api.NewError(http.StatusInternalServerError, api.ErrorCodeInternal, "failed to fetch job list: %v", err), s.logger)
 		return
 	}
 
-	for i := range jobs {
-		jobs[i].Rev = ""
+	data := make([]api.PartialJob, len(result.Jobs))
+	for i, job := range result.Jobs {
+		job.ClearPrivateFields()
+		if data[i], err = api.NewPartialJob(job, query.Fields); err != nil {
+			s.logger.Errorf("Failed to encode job: %v", err)
+			writeError(rw, api.NewError(http.StatusInternalServerError, api.ErrorCodeInternal, "failed to encode job: %v", err), s.logger)
+			return
+		}
+	}
+
+	meta := &api.ListMeta{
+		Total:   result.Total,
+		PerPage: perPage,
 	}
 
-	jobsResponse := &api.JobsResponse{Data: jobs}
+	hasNext := len(result.Jobs) == perPage
+	if query.Bookmark == "" {
+		meta.Page = page
+		if result.Total != nil {
+			hasNext = page*perPage < *result.Total
+		}
+	}
+
+	if hasNext {
+		meta.NextCursor = result.Bookmark
+	}
+
+	jobsResponse := &api.PartialJobsResponse{
+		Data:  data,
+		Meta:  meta,
+		Links: listLinks(req.URL, meta),
+	}
 	if err := json.NewEncoder(rw).Encode(jobsResponse); err != nil {
 		s.logger.Errorf("Failed to encode job: %v", err)
-		if _, errw := fmt.Fprintf(rw, jsonErrFailedToFetchJobs, err); errw != nil {
-			s.logger.Error(errw)
-		}
 	}
 
 	s.logger.Debugf("Loaded job from database and sent to client")
 }
 
-// GetJob reads the job from the database and returns it
-func (s *Server) GetJob(rw http.ResponseWriter, req *http.Request) {
-	rw.Header().Add(api.ContentTypeHeader, api.ContentTypeJSON)
-
-	vars := mux.Vars(req)
-	jobID := vars["id"]
-	logger := s.loggerForJob(jobID)
-
+// loadJob reads the job from the database and writes an error response if that fails
+func (s *Server) loadJob(rw http.ResponseWriter, jobID string, logger logging.Logger) (*api.Job, bool) {
 	job, err := s.db.Get(jobID)
 	if err != nil {
 		if err == database.ErrNotFound {
 			logger.Debugf("Failed to find job in database")
-			rw.WriteHeader(http.StatusNotFound)
-			if _, errw := fmt.Fprintf(rw, jsonErrJobNotFound, jobID, err); errw != nil {
-				s.logger.Error(errw)
-			}
-			return
+			writeError(rw, api.NewError(http.StatusNotFound, api.ErrorCodeNotFound, "job %s not found", jobID), s.logger)
+			return nil, false
 		}
 
 		logger.Errorf("Failed to load job: %v", err)
-		rw.WriteHeader(http.StatusInternalServerError)
-		if _, errw := fmt.Fprintf(rw, jsonErrFailedToFetchJob, err); errw != nil {
-			s.logger.Error(errw)
+		writeError(rw, api.NewError(http.StatusInternalServerError, api.ErrorCodeInternal, "failed to fetch job: %v", err), s.logger)
+		return nil, false
+	}
+
+	return job, true
+}
+
+// GetJob reads the job from the database and returns it, limited to the fields given by the
+// fields query param
+func (s *Server) GetJob(rw http.ResponseWriter, req *http.Request) {
+	rw.Header().Add(api.ContentTypeHeader, api.ContentTypeJSON)
+
+	vars := mux.Vars(req)
+	jobID := vars["id"]
+	logger := s.loggerForJobID(jobID)
+
+	var fields []string
+	if str := req.URL.Query().Get("fields"); str != "" {
+		var err error
+		if fields, err = api.ParseJobFields(str); err != nil {
+			logger.Debugf("Invalid fields param: %v", err)
+			writeError(rw, api.NewError(http.StatusBadRequest, api.ErrorCodeInvalidParameter, "invalid fields parameter: %v", err), logger)
+			return
 		}
+	}
+
+	job, ok := s.loadJob(rw, jobID, logger)
+	if !ok {
 		return
 	}
+	logger = s.loggerForJob(job)
+
+	job.ClearPrivateFields()
+	var response interface{} = &api.JobResponse{Data: job}
+	if fields != nil {
+		partial, err := api.NewPartialJob(job, fields)
+		if err != nil {
+			logger.Errorf("Failed to encode job: %v", err)
+			writeError(rw, api.NewError(http.StatusInternalServerError, api.ErrorCodeInternal, "failed to encode job: %v", err), logger)
+			return
+		}
+		response = &api.PartialJobResponse{Data: partial}
+	}
 
-	job.Rev = ""
-	jobResponse := &api.JobResponse{Data: job}
-	if err := json.NewEncoder(rw).Encode(jobResponse); err != nil {
+	if err := json.NewEncoder(rw).Encode(response); err != nil {
 		logger.Errorf("Failed to encode job: %v", err)
-		if _, errw := fmt.Fprintf(rw, jsonErrFailedToFetchJobs, err); errw != nil {
-			s.logger.Error(errw)
-		}
 	}
 
 	logger.Debugf("Loaded job from database and sent to client")
@@ -206,35 +353,112 @@ func (s *Server) DeleteJob(rw http.ResponseWriter, req *http.Request) {
 
 	vars := mux.Vars(req)
 	jobID := vars["id"]
-	logger := s.loggerForJob(jobID)
+	logger := s.loggerForJobID(jobID)
 
-	job, err := s.db.Get(jobID)
-	if err != nil {
-		if err == database.ErrNotFound {
-			logger.Debugf("Failed to find job in database")
-			rw.WriteHeader(http.StatusNotFound)
-			if _, errw := fmt.Fprintf(rw, jsonErrJobNotFound, jobID, err); errw != nil {
-				s.logger.Error(errw)
-			}
-			return
-		}
+	job, ok := s.loadJob(rw, jobID, logger)
+	if !ok {
+		return
+	}
+	logger = s.loggerForJob(job)
 
-		logger.Errorf("Failed to load job: %v", err)
-		rw.WriteHeader(http.StatusInternalServerError)
-		if _, errw := fmt.Fprintf(rw, jsonErrFailedToFetchJob, err); errw != nil {
-			s.logger.Error(errw)
-		}
+	if err := s.deleteJob(job, logger); err != nil {
+		logger.Errorf("Failed to delete job: %v", err)
+		writeError(rw, api.NewError(http.StatusInternalServerError, api.ErrorCodeInternal, "failed to delete job: %v", err), s.logger)
 		return
 	}
 
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+// deleteJob removes the job from the database and notifies the executors if it has been published already
+func (s *Server) deleteJob(job *api.Job, logger logging.Logger) error {
 	if err := s.db.Delete(job); err != nil {
-		logger.Errorf("Failed to delete job: %v", err)
-		rw.WriteHeader(http.StatusInternalServerError)
-		if _, errw := fmt.Fprintf(rw, jsonErrFailedToDeleteJob, err); errw != nil {
-			s.logger.Error(errw)
+		return err
+	}
+
+	s.jobDeleted(job, logger)
+	return nil
+}
+
+// jobDeleted removes the artifacts of a deleted job and notifies about the deletion
+func (s *Server) jobDeleted(job *api.Job, logger logging.Logger) {
+	s.deleteArtifacts(job, logger)
+
+	s.publishJobEvent(api.JobEventDeleted, job)
+	s.notifyWorkflowRun(job)
+	if job.Status == api.JobStatusQueued || job.Status == api.JobStatusRunning {
+		// the job might already be running, let the executors know it's gone
+		if err := s.publishJobCancellation(job, job.Attempt); err != nil {
+			logger.Errorf("Failed to publish job cancellation: %v", err)
 		}
+	}
+}
+
+// CancelJob marks a job as cancelled, so it won't be queued anymore, and notifies the executors about it
+func (s *Server) CancelJob(rw http.ResponseWriter, req *http.Request) {
+	rw.Header().Add(api.ContentTypeHeader, api.ContentTypeJSON)
+
+	vars := mux.Vars(req)
+	jobID := vars["id"]
+	logger := s.loggerForJobID(jobID)
+
+	job, ok := s.loadJob(rw, jobID, logger)
+	if !ok {
 		return
 	}
+	logger = s.loggerForJob(job)
 
-	rw.WriteHeader(http.StatusNoContent)
+	if !job.IsCancellable() {
+		logger.Debugf("Job with status %s can not be cancelled", job.Status)
+		writeError(rw, api.NewError(http.StatusConflict, api.ErrorCodeNotCancellable, "job %s can not be cancelled, it has status %s", jobID, job.Status), s.logger)
+		return
+	}
+
+	if err := s.cancelJob(job, logger); err != nil {
+		logger.Errorf("Failed to save job: %v", err)
+		writeError(rw, api.NewError(http.StatusInternalServerError, api.ErrorCodeInternal, "failed to save job: %v", err), logger)
+		return
+	}
+
+	job.ClearPrivateFields()
+	jobResponse := &api.JobResponse{Data: job}
+	if err := json.NewEncoder(rw).Encode(jobResponse); err != nil {
+		logger.Errorf("Failed to encode job: %v", err)
+	}
+
+	logger.Debugf("Cancelled job")
+}
+
+// cancelJob marks a cancellable job as cancelled and notifies the executors if it has been published already
+func (s *Server) cancelJob(job *api.Job, logger logging.Logger) error {
+	wasPublished := markCancelled(job, time.Now())
+	if err := s.db.Save(job); err != nil {
+		return err
+	}
+
+	s.jobCancelled(job, wasPublished, logger)
+	return nil
+}
+
+// markCancelled sets the status of the job to cancelled, it returns whether the job has been
+// published to the executors already
+func markCancelled(job *api.Job, now time.Time) bool {
+	wasPublished := job.Status == api.JobStatusQueued || job.Status == api.JobStatusRunning
+	job.Status = api.JobStatusCancelled
+	job.CancelledAt = &api.JSONTime{Time: now}
+	job.ScheduleCallback(now)
+
+	return wasPublished
+}
+
+// jobCancelled notifies about a saved cancellation, including the executors if the job has been
+// published already
+func (s *Server) jobCancelled(job *api.Job, wasPublished bool, logger logging.Logger) {
+	s.publishJobEvent(api.JobEventStatus, job)
+	s.notifyWorkflowRun(job)
+	if wasPublished {
+		if err := s.publishJobCancellation(job, job.Attempt); err != nil {
+			logger.Errorf("Failed to publish job cancellation: %v", err)
+		}
+	}
 }
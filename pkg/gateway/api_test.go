@@ -7,6 +7,9 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
 	"testing"
 	"time"
 
@@ -38,9 +41,11 @@ func TestServerStartUnauthorizedJobs(t *testing.T) {
 
 	t.Logf("Jobs response: %q", rw.Body.String())
 
-	if rw.Body.String() != "Unauthorized." {
-		t.Errorf("Unexpected healthz response: %q", rw.Body.String())
+	if rw.Code != http.StatusUnauthorized {
+		t.Errorf("Unexpected http response: %v", rw.Result().Status)
 	}
+
+	assertErrorResponse(t, rw, api.ErrorCodeUnauthorized)
 }
 
 func TestServerStartUnauthorizedHealthz(t *testing.T) {
@@ -86,7 +91,7 @@ func TestServerCreateJob(t *testing.T) {
 	go startServer(ctx, t, s)
 	time.Sleep(100 * time.Millisecond)
 
-	job, b := newTestJob(t, "asdf-1234-asdf-1234")
+	job, b := newTestSubmittedJob(t, "asdf-1234-asdf-1234")
 	req := httptest.NewRequest(http.MethodPost, "/jobs", bytes.NewReader(b))
 	addAPITokenHeader(req, "test")
 	rw := httptest.NewRecorder()
@@ -122,6 +127,90 @@ func TestServerCreateJob(t *testing.T) {
 	}
 }
 
+func TestServerCreateJobInvalid(t *testing.T) {
+	q := internalTesting.NewTestQueue()
+	db := internalTesting.NewTestDB()
+	l := logging.NewTestLogger(t)
+
+	s, err := NewServer(db, q, l, "test", true, true)
+	if err != nil {
+		t.Log(err)
+		t.Fatal(fmt.Sprintf("failed to start server: %v", err))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	go startServer(ctx, t, s)
+	time.Sleep(100 * time.Millisecond)
+
+	_, b := newTestJob(t, "asdf-1234-asdf-1234")
+	req := httptest.NewRequest(http.MethodPost, "/jobs", bytes.NewReader(b))
+	addAPITokenHeader(req, "test")
+	rw := httptest.NewRecorder()
+	s.srv.Handler.ServeHTTP(rw, req)
+
+	if rw.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Unexpected http response: %v", rw.Result().Status)
+	}
+
+	t.Logf("CreateJob response: %q", rw.Body.String())
+
+	response := &struct {
+		api.Error
+		Details []api.FieldError `json:"details"`
+	}{}
+	if err := json.Unmarshal(rw.Body.Bytes(), response); err != nil {
+		t.Fatalf("Failed to decode response body: %v", err)
+	}
+
+	if response.Code != api.ErrorCodeValidationFailed {
+		t.Errorf("Unexpected error code: %q", response.Code)
+	}
+
+	if len(response.Details) != 1 || response.Details[0].Field != "created_at" {
+		t.Errorf("Unexpected field errors: %+v", response.Details)
+	}
+
+	if len(db.SavedJobs) != 0 {
+		t.Fatalf("Unexpected count of saved Jobs: %d", len(db.SavedJobs))
+	}
+}
+
+func TestServerCreateJobTooLarge(t *testing.T) {
+	q := internalTesting.NewTestQueue()
+	db := internalTesting.NewTestDB()
+	l := logging.NewTestLogger(t)
+
+	s, err := NewServer(db, q, l, "test", true, true)
+	if err != nil {
+		t.Fatal(fmt.Sprintf("failed to start server: %v", err))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	go startServer(ctx, t, s)
+	time.Sleep(100 * time.Millisecond)
+
+	b := []byte(`{"code": "` + strings.Repeat("a", maxJobRequestSize) + `"}`)
+	req := httptest.NewRequest(http.MethodPost, "/jobs", bytes.NewReader(b))
+	addAPITokenHeader(req, "test")
+	rw := httptest.NewRecorder()
+	s.srv.Handler.ServeHTTP(rw, req)
+
+	if rw.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Unexpected http response: %v", rw.Result().Status)
+	}
+
+	response := &api.Error{}
+	if err := json.Unmarshal(rw.Body.Bytes(), response); err != nil {
+		t.Fatalf("Failed to decode response body: %v", err)
+	}
+
+	if response.Code != api.ErrorCodeBodyTooLarge {
+		t.Errorf("Unexpected error code: %q", response.Code)
+	}
+}
+
 func TestServerGetJob(t *testing.T) {
 	q := internalTesting.NewTestQueue()
 	db := internalTesting.NewTestDB()
@@ -220,6 +309,165 @@ func TestServerGetJobs(t *testing.T) {
 	}
 }
 
+func TestServerGetJobFields(t *testing.T) {
+	q := internalTesting.NewTestQueue()
+	db := internalTesting.NewTestDB()
+	l := logging.NewTestLogger(t)
+
+	s, err := NewServer(db, q, l, "test", true, true)
+	if err != nil {
+		t.Log(err)
+		t.Fatal(fmt.Sprintf("failed to start server: %v", err))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	go startServer(ctx, t, s)
+	time.Sleep(100 * time.Millisecond)
+
+	job, _ := newTestJob(t, "asdf-1234-asdf-1234")
+	job.Logs = []api.Log{{Level: "info", Message: "hello"}}
+	db.Jobs = append(db.Jobs, job)
+
+	getFields := func(url string) []string {
+		req := httptest.NewRequest(http.MethodGet, url, nil)
+		addAPITokenHeader(req, "test")
+		rw := httptest.NewRecorder()
+		s.srv.Handler.ServeHTTP(rw, req)
+
+		if rw.Code != 200 {
+			t.Fatalf("Unexpected http response for %s: %v", url, rw.Result().Status)
+		}
+
+		var response struct {
+			Data json.RawMessage `json:"data"`
+		}
+		if err := json.Unmarshal(rw.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to decode response body: %v", err)
+		}
+
+		data := response.Data
+		if strings.HasPrefix(string(data), "[") {
+			var list []json.RawMessage
+			if err := json.Unmarshal(data, &list); err != nil || len(list) != 1 {
+				t.Fatalf("Unexpected jobs: %s", data)
+			}
+			data = list[0]
+		}
+
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(data, &fields); err != nil {
+			t.Fatalf("Failed to decode job: %v", err)
+		}
+
+		names := make([]string, 0, len(fields))
+		for name := range fields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return names
+	}
+
+	if fields := getFields("/jobs/asdf-1234-asdf-1234?fields=status,logs"); !reflect.DeepEqual(fields, []string{"logs", "status", "uuid"}) {
+		t.Errorf("Unexpected fields of job: %v", fields)
+	}
+
+	if fields := getFields("/jobs?fields=code"); !reflect.DeepEqual(fields, []string{"code", "uuid"}) {
+		t.Errorf("Unexpected fields of listed job: %v", fields)
+	}
+
+	if fields := getFields("/jobs"); len(fields) != len(api.JobSummaryFields) {
+		t.Errorf("Expected the summary fields of listed job, got %v", fields)
+	}
+
+	if fields := getFields("/jobs?fields=*"); len(fields) <= len(api.JobSummaryFields) {
+		t.Errorf("Expected all fields of listed job, got %v", fields)
+	}
+
+	for _, url := range []string{"/jobs/asdf-1234-asdf-1234?fields=callback_secret", "/jobs?fields=status,unknown"} {
+		req := httptest.NewRequest(http.MethodGet, url, nil)
+		addAPITokenHeader(req, "test")
+		rw := httptest.NewRecorder()
+		s.srv.Handler.ServeHTTP(rw, req)
+
+		if rw.Code != http.StatusBadRequest {
+			t.Errorf("Unexpected http response for %s: %v", url, rw.Result().Status)
+		}
+
+		assertErrorResponse(t, rw, api.ErrorCodeInvalidParameter)
+	}
+}
+
+func TestServerGetJobsPagination(t *testing.T) {
+	q := internalTesting.NewTestQueue()
+	db := internalTesting.NewTestDB()
+	l := logging.NewTestLogger(t)
+
+	s, err := NewServer(db, q, l, "test", true, true)
+	if err != nil {
+		t.Log(err)
+		t.Fatal(fmt.Sprintf("failed to start server: %v", err))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	go startServer(ctx, t, s)
+	time.Sleep(100 * time.Millisecond)
+
+	for i := 0; i < 5; i++ {
+		job, _ := newTestJob(t, fmt.Sprintf("job-%d", i))
+		db.Jobs = append(db.Jobs, job)
+	}
+
+	getJobs := func(path string) *api.JobsResponse {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		addAPITokenHeader(req, "test")
+		rw := httptest.NewRecorder()
+		s.srv.Handler.ServeHTTP(rw, req)
+
+		if rw.Code != 200 {
+			t.Fatalf("Unexpected http response: %v", rw.Result().Status)
+		}
+
+		t.Logf("GetJobs response: %q", rw.Body.String())
+
+		response := &api.JobsResponse{}
+		if err := json.Unmarshal(rw.Body.Bytes(), response); err != nil {
+			t.Fatalf("Failed to decode response body: %v", err)
+		}
+
+		return response
+	}
+
+	second := getJobs("/jobs?page=2&per_page=2")
+	if len(second.Data) != 2 || second.Data[0].UUID != "job-2" {
+		t.Fatalf("Unexpected jobs of second page: %+v", second.Data)
+	}
+
+	meta := second.Meta
+	if meta.Total == nil || *meta.Total != 5 || meta.Page != 2 || meta.PerPage != 2 || meta.NextCursor != "4" {
+		t.Errorf("Unexpected meta: %+v", meta)
+	}
+
+	expectedLinks := api.ListLinks{
+		Self: "/jobs?page=2&per_page=2",
+		Next: "/jobs?page=3&per_page=2",
+		Prev: "/jobs?page=1&per_page=2",
+	}
+	if *second.Links != expectedLinks {
+		t.Errorf("Unexpected links: %+v", second.Links)
+	}
+
+	last := getJobs("/jobs?per_page=2&cursor=" + second.Meta.NextCursor)
+	if len(last.Data) != 1 || last.Data[0].UUID != "job-4" {
+		t.Fatalf("Unexpected jobs of last page: %+v", last.Data)
+	}
+
+	if last.Meta.Page != 0 || last.Meta.NextCursor != "" || last.Links.Next != "" || last.Links.Prev != "" {
+		t.Errorf("Expected last page without next page, got %+v, %+v", last.Meta, last.Links)
+	}
+}
+
 func TestServerDeleteJob(t *testing.T) {
 	q := internalTesting.NewTestQueue()
 	db := internalTesting.NewTestDB()
@@ -265,6 +513,59 @@ func TestServerDeleteJob(t *testing.T) {
 	}
 }
 
+func TestServerCancelJob(t *testing.T) {
+	q := internalTesting.NewTestQueue()
+	db := internalTesting.NewTestDB()
+	l := logging.NewTestLogger(t)
+
+	s, err := NewServer(db, q, l, "test", true, false)
+	if err != nil {
+		t.Log(err)
+		t.Fatal(fmt.Sprintf("failed to start server: %v", err))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	go startServer(ctx, t, s)
+	time.Sleep(100 * time.Millisecond)
+
+	job, _ := newTestJob(t, "asdf-1234-asdf-1234")
+	job.Status = api.JobStatusQueued
+	db.Jobs = append(db.Jobs, job)
+
+	req := httptest.NewRequest(http.MethodPost, "/jobs/asdf-1234-asdf-1234/cancel", nil)
+	addAPITokenHeader(req, "test")
+	rw := httptest.NewRecorder()
+	s.srv.Handler.ServeHTTP(rw, req)
+
+	if rw.Code != 200 {
+		t.Errorf("Unexpected http response: %v", rw.Result().Status)
+	}
+
+	t.Logf("CancelJob response: %q", rw.Body.String())
+
+	if len(db.SavedJobs) != 1 {
+		t.Fatalf("Unexpected count of saved Jobs: %d", len(db.SavedJobs))
+	}
+
+	if db.SavedJobs[0].Status != api.JobStatusCancelled {
+		t.Fatalf("Expected job to have status %s, got %s", api.JobStatusCancelled, db.SavedJobs[0].Status)
+	}
+
+	if len(q.Messages) != 1 {
+		t.Fatalf("Unexpected count of published cancellations: %d", len(q.Messages))
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/jobs/asdf-1234-asdf-1234/cancel", nil)
+	addAPITokenHeader(req, "test")
+	rw = httptest.NewRecorder()
+	s.srv.Handler.ServeHTTP(rw, req)
+
+	if rw.Code != 409 {
+		t.Errorf("Unexpected http response when cancelling twice: %v", rw.Result().Status)
+	}
+}
+
 func startServer(ctx context.Context, t *testing.T, s *Server) {
 	if err := s.prepare(ctx, 0); err != nil && err != http.ErrServerClosed {
 		t.Errorf("failed to start server: %v", err)
@@ -0,0 +1,275 @@
+package gateway
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aklinkert/go-logging"
+	"github.com/gorilla/mux"
+
+	"github.com/scalify/puppet-master-gateway/pkg/api"
+	"github.com/scalify/puppet-master-gateway/pkg/artifact"
+)
+
+// invalidArtifactNameChars are replaced within the result keys used as artifact names
+var invalidArtifactNameChars = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+// artifactExtensions are the preferred extensions of common artifact content types, the mime
+// package lists several extensions for some of them
+var artifactExtensions = map[string]string{
+	"application/json": ".json",
+	"application/pdf":  ".pdf",
+	"image/jpeg":       ".jpg",
+	"image/png":        ".png",
+	"text/html":        ".html",
+	"text/plain":       ".txt",
+}
+
+// storeArtifacts moves the uploaded artifacts of the result and all results that are data urls
+// or too large to be kept inline to the artifact store, and references them from the job. Names
+// used more than once within the result get a numeric suffix, so no artifact replaces another one
+// of the same result. Jobs created before their uuids were validated may have one the stores
+// can't use, their results are kept inline and their uploads are dropped, as retrying won't help.
+func (s *Server) storeArtifacts(job *api.Job, uploads []api.ArtifactUpload, logger logging.Logger) error {
+	if err := api.ValidateArtifactName(job.UUID); err != nil {
+		logger.Errorf("Dropping %d artifacts and keeping results inline, the job uuid can't be used within the artifact store: %v", len(uploads), err)
+		return nil
+	}
+
+	now := api.JSONTime{Time: time.Now()}
+	taken := make(map[string]bool, len(uploads))
+
+	for _, upload := range uploads {
+		if err := api.ValidateArtifactName(upload.Name); err != nil {
+			logger.Errorf("Dropping artifact of job: %v", err)
+			continue
+		}
+
+		contentType := upload.ContentType
+		if contentType == "" {
+			contentType = http.DetectContentType(upload.Data)
+		}
+
+		name := uniqueArtifactName(upload.Name, taken)
+		if err := s.artifacts.Put(job.UUID, name, contentType, upload.Data); err != nil {
+			return fmt.Errorf("failed to store artifact %s: %v", name, err)
+		}
+
+		job.AddArtifact(api.Artifact{Name: name, ContentType: contentType, Size: len(upload.Data), CreatedAt: now})
+	}
+
+	// sorted, so the suffixes don't depend on the iteration order of the results
+	keys := make([]string, 0, len(job.Results))
+	for key := range job.Results {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		contentType, data, ok := resultArtifact(job.Results[key])
+		if !ok {
+			continue
+		}
+
+		name := uniqueArtifactName(artifactName(key, contentType), taken)
+		if err := s.artifacts.Put(job.UUID, name, contentType, data); err != nil {
+			return fmt.Errorf("failed to store result %s: %v", key, err)
+		}
+
+		job.AddArtifact(api.Artifact{Name: name, ContentType: contentType, Size: len(data), Result: key, CreatedAt: now})
+		delete(job.Results, key)
+	}
+
+	return nil
+}
+
+// resultArtifact returns the content of a result that should be kept as artifact. Base64 encoded
+// data urls, like screenshots, are decoded, other results are kept if their json encoding exceeds
+// the inline size.
+func resultArtifact(value interface{}) (string, []byte, bool) {
+	if str, ok := value.(string); ok && strings.HasPrefix(str, "data:") {
+		if i := strings.Index(str, ";base64,"); i > 0 {
+			data, err := base64.StdEncoding.DecodeString(str[i+len(";base64,"):])
+			if err == nil {
+				return str[len("data:"):i], data, true
+			}
+		}
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil || len(data) <= api.MaxInlineResultSize {
+		return "", nil, false
+	}
+
+	return api.ContentTypeJSON, data, true
+}
+
+// artifactName returns the name of the artifact of a result, with the extension of its content type
+func artifactName(key, contentType string) string {
+	name := strings.TrimLeft(invalidArtifactNameChars.ReplaceAllString(key, "_"), ".-")
+	if name == "" {
+		name = "result"
+	}
+	name = strings.Replace(name, "..", "_", -1)
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return name
+	}
+
+	if ext, ok := artifactExtensions[mediaType]; ok {
+		return name + ext
+	}
+
+	if extensions, err := mime.ExtensionsByType(mediaType); err == nil && len(extensions) > 0 {
+		return name + extensions[0]
+	}
+
+	return name
+}
+
+// uniqueArtifactName returns the name if it is not taken yet, otherwise the name with the lowest
+// numeric suffix before its extension that is free. The returned name is marked as taken.
+func uniqueArtifactName(name string, taken map[string]bool) string {
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+
+	unique := name
+	for i := 2; taken[unique]; i++ {
+		unique = fmt.Sprintf("%s-%d%s", base, i, ext)
+	}
+	taken[unique] = true
+
+	return unique
+}
+
+// A lostResultError reports a result of a job which has been moved to the artifact store and
+// can't be loaded from there anymore
+type lostResultError struct {
+	result string
+	err    error
+}
+
+func (e *lostResultError) Error() string {
+	return fmt.Sprintf("has the result %s, which can't be loaded from the artifact store: %v", e.result, e.err)
+}
+
+// jobResults returns all results of the job, including the ones that have been moved to the
+// artifact store. Data urls are restored from their artifacts, other results are decoded from
+// their json encoding. Results which are lost are reported as *lostResultError, other errors
+// are temporary.
+func (s *Server) jobResults(job *api.Job) (map[string]interface{}, error) {
+	results := make(map[string]interface{}, len(job.Results)+len(job.Artifacts))
+	for key, value := range job.Results {
+		results[key] = value
+	}
+
+	for _, a := range job.Artifacts {
+		if a.Result == "" {
+			continue
+		}
+
+		if s.artifacts == nil {
+			return nil, &lostResultError{result: a.Result, err: errors.New("there is no artifact store")}
+		}
+
+		data, err := s.readArtifact(job.UUID, a.Name)
+		if err == artifact.ErrNotFound {
+			return nil, &lostResultError{result: a.Result, err: err}
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to load result %s: %v", a.Result, err)
+		}
+
+		if a.ContentType != api.ContentTypeJSON {
+			results[a.Result] = "data:" + a.ContentType + ";base64," + base64.StdEncoding.EncodeToString(data)
+			continue
+		}
+
+		var value interface{}
+		if err := json.Unmarshal(data, &value); err != nil {
+			return nil, &lostResultError{result: a.Result, err: err}
+		}
+		results[a.Result] = value
+	}
+
+	return results, nil
+}
+
+func (s *Server) readArtifact(jobID, name string) ([]byte, error) {
+	content, err := s.artifacts.Get(jobID, name)
+	if err != nil {
+		return nil, err
+	}
+	defer content.Close()
+
+	return ioutil.ReadAll(content)
+}
+
+// deleteArtifacts removes the artifacts of a deleted job from the artifact store
+func (s *Server) deleteArtifacts(job *api.Job, logger logging.Logger) {
+	if s.artifacts == nil {
+		return
+	}
+
+	for _, a := range job.Artifacts {
+		if err := s.artifacts.Delete(job.UUID, a.Name); err != nil {
+			logger.Errorf("Failed to delete artifact %s: %v", a.Name, err)
+		}
+	}
+}
+
+// GetJobArtifact sends the content of an artifact of the job, with the content type it was stored with
+func (s *Server) GetJobArtifact(rw http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	jobID := vars["id"]
+	logger := s.loggerForJobID(jobID)
+
+	job, ok := s.loadJob(rw, jobID, logger)
+	if !ok {
+		return
+	}
+	logger = s.loggerForJob(job)
+
+	a, ok := job.Artifact(vars["name"])
+	if !ok {
+		logger.Debugf("Failed to find artifact %s", vars["name"])
+		writeError(rw, api.NewError(http.StatusNotFound, api.ErrorCodeNotFound, "artifact %s of job %s not found", vars["name"], jobID), logger)
+		return
+	}
+
+	content, err := s.artifacts.Get(job.UUID, a.Name)
+	if err != nil {
+		if err == artifact.ErrNotFound {
+			logger.Errorf("Artifact %s is missing in the artifact store", a.Name)
+			writeError(rw, api.NewError(http.StatusNotFound, api.ErrorCodeNotFound, "artifact %s of job %s not found", a.Name, jobID), logger)
+			return
+		}
+
+		logger.Errorf("Failed to load artifact %s: %v", a.Name, err)
+		writeError(rw, api.NewError(http.StatusInternalServerError, api.ErrorCodeInternal, "failed to fetch artifact: %v", err), logger)
+		return
+	}
+	defer content.Close()
+
+	// artifacts like html dumps come from scraped pages, they must not run within the origin of the api
+	rw.Header().Set(api.ContentTypeHeader, a.ContentType)
+	rw.Header().Set("Content-Length", strconv.Itoa(a.Size))
+	rw.Header().Set("Content-Security-Policy", "sandbox")
+	rw.Header().Set("X-Content-Type-Options", "nosniff")
+
+	if _, err := io.Copy(rw, content); err != nil {
+		logger.Errorf("Failed to send artifact %s: %v", a.Name, err)
+	}
+}
@@ -0,0 +1,237 @@
+package gateway
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aklinkert/go-logging"
+	"github.com/streadway/amqp"
+
+	"github.com/scalify/puppet-master-gateway/pkg/api"
+	internalTesting "github.com/scalify/puppet-master-gateway/pkg/internal/testing"
+)
+
+func TestServer_handleJobResultArtifacts(t *testing.T) {
+	q := internalTesting.NewTestQueue()
+	db := internalTesting.NewTestDB()
+	store := internalTesting.NewTestArtifactStore()
+	l := logging.NewTestLogger(t)
+
+	s, err := NewServer(db, q, l, "test", true, true, WithArtifactStore(store))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job, _ := newTestJob(t, "asdf-1234-asdf-1234")
+	db.Jobs = []*api.Job{job}
+
+	result, _ := newTestJobResult(t, "asdf-1234-asdf-1234")
+	result.Error = nil
+	result.Results["screenshot"] = "data:image/png;base64," + base64.StdEncoding.EncodeToString([]byte("png"))
+	result.Results["page text"] = strings.Repeat("a", api.MaxInlineResultSize)
+	result.Artifacts = []api.ArtifactUpload{
+		{Name: "report.pdf", ContentType: "application/pdf", Data: []byte("pdf")},
+		{Name: "../passwd", Data: []byte("root")},
+	}
+
+	b, err := json.Marshal(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.handleJobResult(amqp.Delivery{Body: b, Acknowledger: &internalTesting.NoopAcknowledger{}})
+
+	if len(db.SavedJobs) != 1 {
+		t.Fatalf("Unexpected count of saved jobs: %v", len(db.SavedJobs))
+	}
+
+	saved := db.SavedJobs[0]
+	if len(saved.Results) != 1 || saved.Results["1234"] != "1234567890" {
+		t.Errorf("Expected small results to be kept inline, got %v", saved.Results)
+	}
+
+	expected := map[string]string{
+		"report.pdf":     "application/pdf",
+		"screenshot.png": "image/png",
+		"page_text.json": api.ContentTypeJSON,
+	}
+
+	if len(saved.Artifacts) != len(expected) {
+		t.Fatalf("Unexpected artifacts: %+v", saved.Artifacts)
+	}
+
+	for name, contentType := range expected {
+		a, ok := saved.Artifact(name)
+		if !ok || a.ContentType != contentType || a.Size != len(store.Artifacts[job.UUID+"/"+name]) {
+			t.Errorf("Unexpected artifact %s: %+v", name, a)
+		}
+	}
+
+	if string(store.Artifacts[job.UUID+"/screenshot.png"]) != "png" {
+		t.Errorf("Expected decoded screenshot, got %q", store.Artifacts[job.UUID+"/screenshot.png"])
+	}
+
+	if a, _ := saved.Artifact("screenshot.png"); a.Result != "screenshot" {
+		t.Errorf("Expected screenshot to reference its result, got %q", a.Result)
+	}
+}
+
+func TestServer_storeArtifactsUniqueNames(t *testing.T) {
+	q := internalTesting.NewTestQueue()
+	db := internalTesting.NewTestDB()
+	store := internalTesting.NewTestArtifactStore()
+	l := logging.NewTestLogger(t)
+
+	s, err := NewServer(db, q, l, "test", true, true, WithArtifactStore(store))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job, _ := newTestJob(t, "asdf-1234-asdf-1234")
+	job.Results = map[string]interface{}{
+		"screenshot": "data:image/png;base64," + base64.StdEncoding.EncodeToString([]byte("result")),
+		"page text":  strings.Repeat("a", api.MaxInlineResultSize),
+		"page_text":  strings.Repeat("b", api.MaxInlineResultSize),
+	}
+	uploads := []api.ArtifactUpload{
+		{Name: "screenshot.png", ContentType: "image/png", Data: []byte("first")},
+		{Name: "screenshot.png", ContentType: "image/png", Data: []byte("second")},
+	}
+
+	if err := s.storeArtifacts(job, uploads, l); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		"screenshot.png":   "first",
+		"screenshot-2.png": "second",
+		"screenshot-3.png": "result",
+		"page_text.json":   `"` + strings.Repeat("a", api.MaxInlineResultSize) + `"`,
+		"page_text-2.json": `"` + strings.Repeat("b", api.MaxInlineResultSize) + `"`,
+	}
+
+	if len(job.Artifacts) != len(expected) {
+		t.Fatalf("Unexpected artifacts: %+v", job.Artifacts)
+	}
+
+	for name, content := range expected {
+		if _, ok := job.Artifact(name); !ok || string(store.Artifacts[job.UUID+"/"+name]) != content {
+			t.Errorf("Expected artifact %s to keep its own content", name)
+		}
+	}
+}
+
+func TestServer_handleJobResultInvalidArtifactKey(t *testing.T) {
+	q := internalTesting.NewTestQueue()
+	db := internalTesting.NewTestDB()
+	store := internalTesting.NewTestArtifactStore()
+	l := logging.NewTestLogger(t)
+
+	s, err := NewServer(db, q, l, "test", true, true, WithArtifactStore(store))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job, _ := newTestJob(t, "team/1")
+	db.Jobs = []*api.Job{job}
+
+	result, _ := newTestJobResult(t, "team/1")
+	result.Error = nil
+	result.Results["page text"] = strings.Repeat("a", api.MaxInlineResultSize)
+	result.Artifacts = []api.ArtifactUpload{{Name: "report.pdf", ContentType: "application/pdf", Data: []byte("pdf")}}
+
+	b, err := json.Marshal(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.handleJobResult(amqp.Delivery{Body: b, Acknowledger: &internalTesting.NoopAcknowledger{}})
+
+	if len(db.SavedJobs) != 1 {
+		t.Fatalf("Expected the result to be saved instead of requeued, got %d saved jobs", len(db.SavedJobs))
+	}
+
+	saved := db.SavedJobs[0]
+	if len(saved.Artifacts) != 0 || len(store.Artifacts) != 0 {
+		t.Errorf("Expected no artifacts to be stored, got %+v", saved.Artifacts)
+	}
+
+	if _, ok := saved.Results["page text"]; !ok || saved.Status != api.JobStatusDone {
+		t.Errorf("Expected the large result to be kept inline, got %+v", saved)
+	}
+}
+
+func TestServerGetJobArtifact(t *testing.T) {
+	q := internalTesting.NewTestQueue()
+	db := internalTesting.NewTestDB()
+	store := internalTesting.NewTestArtifactStore()
+	l := logging.NewTestLogger(t)
+
+	s, err := NewServer(db, q, l, "test", true, true, WithArtifactStore(store))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	go startServer(ctx, t, s)
+	time.Sleep(100 * time.Millisecond)
+
+	job, _ := newTestJob(t, "asdf-1234-asdf-1234")
+	job.Artifacts = []api.Artifact{{Name: "page.html", ContentType: "text/html; charset=utf-8", Size: 13}}
+	db.Jobs = append(db.Jobs, job)
+	if err := store.Put(job.UUID, "page.html", "text/html; charset=utf-8", []byte("<html></html>")); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/jobs/asdf-1234-asdf-1234/artifacts/page.html", nil)
+	addAPITokenHeader(req, "test")
+	rw := httptest.NewRecorder()
+	s.srv.Handler.ServeHTTP(rw, req)
+
+	if rw.Code != http.StatusOK {
+		t.Fatalf("Unexpected http response: %v", rw.Result().Status)
+	}
+
+	if contentType := rw.Header().Get(api.ContentTypeHeader); contentType != "text/html; charset=utf-8" {
+		t.Errorf("Unexpected content type: %q", contentType)
+	}
+
+	if rw.Header().Get("Content-Security-Policy") != "sandbox" {
+		t.Errorf("Expected html artifacts to be sandboxed")
+	}
+
+	if rw.Body.String() != "<html></html>" {
+		t.Errorf("Unexpected artifact content: %q", rw.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/jobs/asdf-1234-asdf-1234/artifacts/missing.png", nil)
+	addAPITokenHeader(req, "test")
+	rw = httptest.NewRecorder()
+	s.srv.Handler.ServeHTTP(rw, req)
+
+	if rw.Code != http.StatusNotFound {
+		t.Errorf("Unexpected http response: %v", rw.Result().Status)
+	}
+
+	assertErrorResponse(t, rw, api.ErrorCodeNotFound)
+
+	req = httptest.NewRequest(http.MethodDelete, "/jobs/asdf-1234-asdf-1234", nil)
+	addAPITokenHeader(req, "test")
+	rw = httptest.NewRecorder()
+	s.srv.Handler.ServeHTTP(rw, req)
+
+	if rw.Code != http.StatusNoContent {
+		t.Fatalf("Unexpected http response: %v", rw.Result().Status)
+	}
+
+	if len(store.Artifacts) != 0 {
+		t.Errorf("Expected the artifacts of the deleted job to be removed, got %v", store.Artifacts)
+	}
+}
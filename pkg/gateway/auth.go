@@ -5,6 +5,8 @@ import (
 	"strings"
 
 	"github.com/aklinkert/go-logging"
+
+	"github.com/scalify/puppet-master-gateway/pkg/api"
 )
 
 const (
@@ -38,11 +40,8 @@ func (m authHandlerMiddleware) Middleware(next http.Handler) http.Handler {
 		h := m.getToken(r)
 
 		if h != m.apiToken {
-			w.WriteHeader(http.StatusUnauthorized)
-			if _, err := w.Write([]byte("Unauthorized.")); err != nil {
-				m.logger.Errorf("failed to write unauthorized: %v", err)
-			}
-
+			w.Header().Set("WWW-Authenticate", strings.TrimSpace(autHeaderSchema))
+			writeError(w, api.NewError(http.StatusUnauthorized, api.ErrorCodeUnauthorized, "a valid api token is required"), m.logger)
 			return
 		}
 
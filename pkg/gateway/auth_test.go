@@ -7,6 +7,8 @@ import (
 	"testing"
 
 	"github.com/aklinkert/go-logging"
+
+	"github.com/scalify/puppet-master-gateway/pkg/api"
 )
 
 func addAPITokenHeader(r *http.Request, apiToken string) {
@@ -34,9 +36,7 @@ func TestAuthHandlerNoAuth(t *testing.T) {
 		t.Errorf("Handler got request while not having authenticated")
 	}
 
-	if rw.Body.String() != "Unauthorized." {
-		t.Errorf("Unexpected body %q", rw.Body.String())
-	}
+	assertErrorResponse(t, rw, api.ErrorCodeUnauthorized)
 
 	if rw.Code != 401 {
 		t.Errorf("Unexpected status code %q", rw.Code)
@@ -57,9 +57,7 @@ func TestAuthHandlerWrongAuth(t *testing.T) {
 		t.Errorf("Handler got request while not having authenticated")
 	}
 
-	if rw.Body.String() != "Unauthorized." {
-		t.Errorf("Unexpected body %q", rw.Body.String())
-	}
+	assertErrorResponse(t, rw, api.ErrorCodeUnauthorized)
 
 	if rw.Code != 401 {
 		t.Errorf("Unexpected status code %q", rw.Code)
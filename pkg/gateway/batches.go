@@ -0,0 +1,350 @@
+package gateway
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aklinkert/go-logging"
+	"github.com/gorilla/mux"
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/scalify/puppet-master-gateway/pkg/api"
+	"github.com/scalify/puppet-master-gateway/pkg/database"
+)
+
+// CreateJobs stores a list of jobs in the database with bulk requests of bulkPerRequest jobs, all
+// of them grouped by a new batch id. Every job is reported with its own result, so a conflicting
+// or invalid job or a failed bulk request does not fail the whole batch.
+func (s *Server) CreateJobs(rw http.ResponseWriter, req *http.Request) {
+	rw.Header().Add(api.ContentTypeHeader, api.ContentTypeJSON)
+
+	var items []json.RawMessage
+	if err := json.NewDecoder(http.MaxBytesReader(rw, req.Body, maxBatchRequestSize)).Decode(&items); err != nil {
+		s.writeDecodeError(rw, err, maxBatchRequestSize, s.logger)
+		return
+	}
+
+	if err := validateBatchSize(len(items)); err != nil {
+		writeError(rw, api.NewError(http.StatusBadRequest, api.ErrorCodeInvalidResource, "invalid batch: %v", err), s.logger)
+		return
+	}
+
+	result := &api.BatchResult{
+		BatchID: uuid.NewV4().String(),
+		Items:   make([]api.BatchItemResult, len(items)),
+	}
+	logger := s.loggerWithField(api.LogFieldBatchID, result.BatchID)
+
+	now := time.Now()
+	jobs := make([]*api.Job, 0, len(items))
+	indexes := make([]int, 0, len(items))
+	seen := make(map[string]bool, len(items))
+
+	for i, item := range items {
+		job, err := decodeBatchJob(item)
+		result.Items[i] = api.BatchItemResult{Index: i, UUID: job.UUID}
+		if err != nil {
+			setBatchItemError(&result.Items[i], err)
+			continue
+		}
+
+		if seen[job.UUID] {
+			result.Items[i].Status = api.BatchItemStatusConflict
+			result.Items[i].Error = fmt.Sprintf("the uuid %s is used more than once within the batch", job.UUID)
+			continue
+		}
+
+		prepareNewJob(job, now)
+		job.BatchID = result.BatchID
+		seen[job.UUID] = true
+		result.Items[i].UUID = job.UUID
+
+		jobs = append(jobs, job)
+		indexes = append(indexes, i)
+	}
+
+	if len(jobs) > 0 {
+		// jobs of the batch may depend on each other, so they are validated together
+		invalid, err := s.validateDependencies(jobs)
+		if err != nil {
+			logger.Errorf("Failed to load dependencies: %v", err)
+			writeError(rw, api.NewError(http.StatusInternalServerError, api.ErrorCodeInternal, "failed to load dependencies: %v", err), logger)
+			return
+		}
+
+		valid := make([]*api.Job, 0, len(jobs))
+		validIndexes := make([]int, 0, len(jobs))
+		for k, job := range jobs {
+			if err := invalid[job.UUID]; err != nil {
+				setBatchItemError(&result.Items[indexes[k]], err)
+				continue
+			}
+
+			valid = append(valid, job)
+			validIndexes = append(validIndexes, indexes[k])
+		}
+		jobs, indexes = valid, validIndexes
+	}
+
+	created := 0
+	for c, chunk := range bulkChunks(jobs) {
+		chunkIndexes := indexes[c*bulkPerRequest:]
+		errs, err := s.db.SaveMany(chunk)
+		if err != nil {
+			// jobs of a bulk request that timed out may have been written nevertheless, a retry
+			// reports them as conflict
+			logger.Errorf("Failed to save jobs: %v", err)
+			for k := range chunk {
+				item := &result.Items[chunkIndexes[k]]
+				item.Status = api.BatchItemStatusError
+				item.Error = fmt.Sprintf("failed to save job: %v", err)
+			}
+			continue
+		}
+
+		for k, job := range chunk {
+			item := &result.Items[chunkIndexes[k]]
+			switch errs[k] {
+			case nil:
+				item.Status = api.BatchItemStatusCreated
+				s.publishJobEvent(api.JobEventStatus, job)
+				created++
+			case database.ErrConflict:
+				item.Status = api.BatchItemStatusConflict
+				item.Error = fmt.Sprintf("a job with the uuid %s does already exist", job.UUID)
+			default:
+				item.Status = api.BatchItemStatusError
+				item.Error = errs[k].Error()
+			}
+		}
+	}
+
+	if err := json.NewEncoder(rw).Encode(&api.BatchResultResponse{Data: result}); err != nil {
+		logger.Errorf("Failed to encode batch result: %v", err)
+	}
+
+	logger.Debugf("Created batch with %d of %d jobs", created, len(items))
+}
+
+// setBatchItemError reports a job of a batch as invalid, along with the invalid fields
+func setBatchItemError(item *api.BatchItemResult, err error) {
+	item.Status = api.BatchItemStatusError
+	item.Error = err.Error()
+	if validationErr, ok := err.(*api.ValidationError); ok {
+		item.Fields = validationErr.Fields
+	}
+}
+
+func validateBatchSize(size int) error {
+	if size == 0 {
+		return errors.New("the batch contains no jobs")
+	}
+
+	if size > maxBatchSize {
+		return fmt.Errorf("the batch contains %d jobs, at most %d are allowed", size, maxBatchSize)
+	}
+
+	return nil
+}
+
+// decodeBatchJob decodes and validates a single job of a batch, the returned job is never nil
+func decodeBatchJob(item json.RawMessage) (*api.Job, error) {
+	job := api.NewJob()
+	if err := json.Unmarshal(item, job); err != nil {
+		return job, fmt.Errorf("failed to decode job: %v", err)
+	}
+
+	return job, api.ValidateNewJob(job)
+}
+
+// batchJobFields are the fields of the jobs of a batch required to aggregate the state of the batch
+var batchJobFields = []string{"uuid", "status", "error", "finished_at"}
+
+// deletedBatchJobFields are the fields of the jobs of a batch required to delete them and to notify
+// about their deletion
+var deletedBatchJobFields = append([]string{"_rev"}, api.JobSummaryFields...)
+
+// loadBatchJobs reads all jobs of the batch from the database, limited to the given fields, and
+// writes an error response if that fails or the batch has no jobs.
+func (s *Server) loadBatchJobs(rw http.ResponseWriter, batchID string, fields []string, logger logging.Logger) ([]*api.Job, bool) {
+	var jobs []*api.Job
+	bookmark := ""
+	for {
+		list, next, err := s.db.GetListByBatchID(batchID, "", fields, bookmark, batchPerPage)
+		if err != nil {
+			logger.Errorf("Failed to load batch jobs: %v", err)
+			writeError(rw, api.NewError(http.StatusInternalServerError, api.ErrorCodeInternal, "failed to fetch batch: %v", err), s.logger)
+			return nil, false
+		}
+
+		jobs = append(jobs, list...)
+		if len(list) < batchPerPage {
+			break
+		}
+		bookmark = next
+	}
+
+	if len(jobs) == 0 {
+		logger.Debugf("Failed to find batch jobs in database")
+		writeError(rw, api.NewError(http.StatusNotFound, api.ErrorCodeNotFound, "batch %s not found, it has no jobs", batchID), s.logger)
+		return nil, false
+	}
+
+	return jobs, true
+}
+
+// bulkChunks splits the jobs into chunks that are written with a single bulk request each
+func bulkChunks(jobs []*api.Job) [][]*api.Job {
+	chunks := make([][]*api.Job, 0, len(jobs)/bulkPerRequest+1)
+	for start := 0; start < len(jobs); start += bulkPerRequest {
+		end := start + bulkPerRequest
+		if end > len(jobs) {
+			end = len(jobs)
+		}
+		chunks = append(chunks, jobs[start:end])
+	}
+
+	return chunks
+}
+
+func (s *Server) writeBatch(rw http.ResponseWriter, batchID string, jobs []*api.Job, logger logging.Logger) {
+	batchResponse := &api.BatchResponse{Data: api.NewBatch(batchID, jobs)}
+	if err := json.NewEncoder(rw).Encode(batchResponse); err != nil {
+		logger.Errorf("Failed to encode batch: %v", err)
+	}
+}
+
+// GetBatch returns the aggregated state of all jobs of a batch
+func (s *Server) GetBatch(rw http.ResponseWriter, req *http.Request) {
+	rw.Header().Add(api.ContentTypeHeader, api.ContentTypeJSON)
+
+	batchID := mux.Vars(req)["id"]
+	logger := s.loggerWithField(api.LogFieldBatchID, batchID)
+
+	jobs, ok := s.loadBatchJobs(rw, batchID, batchJobFields, logger)
+	if !ok {
+		return
+	}
+
+	s.writeBatch(rw, batchID, jobs, logger)
+	logger.Debugf("Loaded batch from database and sent to client")
+}
+
+// DeleteBatch deletes all jobs of a batch from the database
+func (s *Server) DeleteBatch(rw http.ResponseWriter, req *http.Request) {
+	rw.Header().Add(api.ContentTypeHeader, api.ContentTypeJSON)
+
+	batchID := mux.Vars(req)["id"]
+	logger := s.loggerWithField(api.LogFieldBatchID, batchID)
+
+	jobs, ok := s.loadBatchJobs(rw, batchID, deletedBatchJobFields, logger)
+	if !ok {
+		return
+	}
+
+	failed := 0
+	for _, chunk := range bulkChunks(jobs) {
+		errs, err := s.db.DeleteMany(chunk)
+		if err != nil {
+			logger.Errorf("Failed to delete jobs: %v", err)
+			writeError(rw, api.NewError(http.StatusInternalServerError, api.ErrorCodeInternal, "failed to delete job: %v", err), s.logger)
+			return
+		}
+
+		for k, job := range chunk {
+			if errs[k] != nil {
+				logger.Errorf("Failed to delete job %s: %v", job.UUID, errs[k])
+				failed++
+				continue
+			}
+
+			s.jobDeleted(job, s.loggerForJob(job))
+		}
+	}
+
+	if failed > 0 {
+		writeError(rw, api.NewError(http.StatusInternalServerError, api.ErrorCodeInternal, "failed to delete %d of %d jobs", failed, len(jobs)), s.logger)
+		return
+	}
+
+	rw.WriteHeader(http.StatusNoContent)
+	logger.Debugf("Deleted %d jobs of batch", len(jobs))
+}
+
+// CancelBatch cancels all jobs of a batch that have not reached a final status yet and returns
+// the aggregated state of the batch afterwards
+func (s *Server) CancelBatch(rw http.ResponseWriter, req *http.Request) {
+	rw.Header().Add(api.ContentTypeHeader, api.ContentTypeJSON)
+
+	batchID := mux.Vars(req)["id"]
+	logger := s.loggerWithField(api.LogFieldBatchID, batchID)
+
+	jobs, ok := s.loadBatchJobs(rw, batchID, batchJobFields, logger)
+	if !ok {
+		return
+	}
+
+	// only the cancellable jobs are read completely, as they are written back as a whole
+	ids := make([]string, 0, len(jobs))
+	for _, job := range jobs {
+		if job.IsCancellable() {
+			ids = append(ids, job.UUID)
+		}
+	}
+
+	loaded, err := s.loadJobs(ids, nil)
+	if err != nil {
+		logger.Errorf("Failed to load batch jobs: %v", err)
+		writeError(rw, api.NewError(http.StatusInternalServerError, api.ErrorCodeInternal, "failed to fetch batch: %v", err), s.logger)
+		return
+	}
+
+	now := time.Now()
+	cancellable := make([]*api.Job, 0, len(ids))
+	wasPublished := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		if job, ok := loaded[id]; ok && job.IsCancellable() {
+			wasPublished[id] = markCancelled(job, now)
+			cancellable = append(cancellable, job)
+		}
+	}
+
+	failed := 0
+	cancelled := make(map[string]*api.Job, len(cancellable))
+	for _, chunk := range bulkChunks(cancellable) {
+		errs, err := s.db.SaveMany(chunk)
+		if err != nil {
+			logger.Errorf("Failed to save jobs: %v", err)
+			writeError(rw, api.NewError(http.StatusInternalServerError, api.ErrorCodeInternal, "failed to save job: %v", err), s.logger)
+			return
+		}
+
+		for k, job := range chunk {
+			if errs[k] != nil {
+				logger.Errorf("Failed to cancel job %s: %v", job.UUID, errs[k])
+				failed++
+				continue
+			}
+
+			s.jobCancelled(job, wasPublished[job.UUID], s.loggerForJob(job))
+			cancelled[job.UUID] = job
+		}
+	}
+
+	if failed > 0 {
+		writeError(rw, api.NewError(http.StatusInternalServerError, api.ErrorCodeInternal, "failed to cancel %d of %d jobs", failed, len(cancellable)), s.logger)
+		return
+	}
+
+	for i, job := range jobs {
+		if c, ok := cancelled[job.UUID]; ok {
+			jobs[i] = c
+		}
+	}
+
+	s.writeBatch(rw, batchID, jobs, logger)
+	logger.Debugf("Cancelled %d jobs of batch", len(cancelled))
+}
@@ -0,0 +1,414 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aklinkert/go-logging"
+
+	"github.com/scalify/puppet-master-gateway/pkg/api"
+	internalTesting "github.com/scalify/puppet-master-gateway/pkg/internal/testing"
+)
+
+func TestServerCreateJobs(t *testing.T) {
+	q := internalTesting.NewTestQueue()
+	db := internalTesting.NewTestDB()
+	l := logging.NewTestLogger(t)
+
+	s, err := NewServer(db, q, l, "test", true, false)
+	if err != nil {
+		t.Log(err)
+		t.Fatal(fmt.Sprintf("failed to start server: %v", err))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	go startServer(ctx, t, s)
+	time.Sleep(100 * time.Millisecond)
+
+	existing, _ := newTestJob(t, "existing")
+	db.Jobs = append(db.Jobs, existing)
+
+	newJob, _ := newTestSubmittedJob(t, "new")
+	noUUID, _ := newTestSubmittedJob(t, "")
+	noCode, _ := newTestSubmittedJob(t, "no-code")
+	noCode.Code = ""
+	duplicate, _ := newTestSubmittedJob(t, "new")
+	conflicting, _ := newTestSubmittedJob(t, "existing")
+
+	b, err := json.Marshal([]*api.Job{newJob, noUUID, noCode, duplicate, conflicting})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/jobs/batch", bytes.NewReader(b))
+	addAPITokenHeader(req, "test")
+	rw := httptest.NewRecorder()
+	s.srv.Handler.ServeHTTP(rw, req)
+
+	if rw.Code != 200 {
+		t.Errorf("Unexpected http response: %v", rw.Result().Status)
+	}
+
+	t.Logf("CreateJobs response: %q", rw.Body.String())
+
+	response := &api.BatchResultResponse{}
+	if err := json.Unmarshal(rw.Body.Bytes(), response); err != nil {
+		t.Fatalf("Failed to decode response body: %v", err)
+	}
+
+	if response.Data.BatchID == "" {
+		t.Errorf("Expected batch result to have a batch id")
+	}
+
+	expected := []string{
+		api.BatchItemStatusCreated,
+		api.BatchItemStatusCreated,
+		api.BatchItemStatusError,
+		api.BatchItemStatusConflict,
+		api.BatchItemStatusConflict,
+	}
+
+	if len(response.Data.Items) != len(expected) {
+		t.Fatalf("Unexpected count of batch items: %d", len(response.Data.Items))
+	}
+
+	for i, status := range expected {
+		if item := response.Data.Items[i]; item.Index != i || item.Status != status {
+			t.Errorf("Expected item %d to have status %s, got %+v", i, status, item)
+		}
+	}
+
+	if len(db.SavedJobs) != 2 {
+		t.Fatalf("Unexpected count of saved Jobs: %d", len(db.SavedJobs))
+	}
+
+	for _, job := range db.SavedJobs {
+		if job.BatchID != response.Data.BatchID || job.Status != api.JobStatusCreated || job.UUID == "" {
+			t.Errorf("Unexpected saved job: %+v", job)
+		}
+	}
+}
+
+func TestServerCreateJobsDependencies(t *testing.T) {
+	q := internalTesting.NewTestQueue()
+	db := internalTesting.NewTestDB()
+	l := logging.NewTestLogger(t)
+
+	s, err := NewServer(db, q, l, "test", true, false)
+	if err != nil {
+		t.Fatal(fmt.Sprintf("failed to start server: %v", err))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	go startServer(ctx, t, s)
+	time.Sleep(100 * time.Millisecond)
+
+	login, _ := newTestJob(t, "login")
+	db.Jobs = append(db.Jobs, login)
+
+	scrape, _ := newTestSubmittedJob(t, "scrape")
+	scrape.DependsOn = []string{"login"}
+	report, _ := newTestSubmittedJob(t, "report")
+	report.DependsOn = []string{"scrape"}
+	unknown, _ := newTestSubmittedJob(t, "unknown")
+	unknown.DependsOn = []string{"never-created"}
+	cycleA, _ := newTestSubmittedJob(t, "cycle-a")
+	cycleA.DependsOn = []string{"cycle-b"}
+	cycleB, _ := newTestSubmittedJob(t, "cycle-b")
+	cycleB.DependsOn = []string{"cycle-a"}
+
+	b, err := json.Marshal([]*api.Job{scrape, report, unknown, cycleA, cycleB})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/jobs/batch", bytes.NewReader(b))
+	addAPITokenHeader(req, "test")
+	rw := httptest.NewRecorder()
+	s.srv.Handler.ServeHTTP(rw, req)
+
+	response := &api.BatchResultResponse{}
+	if err := json.Unmarshal(rw.Body.Bytes(), response); err != nil {
+		t.Fatalf("Failed to decode response body: %v", err)
+	}
+
+	expected := []string{
+		api.BatchItemStatusCreated,
+		api.BatchItemStatusCreated,
+		api.BatchItemStatusError,
+		api.BatchItemStatusError,
+		api.BatchItemStatusError,
+	}
+
+	if len(response.Data.Items) != len(expected) {
+		t.Fatalf("Unexpected count of batch items: %d", len(response.Data.Items))
+	}
+
+	for i, status := range expected {
+		if item := response.Data.Items[i]; item.Status != status {
+			t.Errorf("Expected item %d to have status %s, got %+v", i, status, item)
+		}
+	}
+
+	if len(db.SavedJobs) != 2 {
+		t.Fatalf("Unexpected count of saved Jobs: %d", len(db.SavedJobs))
+	}
+
+	for _, job := range db.SavedJobs {
+		if job.Status != api.JobStatusWaiting {
+			t.Errorf("Expected job %s to have status %s, got %s", job.UUID, api.JobStatusWaiting, job.Status)
+		}
+	}
+}
+
+func TestServerCreateJobsInvalid(t *testing.T) {
+	q := internalTesting.NewTestQueue()
+	db := internalTesting.NewTestDB()
+	l := logging.NewTestLogger(t)
+
+	s, err := NewServer(db, q, l, "test", true, false)
+	if err != nil {
+		t.Log(err)
+		t.Fatal(fmt.Sprintf("failed to start server: %v", err))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	go startServer(ctx, t, s)
+	time.Sleep(100 * time.Millisecond)
+
+	for _, body := range []string{"{}", "[]"} {
+		req := httptest.NewRequest(http.MethodPost, "/jobs/batch", bytes.NewBufferString(body))
+		addAPITokenHeader(req, "test")
+		rw := httptest.NewRecorder()
+		s.srv.Handler.ServeHTTP(rw, req)
+
+		if rw.Code != 400 {
+			t.Errorf("Unexpected http response for body %s: %v", body, rw.Result().Status)
+		}
+	}
+
+	if len(db.SavedJobs) != 0 {
+		t.Fatalf("Unexpected count of saved Jobs: %d", len(db.SavedJobs))
+	}
+}
+
+func TestServerCreateJobsChunked(t *testing.T) {
+	q := internalTesting.NewTestQueue()
+	db := internalTesting.NewTestDB()
+	l := logging.NewTestLogger(t)
+
+	s, err := NewServer(db, q, l, "test", true, false)
+	if err != nil {
+		t.Fatal(fmt.Sprintf("failed to start server: %v", err))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	go startServer(ctx, t, s)
+	time.Sleep(100 * time.Millisecond)
+
+	invalid, _ := newTestSubmittedJob(t, "invalid")
+	invalid.Code = ""
+	jobs := []*api.Job{invalid}
+	for i := 0; i <= bulkPerRequest; i++ {
+		job, _ := newTestSubmittedJob(t, fmt.Sprintf("job-%d", i))
+		jobs = append(jobs, job)
+	}
+
+	b, err := json.Marshal(jobs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/jobs/batch", bytes.NewReader(b))
+	addAPITokenHeader(req, "test")
+	rw := httptest.NewRecorder()
+	s.srv.Handler.ServeHTTP(rw, req)
+
+	if rw.Code != 200 {
+		t.Fatalf("Unexpected http response: %v", rw.Result().Status)
+	}
+
+	response := &api.BatchResultResponse{}
+	if err := json.Unmarshal(rw.Body.Bytes(), response); err != nil {
+		t.Fatalf("Failed to decode response body: %v", err)
+	}
+
+	if db.SaveManyCalls != 2 {
+		t.Errorf("Expected the jobs to be written with 2 bulk requests, got %d", db.SaveManyCalls)
+	}
+
+	if len(db.SavedJobs) != bulkPerRequest+1 {
+		t.Fatalf("Unexpected count of saved Jobs: %d", len(db.SavedJobs))
+	}
+
+	for i, item := range response.Data.Items {
+		expected := api.BatchItemStatusCreated
+		if i == 0 {
+			expected = api.BatchItemStatusError
+		}
+
+		if item.Status != expected || item.UUID != jobs[i].UUID {
+			t.Errorf("Expected item %d to have status %s, got %+v", i, expected, item)
+		}
+	}
+}
+
+func newTestBatch(t *testing.T, db *internalTesting.TestDB, batchID string) {
+	for i, status := range []string{api.JobStatusDone, api.JobStatusQueued, api.JobStatusCreated} {
+		job, _ := newTestJob(t, fmt.Sprintf("%s-%d", batchID, i))
+		job.BatchID = batchID
+		job.Status = status
+		db.Jobs = append(db.Jobs, job)
+	}
+}
+
+func TestServerGetBatch(t *testing.T) {
+	q := internalTesting.NewTestQueue()
+	db := internalTesting.NewTestDB()
+	l := logging.NewTestLogger(t)
+
+	s, err := NewServer(db, q, l, "test", true, false)
+	if err != nil {
+		t.Log(err)
+		t.Fatal(fmt.Sprintf("failed to start server: %v", err))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	go startServer(ctx, t, s)
+	time.Sleep(100 * time.Millisecond)
+
+	newTestBatch(t, db, "batch")
+
+	req := httptest.NewRequest(http.MethodGet, "/batches/batch", nil)
+	addAPITokenHeader(req, "test")
+	rw := httptest.NewRecorder()
+	s.srv.Handler.ServeHTTP(rw, req)
+
+	if rw.Code != 200 {
+		t.Errorf("Unexpected http response: %v", rw.Result().Status)
+	}
+
+	t.Logf("GetBatch response: %q", rw.Body.String())
+
+	response := &api.BatchResponse{}
+	if err := json.Unmarshal(rw.Body.Bytes(), response); err != nil {
+		t.Fatalf("Failed to decode response body: %v", err)
+	}
+
+	if response.Data.Total != 3 || response.Data.Counts[api.JobStatusDone] != 1 {
+		t.Errorf("Unexpected batch: %+v", response.Data)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/batches/unknown", nil)
+	addAPITokenHeader(req, "test")
+	rw = httptest.NewRecorder()
+	s.srv.Handler.ServeHTTP(rw, req)
+
+	if rw.Code != 404 {
+		t.Errorf("Unexpected http response for unknown batch: %v", rw.Result().Status)
+	}
+}
+
+func TestServerCancelBatch(t *testing.T) {
+	q := internalTesting.NewTestQueue()
+	db := internalTesting.NewTestDB()
+	l := logging.NewTestLogger(t)
+
+	s, err := NewServer(db, q, l, "test", true, false)
+	if err != nil {
+		t.Log(err)
+		t.Fatal(fmt.Sprintf("failed to start server: %v", err))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	go startServer(ctx, t, s)
+	time.Sleep(100 * time.Millisecond)
+
+	newTestBatch(t, db, "batch")
+
+	req := httptest.NewRequest(http.MethodPost, "/batches/batch/cancel", nil)
+	addAPITokenHeader(req, "test")
+	rw := httptest.NewRecorder()
+	s.srv.Handler.ServeHTTP(rw, req)
+
+	if rw.Code != 200 {
+		t.Errorf("Unexpected http response: %v", rw.Result().Status)
+	}
+
+	t.Logf("CancelBatch response: %q", rw.Body.String())
+
+	if len(db.SavedJobs) != 2 {
+		t.Fatalf("Unexpected count of saved Jobs: %d", len(db.SavedJobs))
+	}
+
+	for _, job := range db.SavedJobs {
+		if job.Status != api.JobStatusCancelled {
+			t.Errorf("Expected job %s to have status %s, got %s", job.UUID, api.JobStatusCancelled, job.Status)
+		}
+	}
+
+	// only the queued job has been published before
+	if len(q.Messages) != 1 {
+		t.Fatalf("Unexpected count of published cancellations: %d", len(q.Messages))
+	}
+
+	response := &api.BatchResponse{}
+	if err := json.Unmarshal(rw.Body.Bytes(), response); err != nil {
+		t.Fatalf("Failed to decode response body: %v", err)
+	}
+
+	if response.Data.Counts[api.JobStatusCancelled] != 2 || response.Data.Progress != 100 {
+		t.Errorf("Unexpected batch: %+v", response.Data)
+	}
+}
+
+func TestServerDeleteBatch(t *testing.T) {
+	q := internalTesting.NewTestQueue()
+	db := internalTesting.NewTestDB()
+	l := logging.NewTestLogger(t)
+
+	s, err := NewServer(db, q, l, "test", true, false)
+	if err != nil {
+		t.Log(err)
+		t.Fatal(fmt.Sprintf("failed to start server: %v", err))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	go startServer(ctx, t, s)
+	time.Sleep(100 * time.Millisecond)
+
+	newTestBatch(t, db, "batch")
+	newTestBatch(t, db, "other")
+
+	req := httptest.NewRequest(http.MethodDelete, "/batches/batch", nil)
+	addAPITokenHeader(req, "test")
+	rw := httptest.NewRecorder()
+	s.srv.Handler.ServeHTTP(rw, req)
+
+	if rw.Code != 204 {
+		t.Errorf("Unexpected http response: %v", rw.Result().Status)
+	}
+
+	if len(db.DeletedJobs) != 3 {
+		t.Fatalf("Unexpected count of deleted Jobs: %d", len(db.DeletedJobs))
+	}
+
+	for _, job := range db.DeletedJobs {
+		if job.BatchID != "batch" {
+			t.Errorf("Unexpected deleted job %s of batch %s", job.UUID, job.BatchID)
+		}
+	}
+}
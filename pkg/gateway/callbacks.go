@@ -0,0 +1,244 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/scalify/puppet-master-gateway/pkg/api"
+	"github.com/scalify/puppet-master-gateway/pkg/database"
+)
+
+const (
+	callbackInterval    = 1 * time.Second
+	callbackPerPage     = 20
+	callbackTimeout     = 10 * time.Second
+	callbackMaxAttempts = 8
+	// callbackClaimDuration is how long other gateways skip a callback that is being delivered, a
+	// claim of a gateway that stopped during the delivery expires after it
+	callbackClaimDuration = 3 * callbackTimeout
+	// callbackSaveAttempts limits how often a delivery is recorded again after a conflict
+	callbackSaveAttempts = 3
+)
+
+// callbackBackoff defines the delay between failed callback deliveries
+var callbackBackoff = &api.Backoff{Type: api.BackoffTypeExponential, BaseDelay: 10000}
+
+// deliverCallbacks periodically sends finished jobs with a pending callback to their callback url
+func (s *Server) deliverCallbacks(ctx context.Context) {
+	ticker := time.NewTicker(callbackInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		now := time.Now()
+		jobs, err := s.db.GetPendingCallbackList(now, 1, callbackPerPage)
+		if err != nil {
+			s.logger.Errorf("Failed to get jobs with pending callbacks: %v", err)
+			continue
+		}
+
+		s.logger.Debugf("Got %d jobs with pending callbacks from db.", len(jobs))
+
+		var wg sync.WaitGroup
+		for _, job := range jobs {
+			wg.Add(1)
+			go func(job *api.Job) {
+				defer wg.Done()
+				s.deliverCallback(ctx, job, now)
+			}(job)
+		}
+		wg.Wait()
+	}
+}
+
+func (s *Server) deliverCallback(ctx context.Context, job *api.Job, now time.Time) {
+	l := s.loggerForJob(job)
+
+	// the delivery is claimed first, so other gateways don't send the callback at the same time
+	job.Callback.NextAttemptAt = &api.JSONTime{Time: now.Add(callbackClaimDuration)}
+	if err := s.db.Save(job); err != nil {
+		if err != database.ErrConflict {
+			l.Errorf("Failed to claim callback delivery: %v", err)
+		}
+		// on a conflict the job changed or got claimed by another gateway, it is loaded again once due
+		return
+	}
+
+	attempt := len(job.Callback.Deliveries) + 1
+	start := time.Now()
+	statusCode, err := s.postCallback(ctx, job, attempt)
+
+	delivery := api.CallbackDelivery{
+		Attempt:    attempt,
+		Time:       api.JSONTime{Time: now},
+		StatusCode: statusCode,
+		Duration:   int(time.Since(start) / time.Millisecond),
+	}
+	if err != nil {
+		delivery.Error = err.Error()
+	}
+
+	s.saveCallbackDelivery(job.UUID, delivery, err, now)
+}
+
+// saveCallbackDelivery records the delivery within the current version of the job, so changes
+// made to the job while the callback has been sent are kept
+func (s *Server) saveCallbackDelivery(id string, delivery api.CallbackDelivery, deliveryErr error, now time.Time) {
+	l := s.loggerForJobID(id)
+
+	for i := 0; i < callbackSaveAttempts; i++ {
+		job, err := s.db.Get(id)
+		if err == database.ErrNotFound {
+			return
+		}
+		if err != nil {
+			l.Errorf("Failed to load job to save callback delivery: %v", err)
+			return
+		}
+
+		if job.Callback == nil || job.Callback.Status != api.CallbackStatusPending {
+			return
+		}
+
+		s.applyCallbackDelivery(job, delivery, deliveryErr, now)
+
+		err = s.db.Save(job)
+		if err == nil {
+			return
+		}
+		if err != database.ErrConflict {
+			l.Errorf("Failed to save callback delivery: %v", err)
+			return
+		}
+	}
+
+	l.Errorf("Failed to save callback delivery, the job kept changing")
+}
+
+// applyCallbackDelivery adds the delivery to the callback of the job and schedules the next one
+// if it failed
+func (s *Server) applyCallbackDelivery(job *api.Job, delivery api.CallbackDelivery, err error, now time.Time) {
+	l := s.loggerForJob(job)
+	attempt := delivery.Attempt
+	job.Callback.Deliveries = append(job.Callback.Deliveries, delivery)
+
+	switch {
+	case err == nil:
+		job.Callback.Status = api.CallbackStatusDelivered
+		job.Callback.NextAttemptAt = nil
+		l.Debugf("Delivered callback to %s.", job.CallbackURL)
+	case attempt >= callbackMaxAttempts:
+		job.Callback.Status = api.CallbackStatusFailed
+		job.Callback.NextAttemptAt = nil
+		l.Errorf("Failed to deliver callback to %s, giving up after %d attempts: %v", job.CallbackURL, attempt, err)
+	default:
+		job.Callback.NextAttemptAt = &api.JSONTime{Time: now.Add(callbackBackoff.Duration(attempt))}
+		l.Infof("Failed to deliver callback to %s, retrying at %s: %v", job.CallbackURL, job.Callback.NextAttemptAt, err)
+	}
+}
+
+// postCallback sends the job to its callback url and returns the response status code
+func (s *Server) postCallback(ctx context.Context, job *api.Job, attempt int) (int, error) {
+	payload := *job
+	payload.ClearPrivateFields()
+
+	b, err := json.Marshal(&api.JobResponse{Data: &payload})
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, job.CallbackURL, bytes.NewReader(b))
+	if err != nil {
+		return 0, err
+	}
+
+	req = req.WithContext(ctx)
+	req.Header.Set(api.ContentTypeHeader, api.ContentTypeJSON)
+	req.Header.Set(api.CallbackJobIDHeader, job.UUID)
+	req.Header.Set(api.CallbackAttemptHeader, strconv.Itoa(attempt))
+	if job.CallbackSecret != "" {
+		req.Header.Set(api.CallbackSignatureHeader, signCallback(b, job.CallbackSecret))
+	}
+
+	res, err := s.callbackClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := res.Body.Close(); err != nil {
+		s.loggerForJob(job).Errorf("Failed to close callback response body: %v", err)
+	}
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, fmt.Errorf("unexpected response status %s", res.Status)
+	}
+
+	return res.StatusCode, nil
+}
+
+// privateNetworks are the private IPv4 ranges of RFC 1918 and the unique local IPv6 range of RFC 4193
+var privateNetworks = parseNetworks("10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "fc00::/7")
+
+func parseNetworks(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, len(cidrs))
+	for i, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks[i] = network
+	}
+
+	return networks
+}
+
+// isPrivateIP reports whether the ip is within one of the privateNetworks
+func isPrivateIP(ip net.IP) bool {
+	for _, network := range privateNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// blockPrivateAddress rejects connections to loopback, private, link-local and unspecified
+// addresses. It is called with the resolved address of every connection, including redirects.
+func blockPrivateAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || isPrivateIP(ip) || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified() {
+		return fmt.Errorf("callbacks to the private address %s are blocked", address)
+	}
+
+	return nil
+}
+
+// signCallback returns the hex encoded HMAC-SHA256 signature of the body
+func signCallback(body []byte, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body) // nolint: errcheck
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,223 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aklinkert/go-logging"
+
+	"github.com/scalify/puppet-master-gateway/pkg/api"
+	"github.com/scalify/puppet-master-gateway/pkg/database"
+	internalTesting "github.com/scalify/puppet-master-gateway/pkg/internal/testing"
+)
+
+func TestServer_deliverCallback(t *testing.T) {
+	var signature string
+	var received api.JobResponse
+
+	callbackServer := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		b, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if err := json.Unmarshal(b, &received); err != nil {
+			t.Error(err)
+			return
+		}
+
+		if req.Header.Get(api.CallbackSignatureHeader) != signCallback(b, "secret") {
+			t.Errorf("Unexpected signature %q", req.Header.Get(api.CallbackSignatureHeader))
+		}
+		signature = req.Header.Get(api.CallbackSignatureHeader)
+	}))
+	defer callbackServer.Close()
+
+	q := internalTesting.NewTestQueue()
+	db := internalTesting.NewTestDB()
+	l := logging.NewTestLogger(t)
+
+	s, err := NewServer(db, q, l, "test", true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	job, _ := newTestJob(t, "asdf-1234-asdf-1234")
+	job.Status = api.JobStatusDone
+	job.CallbackURL = callbackServer.URL
+	job.CallbackSecret = "secret"
+	job.ScheduleCallback(now)
+	db.Jobs = []*api.Job{job}
+
+	s.deliverCallback(context.Background(), job, now)
+
+	if signature == "" {
+		t.Fatalf("Callback was not delivered")
+	}
+
+	if received.Data.UUID != job.UUID || received.Data.CallbackSecret != "" {
+		t.Errorf("Unexpected callback payload: %+v", received.Data)
+	}
+
+	if job.Callback.Status != api.CallbackStatusDelivered || len(job.Callback.Deliveries) != 1 {
+		t.Errorf("Expected callback to be delivered, got %+v", job.Callback)
+	}
+
+	// the claim of the delivery and the delivery itself
+	if len(db.SavedJobs) != 2 {
+		t.Errorf("Unexpected count of saved jobs: %d", len(db.SavedJobs))
+	}
+}
+
+func TestServer_deliverCallbackConflict(t *testing.T) {
+	posted := 0
+	callbackServer := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		posted++
+	}))
+	defer callbackServer.Close()
+
+	q := internalTesting.NewTestQueue()
+	db := internalTesting.NewTestDB()
+	l := logging.NewTestLogger(t)
+
+	s, err := NewServer(db, q, l, "test", true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	job, _ := newTestJob(t, "asdf-1234-asdf-1234")
+	job.Status = api.JobStatusDone
+	job.CallbackURL = callbackServer.URL
+	job.ScheduleCallback(now)
+	db.Jobs = []*api.Job{job}
+
+	// claimed by another gateway
+	db.SaveErrors = []error{database.ErrConflict}
+	s.deliverCallback(context.Background(), job, now)
+
+	if posted != 0 {
+		t.Fatalf("Expected callback claimed by another gateway not to be sent")
+	}
+
+	// the job changed while the callback has been sent
+	db.SaveErrors = []error{nil, database.ErrConflict}
+	s.deliverCallback(context.Background(), job, now)
+
+	if posted != 1 {
+		t.Fatalf("Expected callback to be sent once, got %d", posted)
+	}
+
+	if job.Callback.Status != api.CallbackStatusDelivered || len(job.Callback.Deliveries) != 1 {
+		t.Errorf("Expected delivery to be recorded once after the conflict, got %+v", job.Callback)
+	}
+}
+
+func TestServer_deliverCallbackPrivateBlocked(t *testing.T) {
+	callbackServer := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		t.Errorf("Expected callback to the loopback address to be blocked")
+	}))
+	defer callbackServer.Close()
+
+	q := internalTesting.NewTestQueue()
+	db := internalTesting.NewTestDB()
+	l := logging.NewTestLogger(t)
+
+	s, err := NewServer(db, q, l, "test", true, true, WithPrivateCallbacksBlocked())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	job, _ := newTestJob(t, "asdf-1234-asdf-1234")
+	job.Status = api.JobStatusDone
+	job.CallbackURL = callbackServer.URL
+	job.ScheduleCallback(now)
+	db.Jobs = []*api.Job{job}
+
+	s.deliverCallback(context.Background(), job, now)
+
+	if len(job.Callback.Deliveries) != 1 || !strings.Contains(job.Callback.Deliveries[0].Error, "blocked") {
+		t.Errorf("Expected blocked delivery to be recorded, got %+v", job.Callback)
+	}
+}
+
+func TestServer_deliverCallbackRetry(t *testing.T) {
+	callbackServer := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer callbackServer.Close()
+
+	q := internalTesting.NewTestQueue()
+	db := internalTesting.NewTestDB()
+	l := logging.NewTestLogger(t)
+
+	s, err := NewServer(db, q, l, "test", true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	job, _ := newTestJob(t, "asdf-1234-asdf-1234")
+	job.Status = api.JobStatusFailed
+	job.CallbackURL = callbackServer.URL
+	job.ScheduleCallback(now)
+	db.Jobs = []*api.Job{job}
+
+	s.deliverCallback(context.Background(), job, now)
+
+	if job.Callback.Status != api.CallbackStatusPending || !job.Callback.NextAttemptAt.Equal(now.Add(callbackBackoff.Duration(1))) {
+		t.Errorf("Expected callback delivery to be retried later, got %+v", job.Callback)
+	}
+
+	delivery := job.Callback.Deliveries[0]
+	if delivery.StatusCode != http.StatusServiceUnavailable || delivery.Error == "" {
+		t.Errorf("Expected failed delivery to be recorded, got %+v", delivery)
+	}
+
+	for i := 1; i < callbackMaxAttempts; i++ {
+		s.deliverCallback(context.Background(), job, now)
+	}
+
+	if job.Callback.Status != api.CallbackStatusFailed || len(job.Callback.Deliveries) != callbackMaxAttempts {
+		t.Errorf("Expected callback delivery to fail after %d attempts, got %+v", callbackMaxAttempts, job.Callback)
+	}
+}
+
+func TestBlockPrivateAddress(t *testing.T) {
+	tests := []struct {
+		address string
+		blocked bool
+	}{
+		{"127.0.0.1:80", true},
+		{"10.1.2.3:80", true},
+		{"172.16.0.1:443", true},
+		{"172.31.255.255:443", true},
+		{"172.32.0.1:443", false},
+		{"192.168.1.1:80", true},
+		{"169.254.169.254:80", true},
+		{"0.0.0.0:80", true},
+		{"[::1]:80", true},
+		{"[fd00::1]:80", true},
+		{"[fe80::1]:80", true},
+		{"93.184.216.34:443", false},
+		{"[2606:2800:220:1::1]:443", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.address, func(t *testing.T) {
+			err := blockPrivateAddress("tcp", test.address, nil)
+			if blocked := err != nil; blocked != test.blocked {
+				t.Errorf("Expected blocked to be %v, got error %v", test.blocked, err)
+			}
+		})
+	}
+}
@@ -1,11 +1,20 @@
 package gateway
 
+import "time"
+
+// writeTimeout limits the time a handler may take to write its response
+const writeTimeout = 15 * time.Second
+
 const (
-	jsonErrFailedToDecodeBody = "{\"error\":\"Failed to decode json body\", \"message\": %q}"
-	jsonErrFailedToFetchJobs  = "{\"error\":\"Failed to fetch job list\", \"message\": %q}"
-	jsonErrFailedToFetchJob   = "{\"error\":\"Failed to fetch job\", \"message\": %q}"
-	jsonErrFailedToSaveJob    = "{\"error\":\"Failed to save job\", \"message\": %q}"
-	jsonErrFailedToDeleteJob  = "{\"error\":\"Failed to delete job\", \"message\": %q}"
-	jsonErrJobNotFound        = "{\"error\":\"Job %s not found\", \"message\": %q}"
-	jsonErrJobExists          = "{\"error\":\"A job with the given UUID %s already exists\", \"message\": %q}"
+	// maxJobRequestSize is the maximum size of a request body submitting a single job
+	maxJobRequestSize = 8 << 20
+	// maxBatchRequestSize is the maximum size of a request body submitting a batch of jobs
+	maxBatchRequestSize = 64 << 20
+	// maxBatchSize is the maximum count of jobs accepted by a single batch submission
+	maxBatchSize = 10000
+	// batchPerPage is the count of jobs loaded at once when reading all jobs of a batch, which
+	// are limited to a few fields
+	batchPerPage = 1000
+	// bulkPerRequest is the count of jobs written at once when creating or changing the jobs of a batch
+	bulkPerRequest = 500
 )
@@ -0,0 +1,218 @@
+package gateway
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/scalify/puppet-master-gateway/pkg/api"
+)
+
+const (
+	dependenciesPerPage = 100
+
+	// dependencyMissingLimit is how long a job waits for a dependency that can't be found before it
+	// is skipped, as jobs created together become visible to queries one after another
+	dependencyMissingLimit = time.Minute
+)
+
+var (
+	// waitingJobFields are the fields required to check whether a waiting job can be released
+	waitingJobFields = []string{"uuid", "status", "created_at", "depends_on"}
+	// dependencyFields are the fields of a dependency required to check whether it is done
+	dependencyFields = []string{"uuid", "status"}
+)
+
+// releaseWaitingJobs moves waiting jobs to created as soon as all of their dependencies are done,
+// so they are picked up by produceJobs. Waiting jobs with a dependency that did not finish
+// successfully are skipped, which cascades to their own dependents.
+func (s *Server) releaseWaitingJobs(now time.Time) {
+	// all waiting jobs are loaded first, as releasing them changes the pages. Only the fields
+	// required to check their dependencies are loaded, a job is read completely once it changes.
+	var jobs []*api.Job
+	for page := 1; ; page++ {
+		list, err := s.db.GetListByStatus(api.JobStatusWaiting, waitingJobFields, page, dependenciesPerPage)
+		if err != nil {
+			s.logger.Errorf("Failed to get waiting jobs: %v", err)
+			return
+		}
+
+		jobs = append(jobs, list...)
+		if len(list) < dependenciesPerPage {
+			break
+		}
+	}
+
+	if len(jobs) == 0 {
+		return
+	}
+
+	ids := make([]string, 0, len(jobs))
+	seen := make(map[string]bool, len(jobs))
+	for _, job := range jobs {
+		for _, id := range job.DependsOn {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+
+	dependencies, err := s.loadJobs(ids, dependencyFields)
+	if err != nil {
+		s.logger.Errorf("Failed to load dependencies of waiting jobs: %v", err)
+		return
+	}
+
+	for _, job := range jobs {
+		s.releaseWaitingJob(job, dependencies, now)
+	}
+}
+
+func (s *Server) releaseWaitingJob(waiting *api.Job, dependencies map[string]*api.Job, now time.Time) {
+	for _, id := range waiting.DependsOn {
+		dependency, ok := dependencies[id]
+		switch {
+		case id == waiting.UUID:
+			s.updateWaitingJob(waiting.UUID, id, "is the job itself", now)
+			return
+		case !ok && now.Sub(waiting.CreatedAt.Time) < dependencyMissingLimit:
+			return
+		case !ok:
+			s.updateWaitingJob(waiting.UUID, id, "does not exist", now)
+			return
+		case dependency.Status == api.JobStatusDone:
+			continue
+		case dependency.IsFinished():
+			s.updateWaitingJob(waiting.UUID, id, fmt.Sprintf("has status %s", dependency.Status), now)
+			return
+		default:
+			// dependency is not done yet
+			return
+		}
+	}
+
+	s.updateWaitingJob(waiting.UUID, "", "", now)
+}
+
+// updateWaitingJob reads the complete waiting job and skips it because of the given dependency and
+// reason, or releases it if there is no reason
+func (s *Server) updateWaitingJob(id, dependency, reason string, now time.Time) {
+	l := s.loggerForJobID(id)
+
+	job, err := s.db.Get(id)
+	if err != nil {
+		l.Errorf("Failed to load waiting job: %v", err)
+		return
+	}
+
+	if job.Status != api.JobStatusWaiting {
+		// cancelled in the meantime
+		return
+	}
+
+	if reason != "" {
+		job.Skip(dependency, reason, now)
+		s.saveReleasedJob(job)
+		return
+	}
+
+	if job.InjectResults {
+		upstream, err := s.loadJobs(job.DependsOn, nil)
+		if err != nil {
+			l.Errorf("Failed to load dependencies: %v", err)
+			return
+		}
+
+		// earlier dependencies take precedence, so the upstream jobs keep their order
+		ordered := make([]*api.Job, 0, len(job.DependsOn))
+		for _, id := range job.DependsOn {
+			u, ok := upstream[id]
+			if !ok {
+				continue
+			}
+
+			// large results have been moved to the artifact store, the job must not run without them
+			results, err := s.jobResults(u)
+			if lost, ok := err.(*lostResultError); ok {
+				job.Skip(id, lost.Error(), now)
+				s.saveReleasedJob(job)
+				return
+			} else if err != nil {
+				l.Errorf("Failed to load results of dependency %s: %v", id, err)
+				return
+			}
+
+			withResults := *u
+			withResults.Results = results
+			ordered = append(ordered, &withResults)
+		}
+		job.InjectResultsOf(ordered)
+	}
+
+	job.Status = api.JobStatusCreated
+	s.saveReleasedJob(job)
+}
+
+// loadJobs returns the existing jobs with the given uuids by their uuid, limited to the given fields
+func (s *Server) loadJobs(ids []string, fields []string) (map[string]*api.Job, error) {
+	jobs := make(map[string]*api.Job, len(ids))
+	for start := 0; start < len(ids); start += dependenciesPerPage {
+		end := start + dependenciesPerPage
+		if end > len(ids) {
+			end = len(ids)
+		}
+
+		list, err := s.db.GetListByUUIDs(ids[start:end], fields)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, job := range list {
+			jobs[job.UUID] = job
+		}
+	}
+
+	return jobs, nil
+}
+
+// validateDependencies loads the existing dependencies of new jobs and validates the dependencies
+// of all of them, see api.ValidateDependencies
+func (s *Server) validateDependencies(jobs []*api.Job) (map[string]error, error) {
+	seen := make(map[string]bool, len(jobs))
+	for _, job := range jobs {
+		seen[job.UUID] = true
+	}
+
+	var ids []string
+	for _, job := range jobs {
+		for _, id := range job.DependsOn {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+
+	existing, err := s.loadJobs(ids, []string{"uuid", "depends_on"})
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]*api.Job, 0, len(existing))
+	for _, job := range existing {
+		list = append(list, job)
+	}
+
+	return api.ValidateDependencies(jobs, list), nil
+}
+
+func (s *Server) saveReleasedJob(job *api.Job) {
+	l := s.loggerForJob(job)
+	if err := s.db.Save(job); err != nil {
+		l.Errorf("Failed to save released job: %v", err)
+		return
+	}
+
+	s.publishJobEvent(api.JobEventStatus, job)
+	l.Debugf("Released waiting job with status %s.", job.Status)
+}
@@ -0,0 +1,147 @@
+package gateway
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aklinkert/go-logging"
+
+	"github.com/scalify/puppet-master-gateway/pkg/api"
+	internalTesting "github.com/scalify/puppet-master-gateway/pkg/internal/testing"
+)
+
+func TestServer_releaseWaitingJobs(t *testing.T) {
+	q := internalTesting.NewTestQueue()
+	db := internalTesting.NewTestDB()
+	l := logging.NewTestLogger(t)
+
+	s, err := NewServer(db, q, l, "test", true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	login, _ := newTestJob(t, "login")
+	login.Status = api.JobStatusDone
+	login.Results = map[string]interface{}{"cookies": "session=1234"}
+
+	running, _ := newTestJob(t, "running")
+	running.Status = api.JobStatusRunning
+
+	failed, _ := newTestJob(t, "failed")
+	failed.Status = api.JobStatusFailed
+
+	scrape, _ := newTestJob(t, "scrape")
+	scrape.Status = api.JobStatusWaiting
+	scrape.DependsOn = []string{"login"}
+	scrape.InjectResults = true
+
+	pending, _ := newTestJob(t, "pending")
+	pending.Status = api.JobStatusWaiting
+	pending.DependsOn = []string{"login", "running"}
+
+	skipped, _ := newTestJob(t, "skipped")
+	skipped.Status = api.JobStatusWaiting
+	skipped.DependsOn = []string{"login", "failed"}
+
+	now := time.Now()
+
+	missing, _ := newTestJob(t, "missing")
+	missing.Status = api.JobStatusWaiting
+	missing.DependsOn = []string{"unknown"}
+	missing.CreatedAt = api.JSONTime{Time: now.Add(-dependencyMissingLimit)}
+
+	recent, _ := newTestJob(t, "recent")
+	recent.Status = api.JobStatusWaiting
+	recent.DependsOn = []string{"unknown"}
+	recent.CreatedAt = api.JSONTime{Time: now}
+
+	db.Jobs = []*api.Job{login, running, failed, scrape, pending, skipped, missing, recent}
+
+	s.releaseWaitingJobs(now)
+
+	if scrape.Status != api.JobStatusCreated {
+		t.Errorf("Expected job to have status %s, got %s", api.JobStatusCreated, scrape.Status)
+	}
+
+	if scrape.Vars["cookies"] != "session=1234" {
+		t.Errorf("Expected upstream results to be injected, got vars %v", scrape.Vars)
+	}
+
+	for _, job := range []*api.Job{pending, recent} {
+		if job.Status != api.JobStatusWaiting {
+			t.Errorf("Expected job %s to keep status %s, got %s", job.UUID, api.JobStatusWaiting, job.Status)
+		}
+	}
+
+	for _, job := range []*api.Job{skipped, missing} {
+		if job.Status != api.JobStatusSkipped || job.Error.Kind != api.JobErrorKindDependency {
+			t.Errorf("Expected job %s to be skipped, got status %s and error %v", job.UUID, job.Status, job.Error)
+		}
+	}
+
+	if len(db.SavedJobs) != 3 {
+		t.Errorf("Unexpected count of saved jobs: %d", len(db.SavedJobs))
+	}
+}
+
+func TestServer_releaseWaitingJobsArtifactResults(t *testing.T) {
+	q := internalTesting.NewTestQueue()
+	db := internalTesting.NewTestDB()
+	store := internalTesting.NewTestArtifactStore()
+	l := logging.NewTestLogger(t)
+
+	s, err := NewServer(db, q, l, "test", true, true, WithArtifactStore(store))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	login, _ := newTestJob(t, "login")
+	login.Status = api.JobStatusDone
+	login.Results = map[string]interface{}{
+		"cookies":    "session=1234",
+		"page":       strings.Repeat("a", api.MaxInlineResultSize),
+		"screenshot": "data:image/png;base64,cG5n",
+	}
+	if err := s.storeArtifacts(login, nil, l); err != nil {
+		t.Fatal(err)
+	}
+
+	lost, _ := newTestJob(t, "lost")
+	lost.Status = api.JobStatusDone
+	lost.Artifacts = []api.Artifact{{Name: "page.json", ContentType: api.ContentTypeJSON, Result: "page"}}
+
+	scrape, _ := newTestJob(t, "scrape")
+	scrape.Status = api.JobStatusWaiting
+	scrape.DependsOn = []string{"login"}
+	scrape.InjectResults = true
+
+	orphaned, _ := newTestJob(t, "orphaned")
+	orphaned.Status = api.JobStatusWaiting
+	orphaned.DependsOn = []string{"lost"}
+	orphaned.InjectResults = true
+
+	db.Jobs = []*api.Job{login, lost, scrape, orphaned}
+
+	s.releaseWaitingJobs(time.Now())
+
+	expected := map[string]string{
+		"cookies":    "session=1234",
+		"page":       strings.Repeat("a", api.MaxInlineResultSize),
+		"screenshot": "data:image/png;base64,cG5n",
+	}
+
+	for key, value := range expected {
+		if scrape.Vars[key] != value {
+			t.Errorf("Expected var %s to be %q, got %q", key, value, scrape.Vars[key])
+		}
+	}
+
+	if len(login.Results) != 1 {
+		t.Errorf("Expected the results of the dependency to be unchanged, got %v", login.Results)
+	}
+
+	if orphaned.Status != api.JobStatusSkipped || orphaned.Error.Kind != api.JobErrorKindDependency {
+		t.Errorf("Expected job with a lost dependency result to be skipped, got status %s and error %v", orphaned.Status, orphaned.Error)
+	}
+}
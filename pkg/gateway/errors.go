@@ -0,0 +1,84 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+
+	"github.com/aklinkert/go-logging"
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/scalify/puppet-master-gateway/pkg/api"
+	"github.com/scalify/puppet-master-gateway/pkg/database"
+)
+
+// requestIDPattern limits the request ids accepted from clients to a sane size and charset
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+// writeError writes the error as problem details response. The request id is taken from the
+// response headers, where it has been set by the requestIDMiddleware.
+func writeError(rw http.ResponseWriter, e *api.Error, logger logging.Logger) {
+	e.RequestID = rw.Header().Get(api.RequestIDHeader)
+
+	rw.Header().Set(api.ContentTypeHeader, api.ContentTypeProblem)
+	rw.WriteHeader(e.Status)
+	if err := json.NewEncoder(rw).Encode(e); err != nil {
+		logger.Errorf("Failed to encode error response: %v", err)
+	}
+}
+
+// saveError describes a failed save of the given resource, conflicting revisions or versions are
+// reported as conflict
+func saveError(resource string, err error) *api.Error {
+	if err == database.ErrConflict {
+		return api.NewError(http.StatusConflict, api.ErrorCodeConflict, "failed to save %s: %v", resource, err)
+	}
+
+	return api.NewError(http.StatusInternalServerError, api.ErrorCodeInternal, "failed to save %s: %v", resource, err)
+}
+
+// requestIDMiddleware makes sure every response carries a request id, either the one sent by the
+// client or a new one.
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		id := req.Header.Get(api.RequestIDHeader)
+		if !requestIDPattern.MatchString(id) {
+			id = uuid.NewV4().String()
+		}
+
+		rw.Header().Set(api.RequestIDHeader, id)
+		next.ServeHTTP(rw, req)
+	})
+}
+
+// timeoutMiddleware limits the time a handler may take to write its response. The handler writes
+// to a buffer with headers of its own, the request id is passed on to them. The problem content
+// type set upfront is replaced by the one of the handler if it finishes in time.
+func timeoutMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		requestID := rw.Header().Get(api.RequestIDHeader)
+		e := api.NewError(http.StatusServiceUnavailable, api.ErrorCodeTimeout, "the request took too long to process")
+		e.RequestID = requestID
+
+		// marshalling the error can not fail, it consists of plain fields only
+		body, _ := json.Marshal(e)
+
+		handler := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			rw.Header().Set(api.RequestIDHeader, requestID)
+			next.ServeHTTP(rw, req)
+		})
+
+		rw.Header().Set(api.ContentTypeHeader, api.ContentTypeProblem)
+		http.TimeoutHandler(handler, writeTimeout, string(body)).ServeHTTP(rw, req)
+	})
+}
+
+// notFoundHandler answers requests to unknown routes
+func (s *Server) notFoundHandler(rw http.ResponseWriter, req *http.Request) {
+	writeError(rw, api.NewError(http.StatusNotFound, api.ErrorCodeNotFound, "no route matches %s %s", req.Method, req.URL.Path), s.logger)
+}
+
+// methodNotAllowedHandler answers requests to known routes with an unsupported method
+func (s *Server) methodNotAllowedHandler(rw http.ResponseWriter, req *http.Request) {
+	writeError(rw, api.NewError(http.StatusMethodNotAllowed, api.ErrorCodeMethodNotAllowed, "method %s is not allowed on %s", req.Method, req.URL.Path), s.logger)
+}
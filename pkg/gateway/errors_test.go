@@ -0,0 +1,99 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aklinkert/go-logging"
+
+	"github.com/scalify/puppet-master-gateway/pkg/api"
+	internalTesting "github.com/scalify/puppet-master-gateway/pkg/internal/testing"
+)
+
+// assertErrorResponse checks that the response is a problem details error with the given code
+func assertErrorResponse(t *testing.T, rw *httptest.ResponseRecorder, code string) *api.Error {
+	t.Helper()
+
+	if contentType := rw.Header().Get(api.ContentTypeHeader); contentType != api.ContentTypeProblem {
+		t.Errorf("Unexpected content type: %q", contentType)
+	}
+
+	e := &api.Error{}
+	if err := json.Unmarshal(rw.Body.Bytes(), e); err != nil {
+		t.Fatalf("Failed to decode error response %q: %v", rw.Body.String(), err)
+	}
+
+	if e.Code != code || e.Status != rw.Code || e.Message == "" {
+		t.Errorf("Unexpected error response: %+v", e)
+	}
+
+	return e
+}
+
+func TestServerErrorResponses(t *testing.T) {
+	q := internalTesting.NewTestQueue()
+	db := internalTesting.NewTestDB()
+	l := logging.NewTestLogger(t)
+
+	s, err := NewServer(db, q, l, "test", true, false)
+	if err != nil {
+		t.Log(err)
+		t.Fatal(fmt.Sprintf("failed to start server: %v", err))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	go startServer(ctx, t, s)
+	time.Sleep(100 * time.Millisecond)
+
+	tests := []struct {
+		method, path string
+		status       int
+		code         string
+	}{
+		{http.MethodGet, "/jobs?page=0", http.StatusBadRequest, api.ErrorCodeInvalidParameter},
+		{http.MethodGet, "/jobs?per_page=many", http.StatusBadRequest, api.ErrorCodeInvalidParameter},
+		{http.MethodGet, "/jobs/unknown", http.StatusNotFound, api.ErrorCodeNotFound},
+		{http.MethodGet, "/unknown", http.StatusNotFound, api.ErrorCodeNotFound},
+		{http.MethodPut, "/jobs", http.StatusMethodNotAllowed, api.ErrorCodeMethodNotAllowed},
+	}
+
+	for _, test := range tests {
+		t.Run(test.method+" "+test.path, func(t *testing.T) {
+			req := httptest.NewRequest(test.method, test.path, nil)
+			req.Header.Set(api.RequestIDHeader, "test-request")
+			addAPITokenHeader(req, "test")
+			rw := httptest.NewRecorder()
+			s.srv.Handler.ServeHTTP(rw, req)
+
+			if rw.Code != test.status {
+				t.Errorf("Unexpected http response: %v", rw.Result().Status)
+			}
+
+			e := assertErrorResponse(t, rw, test.code)
+			if e.RequestID != "test-request" || rw.Header().Get(api.RequestIDHeader) != "test-request" {
+				t.Errorf("Expected request id of the request, got %q", e.RequestID)
+			}
+		})
+	}
+}
+
+func TestRequestIDMiddleware(t *testing.T) {
+	h := requestIDMiddleware(&testHandler{})
+
+	for _, id := range []string{"", "invalid request id"} {
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.Header.Set(api.RequestIDHeader, id)
+		rw := httptest.NewRecorder()
+		h.ServeHTTP(rw, req)
+
+		if generated := rw.Header().Get(api.RequestIDHeader); generated == "" || generated == id {
+			t.Errorf("Expected a generated request id for %q, got %q", id, generated)
+		}
+	}
+}
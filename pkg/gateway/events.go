@@ -0,0 +1,277 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/streadway/amqp"
+
+	"github.com/scalify/puppet-master-gateway/pkg/api"
+)
+
+const (
+	eventConsumerTag       = "gateway-job-events"
+	eventBufferSize        = 32
+	eventHeartbeatInterval = 10 * time.Second
+	contentTypeEventStream = "text/event-stream"
+)
+
+// jobEventBroker fans out job events to all subscribed event streams of this process
+type jobEventBroker struct {
+	mu          sync.RWMutex
+	subscribers map[chan *api.JobEvent]string
+	closed      bool
+}
+
+func newJobEventBroker() *jobEventBroker {
+	return &jobEventBroker{
+		subscribers: make(map[chan *api.JobEvent]string),
+	}
+}
+
+// subscribe returns a channel receiving the events of the job with the given id, or of all jobs
+// if id is empty. The channel is closed when the broker is closed.
+func (b *jobEventBroker) subscribe(jobID string) chan *api.JobEvent {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch := make(chan *api.JobEvent, eventBufferSize)
+	if b.closed {
+		close(ch)
+		return ch
+	}
+
+	b.subscribers[ch] = jobID
+	return ch
+}
+
+func (b *jobEventBroker) unsubscribe(ch chan *api.JobEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.subscribers[ch]; ok {
+		delete(b.subscribers, ch)
+		close(ch)
+	}
+}
+
+// publish sends the event to all matching subscribers, slow subscribers miss the event
+// instead of blocking the job processing.
+func (b *jobEventBroker) publish(event *api.JobEvent) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for ch, jobID := range b.subscribers {
+		if jobID != "" && jobID != event.UUID {
+			continue
+		}
+
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+func (b *jobEventBroker) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for ch := range b.subscribers {
+		delete(b.subscribers, ch)
+		close(ch)
+	}
+}
+
+// publishJobEvent notifies the event streams about a change of the job
+func (s *Server) publishJobEvent(eventType string, job *api.Job) {
+	data := *job
+	data.ClearPrivateFields()
+
+	s.sendJobEvent(&api.JobEvent{
+		Type: eventType,
+		UUID: job.UUID,
+		Time: api.JSONTime{Time: time.Now()},
+		Data: &data,
+	})
+}
+
+// publishJobLogEvent notifies the event streams about new log lines of the job
+func (s *Server) publishJobLogEvent(jobID string, offset int, logs []api.Log) {
+	s.sendJobEvent(&api.JobEvent{
+		Type:   api.JobEventLog,
+		UUID:   jobID,
+		Time:   api.JSONTime{Time: time.Now()},
+		Logs:   logs,
+		Offset: offset,
+	})
+}
+
+// sendJobEvent publishes the event to the job events exchange, which fans it out to the event
+// streams of all gateways serving the api, this one included. Gateways processing jobs and
+// gateways serving the api may run in separate processes therefore. If publishing fails the
+// event only reaches the event streams of this gateway.
+func (s *Server) sendJobEvent(event *api.JobEvent) {
+	b, err := json.Marshal(event)
+	if err == nil {
+		err = s.queue.Publish(api.ExchangeNameJobEvents, "", false, false, amqp.Publishing{
+			ContentType: api.ContentTypeJSON,
+			Body:        b,
+		})
+	}
+
+	if err != nil {
+		s.logger.Errorf("Failed to publish job event: %v", err)
+		s.events.publish(event)
+	}
+}
+
+// bindJobEvents declares the queue receiving the job events of all gateways. Every gateway serving
+// the api has an exclusive queue of its own, which is deleted along with the connection, so events
+// sent while a gateway is down never reach it.
+func (s *Server) bindJobEvents() (string, error) {
+	q, err := s.queue.QueueDeclare("", false, true, true, false, nil)
+	if err != nil {
+		return "", fmt.Errorf("unable to create job events queue: %v", err)
+	}
+
+	if err := s.queue.QueueBind(q.Name, "", api.ExchangeNameJobEvents, false, nil); err != nil {
+		return "", fmt.Errorf("unable to bind job events queue %s: %v", q.Name, err)
+	}
+
+	return q.Name, nil
+}
+
+// consumeJobEvents passes the events of all gateways to the event streams of this gateway. Events
+// are acked on delivery, like the streams a lost event is not delivered again.
+func (s *Server) consumeJobEvents(ctx context.Context, queueName string) {
+	consumer, err := s.queue.Consume(queueName, eventConsumerTag, true, true, false, false, nil)
+	if err != nil {
+		s.logger.Fatalf("Failed to create job events consumer: %v", err)
+		return
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-consumer:
+			if !ok {
+				return
+			}
+
+			event := &api.JobEvent{}
+			if err := json.Unmarshal(msg.Body, event); err != nil || event.Type == "" {
+				s.logger.Errorf("Dropping invalid job event: %q", msg.Body)
+				continue
+			}
+
+			s.events.publish(event)
+		}
+	}
+}
+
+// StreamJobEvents streams the changes of all jobs as server-sent events
+func (s *Server) StreamJobEvents(rw http.ResponseWriter, req *http.Request) {
+	s.streamJobEvents(rw, req, "")
+}
+
+// StreamJobEventsByID streams the changes of a single job as server-sent events
+func (s *Server) StreamJobEventsByID(rw http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	jobID := vars["id"]
+
+	job, ok := s.loadJob(rw, jobID, s.loggerForJobID(jobID))
+	if !ok {
+		return
+	}
+
+	s.streamJobEvents(rw, req, job.UUID)
+}
+
+func (s *Server) streamJobEvents(rw http.ResponseWriter, req *http.Request, jobID string) {
+	events := s.events.subscribe(jobID)
+	defer s.events.unsubscribe(events)
+
+	stream, ok := newEventStream(rw)
+	if !ok {
+		s.logger.Errorf("Response writer does not support streaming")
+		writeError(rw, api.NewError(http.StatusInternalServerError, api.ErrorCodeInternal, "the response can not be streamed"), s.logger)
+		return
+	}
+
+	heartbeat := time.NewTicker(eventHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case <-heartbeat.C:
+			if err := stream.heartbeat(); err != nil {
+				return
+			}
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+
+			if err := stream.send(event); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// eventStream writes server-sent events to a client
+type eventStream struct {
+	rw      http.ResponseWriter
+	flusher http.Flusher
+}
+
+// newEventStream writes the event stream headers, it returns false if the response writer
+// is not able to stream.
+func newEventStream(rw http.ResponseWriter) (*eventStream, bool) {
+	flusher, ok := rw.(http.Flusher)
+	if !ok {
+		return nil, false
+	}
+
+	rw.Header().Set(api.ContentTypeHeader, contentTypeEventStream)
+	rw.Header().Set("Cache-Control", "no-cache")
+	rw.Header().Set("Connection", "keep-alive")
+	rw.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	return &eventStream{rw: rw, flusher: flusher}, true
+}
+
+func (e *eventStream) send(event *api.JobEvent) error {
+	b, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintf(e.rw, "event: %s\ndata: %s\n\n", event.Type, b); err != nil {
+		return err
+	}
+
+	e.flusher.Flush()
+	return nil
+}
+
+// heartbeat sends a comment to keep the connection open
+func (e *eventStream) heartbeat() error {
+	if _, err := fmt.Fprint(e.rw, ": heartbeat\n\n"); err != nil {
+		return err
+	}
+
+	e.flusher.Flush()
+	return nil
+}
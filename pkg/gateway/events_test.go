@@ -0,0 +1,106 @@
+package gateway
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aklinkert/go-logging"
+
+	"github.com/scalify/puppet-master-gateway/pkg/api"
+	internalTesting "github.com/scalify/puppet-master-gateway/pkg/internal/testing"
+)
+
+func TestJobEventBroker(t *testing.T) {
+	b := newJobEventBroker()
+	all := b.subscribe("")
+	single := b.subscribe("asdf-1234-asdf-1234")
+
+	b.publish(&api.JobEvent{Type: api.JobEventStatus, UUID: "asdf-1234-asdf-1234"})
+	b.publish(&api.JobEvent{Type: api.JobEventStatus, UUID: "asdf-5678-asdf-5678"})
+
+	if len(all) != 2 {
+		t.Errorf("Expected 2 events for all jobs, got %d", len(all))
+	}
+
+	if len(single) != 1 {
+		t.Errorf("Expected 1 event for a single job, got %d", len(single))
+	}
+
+	b.unsubscribe(single)
+	b.close()
+
+	<-all
+	<-all
+	if _, ok := <-all; ok {
+		t.Errorf("Expected subscriptions to be closed with the broker")
+	}
+
+	if _, ok := <-b.subscribe(""); ok {
+		t.Errorf("Expected subscriptions on a closed broker to be closed")
+	}
+}
+
+func TestServerStreamJobEvents(t *testing.T) {
+	q := internalTesting.NewTestQueue()
+	db := internalTesting.NewTestDB()
+	l := logging.NewTestLogger(t)
+
+	s, err := NewServer(db, q, l, "test", true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	go startServer(ctx, t, s)
+	time.Sleep(100 * time.Millisecond)
+
+	job, _ := newTestJob(t, "asdf-1234-asdf-1234")
+	db.Jobs = append(db.Jobs, job)
+
+	srv := httptest.NewServer(s.srv.Handler)
+	defer srv.Close()
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL+"/jobs/asdf-1234-asdf-1234/events", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addAPITokenHeader(req, "test")
+
+	res, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	if res.Header.Get(api.ContentTypeHeader) != contentTypeEventStream {
+		t.Fatalf("Unexpected content type %q", res.Header.Get(api.ContentTypeHeader))
+	}
+
+	job.Status = api.JobStatusQueued
+	s.publishJobEvent(api.JobEventStatus, job)
+
+	reader := bufio.NewReader(res.Body)
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if line != "event: status\n" {
+		t.Errorf("Unexpected event line %q", line)
+	}
+
+	line, err = reader.ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(line, "data: ") || !strings.Contains(line, `"status":"queued"`) {
+		t.Errorf("Unexpected data line %q", line)
+	}
+}
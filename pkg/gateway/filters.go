@@ -0,0 +1,153 @@
+package gateway
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/scalify/puppet-master-gateway/pkg/api"
+	"github.com/scalify/puppet-master-gateway/pkg/database"
+)
+
+// newJobQuery reads the filters and the sort of a job list from the query params of the request
+// nolint: gocyclo
+func newJobQuery(req *http.Request, page, perPage int) (*database.JobQuery, error) {
+	params := req.URL.Query()
+	q := &database.JobQuery{
+		Page:     page,
+		PerPage:  perPage,
+		Bookmark: params.Get("cursor"),
+	}
+
+	q.Status = params.Get("status")
+	q.BatchID = params.Get("batch_id")
+	q.Search = params.Get("q")
+
+	times := []struct {
+		param string
+		value **time.Time
+	}{
+		{"created_since", &q.CreatedSince},
+		{"created_until", &q.CreatedUntil},
+		{"started_since", &q.StartedSince},
+		{"started_until", &q.StartedUntil},
+		{"finished_since", &q.FinishedSince},
+		{"finished_until", &q.FinishedUntil},
+	}
+
+	for _, t := range times {
+		str := params.Get(t.param)
+		if str == "" {
+			continue
+		}
+
+		value, err := time.Parse(time.RFC3339, str)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s parameter: %v", t.param, err)
+		}
+		*t.value = &value
+	}
+
+	durations := []struct {
+		param string
+		value **int
+	}{
+		{"min_duration", &q.MinDuration},
+		{"max_duration", &q.MaxDuration},
+	}
+
+	for _, d := range durations {
+		str := params.Get(d.param)
+		if str == "" {
+			continue
+		}
+
+		value, err := strconv.Atoi(str)
+		if err != nil || value < 0 {
+			return nil, fmt.Errorf("invalid %s parameter: must be a duration in milliseconds, got %q", d.param, str)
+		}
+		*d.value = &value
+	}
+
+	if str := params.Get("has_error"); str != "" {
+		value, err := strconv.ParseBool(str)
+		if err != nil {
+			return nil, fmt.Errorf("invalid has_error parameter: must be true or false, got %q", str)
+		}
+		q.HasError = &value
+	}
+
+	for _, str := range params["label"] {
+		key, value, err := parseLabelSelector(str)
+		if err != nil {
+			return nil, err
+		}
+
+		if q.Labels == nil {
+			q.Labels = make(map[string]string)
+		}
+		q.Labels[key] = value
+	}
+
+	q.Fields = api.JobSummaryFields
+	if str := params.Get("fields"); str != "" {
+		fields, err := api.ParseJobFields(str)
+		if err != nil {
+			return nil, fmt.Errorf("invalid fields parameter: %v", err)
+		}
+		q.Fields = fields
+	}
+
+	if str := params.Get("sort"); str != "" {
+		sort, err := parseJobSort(str)
+		if err != nil {
+			return nil, err
+		}
+		q.Sort = sort
+	}
+
+	return q, nil
+}
+
+// parseJobSort parses a sort given as field and optional direction, like created_at:desc
+func parseJobSort(str string) (*database.JobSort, error) {
+	parts := strings.SplitN(str, ":", 2)
+	sort := &database.JobSort{Field: parts[0]}
+
+	valid := false
+	for _, field := range database.JobSortFields {
+		valid = valid || field == sort.Field
+	}
+
+	if !valid {
+		return nil, fmt.Errorf("invalid sort parameter: the field must be one of %s, got %q", strings.Join(database.JobSortFields, ", "), sort.Field)
+	}
+
+	if len(parts) == 2 {
+		switch parts[1] {
+		case "asc":
+		case "desc":
+			sort.Descending = true
+		default:
+			return nil, fmt.Errorf("invalid sort parameter: the direction must be asc or desc, got %q", parts[1])
+		}
+	}
+
+	return sort, nil
+}
+
+// parseLabelSelector parses a label selector given as key and value, like team=growth
+func parseLabelSelector(str string) (string, string, error) {
+	parts := strings.SplitN(str, "=", 2)
+	if len(parts) != 2 {
+		return "", "", fmt.Errorf("invalid label parameter: must be given as key=value, got %q", str)
+	}
+
+	if err := api.ValidateLabel(parts[0], parts[1]); err != nil {
+		return "", "", fmt.Errorf("invalid label parameter: %v", err)
+	}
+
+	return parts[0], parts[1], nil
+}
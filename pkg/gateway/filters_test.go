@@ -0,0 +1,136 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aklinkert/go-logging"
+
+	"github.com/scalify/puppet-master-gateway/pkg/api"
+	"github.com/scalify/puppet-master-gateway/pkg/database"
+	internalTesting "github.com/scalify/puppet-master-gateway/pkg/internal/testing"
+)
+
+func TestNewJobQuery(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/jobs?status=done&created_since=2020-01-01T00:00:00Z&min_duration=500&has_error=false&q=goto&label=team=growth&label=env=a=b&sort=created_at:desc", nil)
+	q, err := newJobQuery(req, 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if q.Status != api.JobStatusDone || q.Search != "goto" || q.Page != 1 || q.PerPage != 10 {
+		t.Errorf("Unexpected query: %+v", q)
+	}
+
+	if q.CreatedSince == nil || !q.CreatedSince.Equal(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)) || q.CreatedUntil != nil {
+		t.Errorf("Unexpected created range: %v - %v", q.CreatedSince, q.CreatedUntil)
+	}
+
+	if q.MinDuration == nil || *q.MinDuration != 500 || q.MaxDuration != nil {
+		t.Errorf("Unexpected durations: %v - %v", q.MinDuration, q.MaxDuration)
+	}
+
+	if q.HasError == nil || *q.HasError {
+		t.Errorf("Unexpected has_error: %v", q.HasError)
+	}
+
+	if !reflect.DeepEqual(q.Labels, map[string]string{"team": "growth", "env": "a=b"}) {
+		t.Errorf("Unexpected labels: %v", q.Labels)
+	}
+
+	if q.Sort == nil || *q.Sort != (database.JobSort{Field: database.JobSortCreatedAt, Descending: true}) {
+		t.Errorf("Unexpected sort: %+v", q.Sort)
+	}
+
+	for _, params := range []string{"created_since=yesterday", "max_duration=-1", "has_error=maybe", "label=team", "label=te.am=growth", "sort=code", "sort=created_at:up"} {
+		req := httptest.NewRequest(http.MethodGet, "/jobs?"+params, nil)
+		if _, err := newJobQuery(req, 1, 10); err == nil {
+			t.Errorf("Expected %s to be invalid", params)
+		}
+	}
+}
+
+func TestServerGetJobsFiltered(t *testing.T) {
+	q := internalTesting.NewTestQueue()
+	db := internalTesting.NewTestDB()
+	l := logging.NewTestLogger(t)
+
+	s, err := NewServer(db, q, l, "test", true, true)
+	if err != nil {
+		t.Log(err)
+		t.Fatal(fmt.Sprintf("failed to start server: %v", err))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	go startServer(ctx, t, s)
+	time.Sleep(100 * time.Millisecond)
+
+	for i := 0; i < 4; i++ {
+		job, _ := newTestJob(t, fmt.Sprintf("job-%d", i))
+		job.CreatedAt = api.JSONTime{Time: testTime.Add(time.Duration(i) * time.Hour)}
+		job.Duration = i * 1000
+		if i%2 == 1 {
+			job.Error = &api.JobError{Kind: api.JobErrorKindUnknown, Message: "failed"}
+		}
+		db.Jobs = append(db.Jobs, job)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/jobs?has_error=false&min_duration=1&sort=created_at:desc", nil)
+	addAPITokenHeader(req, "test")
+	rw := httptest.NewRecorder()
+	s.srv.Handler.ServeHTTP(rw, req)
+
+	if rw.Code != 200 {
+		t.Fatalf("Unexpected http response: %v", rw.Result().Status)
+	}
+
+	t.Logf("GetJobs response: %q", rw.Body.String())
+
+	response := &api.JobsResponse{}
+	if err := json.Unmarshal(rw.Body.Bytes(), response); err != nil {
+		t.Fatalf("Failed to decode response body: %v", err)
+	}
+
+	if len(response.Data) != 1 || response.Data[0].UUID != "job-2" {
+		t.Errorf("Unexpected jobs: %+v", response.Data)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/jobs?sort=code", nil)
+	addAPITokenHeader(req, "test")
+	rw = httptest.NewRecorder()
+	s.srv.Handler.ServeHTTP(rw, req)
+
+	if rw.Code != http.StatusBadRequest {
+		t.Errorf("Unexpected http response: %v", rw.Result().Status)
+	}
+
+	assertErrorResponse(t, rw, api.ErrorCodeInvalidParameter)
+
+	db.Jobs[1].Labels = map[string]string{"team": "growth", "env": "prod"}
+	db.Jobs[3].Labels = map[string]string{"team": "growth", "env": "dev"}
+
+	req = httptest.NewRequest(http.MethodGet, "/jobs?label=team=growth&label=env=prod", nil)
+	addAPITokenHeader(req, "test")
+	rw = httptest.NewRecorder()
+	s.srv.Handler.ServeHTTP(rw, req)
+
+	if rw.Code != 200 {
+		t.Fatalf("Unexpected http response: %v", rw.Result().Status)
+	}
+
+	response = &api.JobsResponse{}
+	if err := json.Unmarshal(rw.Body.Bytes(), response); err != nil {
+		t.Fatalf("Failed to decode response body: %v", err)
+	}
+
+	if len(response.Data) != 1 || response.Data[0].UUID != "job-1" {
+		t.Errorf("Unexpected jobs: %+v", response.Data)
+	}
+}
@@ -0,0 +1,172 @@
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/scalify/puppet-master-gateway/pkg/api"
+)
+
+// logFilter selects log lines by time and level
+type logFilter struct {
+	since  *time.Time
+	levels map[string]bool
+}
+
+func newLogFilter(req *http.Request) (*logFilter, error) {
+	f := &logFilter{}
+	query := req.URL.Query()
+
+	if since := query.Get("since"); since != "" {
+		t, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			return nil, fmt.Errorf("invalid since parameter: %v", err)
+		}
+		f.since = &t
+	}
+
+	if levels := query.Get("level"); levels != "" {
+		f.levels = make(map[string]bool)
+		for _, level := range strings.Split(levels, ",") {
+			f.levels[strings.TrimSpace(level)] = true
+		}
+	}
+
+	return f, nil
+}
+
+func (f *logFilter) filter(logs []api.Log) []api.Log {
+	filtered := make([]api.Log, 0, len(logs))
+	for _, l := range logs {
+		if f.since != nil && l.Time.Before(*f.since) {
+			continue
+		}
+
+		if f.levels != nil && !f.levels[l.Level] {
+			continue
+		}
+
+		filtered = append(filtered, l)
+	}
+
+	return filtered
+}
+
+// GetJobLogs returns the logs of a job, with follow=true the logs are streamed as server-sent events
+// until the job is finished.
+func (s *Server) GetJobLogs(rw http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	jobID := vars["id"]
+	logger := s.loggerForJobID(jobID)
+
+	filter, err := newLogFilter(req)
+	if err != nil {
+		logger.Debugf("Invalid log filter: %v", err)
+		writeError(rw, api.NewError(http.StatusBadRequest, api.ErrorCodeInvalidParameter, "invalid log filter: %v", err), logger)
+		return
+	}
+
+	follow := req.URL.Query().Get("follow") == "true"
+
+	var events chan *api.JobEvent
+	if follow {
+		// subscribe before loading the job to not miss any lines in between
+		events = s.events.subscribe(jobID)
+		defer s.events.unsubscribe(events)
+	}
+
+	job, ok := s.loadJob(rw, jobID, logger)
+	if !ok {
+		return
+	}
+	logger = s.loggerForJob(job)
+
+	logs := filter.filter(job.Logs)
+	if !follow {
+		rw.Header().Add(api.ContentTypeHeader, api.ContentTypeJSON)
+		if err := json.NewEncoder(rw).Encode(&api.LogsResponse{Data: logs}); err != nil {
+			logger.Errorf("Failed to encode logs: %v", err)
+		}
+		return
+	}
+
+	s.followJobLogs(rw, req, job, logs, filter, events)
+}
+
+func (s *Server) followJobLogs(rw http.ResponseWriter, req *http.Request, job *api.Job, logs []api.Log, filter *logFilter, events chan *api.JobEvent) {
+	stream, ok := newEventStream(rw)
+	if !ok {
+		s.logger.Errorf("Response writer does not support streaming")
+		writeError(rw, api.NewError(http.StatusInternalServerError, api.ErrorCodeInternal, "the response can not be streamed"), s.logger)
+		return
+	}
+
+	if err := stream.send(&api.JobEvent{Type: api.JobEventLog, UUID: job.UUID, Time: api.JSONTime{Time: time.Now()}, Logs: logs}); err != nil {
+		return
+	}
+
+	if job.IsFinished() {
+		return
+	}
+
+	// the lines of the job have been sent already, events received before the job was loaded may
+	// repeat some of them
+	sent := len(job.Logs)
+
+	heartbeat := time.NewTicker(eventHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case <-heartbeat.C:
+			if err := stream.heartbeat(); err != nil {
+				return
+			}
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+
+			switch event.Type {
+			case api.JobEventLog:
+				logs := unsentLogs(event, sent)
+				if end := event.Offset + len(event.Logs); end > sent {
+					sent = end
+				}
+
+				if logs := filter.filter(logs); len(logs) > 0 {
+					if err := stream.send(&api.JobEvent{Type: event.Type, UUID: event.UUID, Time: event.Time, Logs: logs}); err != nil {
+						return
+					}
+				}
+			case api.JobEventDeleted:
+				return
+			default:
+				if event.Data != nil && event.Data.IsFinished() {
+					return
+				}
+			}
+		}
+	}
+}
+
+// unsentLogs returns the lines of the log event that are beyond the first sent lines of the job
+func unsentLogs(event *api.JobEvent, sent int) []api.Log {
+	skip := sent - event.Offset
+	if skip <= 0 {
+		return event.Logs
+	}
+
+	if skip >= len(event.Logs) {
+		return nil
+	}
+
+	return event.Logs[skip:]
+}
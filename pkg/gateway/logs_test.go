@@ -0,0 +1,121 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aklinkert/go-logging"
+
+	"github.com/scalify/puppet-master-gateway/pkg/api"
+	internalTesting "github.com/scalify/puppet-master-gateway/pkg/internal/testing"
+)
+
+func TestServerGetJobLogs(t *testing.T) {
+	q := internalTesting.NewTestQueue()
+	db := internalTesting.NewTestDB()
+	l := logging.NewTestLogger(t)
+
+	s, err := NewServer(db, q, l, "test", true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	go startServer(ctx, t, s)
+	time.Sleep(100 * time.Millisecond)
+
+	start := time.Date(2020, 3, 1, 10, 0, 0, 0, time.UTC)
+	job, _ := newTestJob(t, "asdf-1234-asdf-1234")
+	job.Logs = []api.Log{
+		{Time: api.JSONTime{Time: start}, Level: "info", Message: "first"},
+		{Time: api.JSONTime{Time: start.Add(time.Minute)}, Level: "debug", Message: "second"},
+		{Time: api.JSONTime{Time: start.Add(2 * time.Minute)}, Level: "error", Message: "third"},
+	}
+	db.Jobs = append(db.Jobs, job)
+
+	tests := []struct {
+		name, query string
+		code        int
+		messages    []string
+	}{
+		{"all", "", 200, []string{"first", "second", "third"}},
+		{"level", "?level=info,error", 200, []string{"first", "third"}},
+		{"since", "?since=2020-03-01T10:01:00Z", 200, []string{"second", "third"}},
+		{"invalid since", "?since=yesterday", 400, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/jobs/asdf-1234-asdf-1234/logs"+test.query, nil)
+			addAPITokenHeader(req, "test")
+			rw := httptest.NewRecorder()
+			s.srv.Handler.ServeHTTP(rw, req)
+
+			if rw.Code != test.code {
+				t.Fatalf("Unexpected http response: %v", rw.Result().Status)
+			}
+
+			if test.code != 200 {
+				return
+			}
+
+			logs := &api.LogsResponse{}
+			if err := json.Unmarshal(rw.Body.Bytes(), logs); err != nil {
+				t.Fatalf("Failed to decode response body: %v", err)
+			}
+
+			if len(logs.Data) != len(test.messages) {
+				t.Fatalf("Expected %d log lines, got %d", len(test.messages), len(logs.Data))
+			}
+
+			for i, message := range test.messages {
+				if logs.Data[i].Message != message {
+					t.Errorf("Expected log line %q, got %q", message, logs.Data[i].Message)
+				}
+			}
+		})
+	}
+}
+
+func TestUnsentLogs(t *testing.T) {
+	now := api.JSONTime{Time: time.Date(2020, 3, 1, 10, 0, 0, 0, time.UTC)}
+	event := &api.JobEvent{
+		Type:   api.JobEventLog,
+		Offset: 2,
+		Logs: []api.Log{
+			{Time: now, Level: "info", Message: "third"},
+			{Time: now, Level: "info", Message: "fourth"},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		sent     int
+		messages []string
+	}{
+		{"all sent", 4, nil},
+		{"partially sent", 3, []string{"fourth"}},
+		{"nothing sent", 2, []string{"third", "fourth"}},
+		{"gap", 1, []string{"third", "fourth"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			logs := unsentLogs(event, test.sent)
+			if len(logs) != len(test.messages) {
+				t.Fatalf("Expected %d log lines, got %+v", len(test.messages), logs)
+			}
+
+			for i, message := range test.messages {
+				if logs[i].Message != message {
+					t.Errorf("Expected log line %q, got %q", message, logs[i].Message)
+				}
+			}
+		})
+	}
+}
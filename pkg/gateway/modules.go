@@ -0,0 +1,141 @@
+package gateway
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/aklinkert/go-logging"
+
+	"github.com/scalify/puppet-master-gateway/pkg/api"
+	"github.com/scalify/puppet-master-gateway/pkg/database"
+)
+
+func (s *Server) loggerForModule(name string) logging.Logger {
+	return s.loggerWithField(api.LogFieldModule, name)
+}
+
+func (s *Server) moduleResource() *versionedResource {
+	return &versionedResource{
+		kind:    "module",
+		db:      s.moduleDB,
+		newDoc:  func() api.Versioned { return &api.Module{} },
+		logger:  s.loggerForModule,
+		prepare: func(doc api.Versioned) { doc.(*api.Module).SetHash() },
+	}
+}
+
+// CreateModule validates a module and stores it as the next version of the module with its name
+func (s *Server) CreateModule(rw http.ResponseWriter, req *http.Request) {
+	s.createVersion(rw, req, s.moduleResource())
+}
+
+// GetModules returns a paginated list of all versions of all modules
+func (s *Server) GetModules(rw http.ResponseWriter, req *http.Request) {
+	s.getVersions(rw, req, s.moduleResource())
+}
+
+// GetModule returns the requested version of a module, the latest one if no version is given
+func (s *Server) GetModule(rw http.ResponseWriter, req *http.Request) {
+	s.getVersion(rw, req, s.moduleResource())
+}
+
+// moduleCache keeps module versions that have been loaded before, as they never change
+type moduleCache struct {
+	mu      sync.RWMutex
+	modules map[string]*api.Module
+}
+
+func newModuleCache() *moduleCache {
+	return &moduleCache{
+		modules: make(map[string]*api.Module),
+	}
+}
+
+func (c *moduleCache) get(id string) (*api.Module, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	module, ok := c.modules[id]
+	return module, ok
+}
+
+func (c *moduleCache) set(id string, module *api.Module) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.modules[id] = module
+}
+
+// A moduleRefError is returned when a module reference of a job can never be resolved
+type moduleRefError struct {
+	message string
+}
+
+func (e *moduleRefError) Error() string {
+	return e.message
+}
+
+// resolveModules returns the inline modules of the job together with the sources of all modules
+// it references
+func (s *Server) resolveModules(job *api.Job) (map[string]string, error) {
+	if len(job.ModuleRefs) == 0 {
+		return job.Modules, nil
+	}
+
+	if s.moduleDB == nil {
+		return nil, &moduleRefError{"the job references modules, but the module registry is not enabled"}
+	}
+
+	modules := make(map[string]string, len(job.Modules)+len(job.ModuleRefs))
+	for name, source := range job.Modules {
+		modules[name] = source
+	}
+
+	for _, ref := range job.ModuleRefs {
+		name, version, err := api.ParseModuleRef(ref)
+		if err != nil {
+			return nil, &moduleRefError{err.Error()}
+		}
+
+		if _, ok := modules[name]; ok {
+			return nil, &moduleRefError{fmt.Sprintf("the module %s is defined more than once", name)}
+		}
+
+		module, err := s.getModuleVersion(name, version)
+		if err == database.ErrNotFound {
+			return nil, &moduleRefError{fmt.Sprintf("the module %s does not exist", ref)}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to load module %s: %v", ref, err)
+		}
+
+		modules[name] = module.Source
+	}
+
+	return modules, nil
+}
+
+// getModuleVersion returns the given version of the module, or its latest one if version is 0
+func (s *Server) getModuleVersion(name string, version int) (*api.Module, error) {
+	module := &api.Module{}
+	if version == 0 {
+		if err := s.moduleDB.GetLatest(name, module); err != nil {
+			return nil, err
+		}
+
+		return module, nil
+	}
+
+	id := api.VersionedID(name, version)
+	if cached, ok := s.modules.get(id); ok {
+		return cached, nil
+	}
+
+	if err := s.moduleDB.GetVersion(name, version, module); err != nil {
+		return nil, err
+	}
+
+	s.modules.set(id, module)
+	return module, nil
+}
@@ -0,0 +1,134 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aklinkert/go-logging"
+
+	"github.com/scalify/puppet-master-gateway/pkg/api"
+	internalTesting "github.com/scalify/puppet-master-gateway/pkg/internal/testing"
+)
+
+func newTestModule(version int) *api.Module {
+	return &api.Module{
+		VersionMeta: api.VersionMeta{UUID: api.VersionedID("helper", version), Name: "helper", Version: version},
+		Source:      fmt.Sprintf("export default %d", version),
+	}
+}
+
+func TestServerCreateModule(t *testing.T) {
+	q := internalTesting.NewTestQueue()
+	db := internalTesting.NewTestDB()
+	moduleDB := internalTesting.NewTestVersionDB()
+	l := logging.NewTestLogger(t)
+
+	s, err := NewServer(db, q, l, "test", true, false, WithModuleDB(moduleDB))
+	if err != nil {
+		t.Log(err)
+		t.Fatal(fmt.Sprintf("failed to start server: %v", err))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	go startServer(ctx, t, s)
+	time.Sleep(100 * time.Millisecond)
+
+	moduleDB.Docs = append(moduleDB.Docs, newTestModule(1))
+
+	req := httptest.NewRequest(http.MethodPost, "/modules", bytes.NewBufferString(`{"name":"helper","source":"export default 2"}`))
+	addAPITokenHeader(req, "test")
+	rw := httptest.NewRecorder()
+	s.srv.Handler.ServeHTTP(rw, req)
+
+	if rw.Code != 201 {
+		t.Errorf("Unexpected http response: %v", rw.Result().Status)
+	}
+
+	t.Logf("CreateModule response: %q", rw.Body.String())
+
+	if len(moduleDB.Saved) != 1 {
+		t.Fatalf("Unexpected count of saved modules: %d", len(moduleDB.Saved))
+	}
+
+	if saved := moduleDB.Saved[0].(*api.Module); saved.UUID != "helper@2" || saved.Hash == "" {
+		t.Errorf("Expected the next version to be saved with its hash, got %+v", saved)
+	}
+}
+
+func TestServer_publishNewJobModuleRefs(t *testing.T) {
+	q := internalTesting.NewTestQueue()
+	db := internalTesting.NewTestDB()
+	moduleDB := internalTesting.NewTestVersionDB()
+	l := logging.NewTestLogger(t)
+
+	s, err := NewServer(db, q, l, "test", true, true, WithModuleDB(moduleDB))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	moduleDB.Docs = append(moduleDB.Docs, newTestModule(1), newTestModule(2))
+
+	pinned, _ := newTestJob(t, "pinned")
+	pinned.ModuleRefs = []string{"helper@1"}
+
+	latest, _ := newTestJob(t, "latest")
+	latest.ModuleRefs = []string{"helper"}
+
+	for _, job := range []*api.Job{pinned, latest} {
+		if err := s.publishNewJob(job); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := []string{"export default 1", "export default 2"}
+	for i, msg := range q.Messages {
+		published := api.NewJob()
+		if err := json.Unmarshal(msg, published); err != nil {
+			t.Fatal(err)
+		}
+
+		if published.Modules["helper"] != expected[i] || published.Modules["1234"] == "" || len(published.ModuleRefs) != 0 {
+			t.Errorf("Unexpected published modules: %v, refs %v", published.Modules, published.ModuleRefs)
+		}
+	}
+
+	if len(pinned.Modules) != 1 {
+		t.Errorf("Expected stored job to keep its inline modules only, got %v", pinned.Modules)
+	}
+}
+
+func TestServer_produceJobsMissingModule(t *testing.T) {
+	q := internalTesting.NewTestQueue()
+	db := internalTesting.NewTestDB()
+	moduleDB := internalTesting.NewTestVersionDB()
+	l := logging.NewTestLogger(t)
+
+	s, err := NewServer(db, q, l, "test", true, true, WithModuleDB(moduleDB))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job, _ := newTestJob(t, "asdf-1234-asdf-1234")
+	job.Status = api.JobStatusCreated
+	job.ModuleRefs = []string{"unknown@1"}
+	db.Jobs = []*api.Job{job}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1500*time.Millisecond)
+	defer cancel()
+	s.produceJobs(ctx)
+
+	if len(q.Messages) != 0 {
+		t.Fatalf("Unexpected count of published jobs: %d", len(q.Messages))
+	}
+
+	if job.Status != api.JobStatusFailed || job.Error.Kind != api.JobErrorKindModule {
+		t.Errorf("Expected job to fail with a module error, got status %s and error %v", job.Status, job.Error)
+	}
+}
@@ -0,0 +1,271 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/scalify/puppet-master-gateway/pkg/api"
+	"github.com/scalify/puppet-master-gateway/pkg/database"
+)
+
+const (
+	orchestratorInterval = 10 * time.Second
+	orchestratorPerPage  = 100
+	workflowRunsBuffer   = 100
+)
+
+// workflowStepJobUUID derives the job UUID from the run and the step, so that a step is never
+// started twice, even with multiple gateways advancing the same run.
+func workflowStepJobUUID(runID, step string) string {
+	name := fmt.Sprintf("https://puppet-master.io/workflow-runs/%s/%s", runID, step)
+	return uuid.NewV5(uuid.NamespaceURL, name).String()
+}
+
+// notifyWorkflowRun lets the orchestrator advance the workflow run of the job, if it belongs to one
+func (s *Server) notifyWorkflowRun(job *api.Job) {
+	if job.WorkflowRunID == "" || s.workflowDB == nil {
+		return
+	}
+
+	select {
+	case s.workflowRuns <- job.WorkflowRunID:
+	default:
+		// the orchestrator is busy, its next sweep picks the run up
+	}
+}
+
+// orchestrateWorkflows advances workflow runs whenever one of their jobs changed and
+// periodically sweeps all running ones, to catch up with changes made by other gateways
+func (s *Server) orchestrateWorkflows(ctx context.Context) {
+	ticker := time.NewTicker(orchestratorInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case id := <-s.workflowRuns:
+			s.advanceWorkflowRunByID(id)
+		case <-ticker.C:
+			s.advanceRunningWorkflowRuns()
+		}
+	}
+}
+
+func (s *Server) advanceRunningWorkflowRuns() {
+	// all runs are loaded first, as finishing them changes the pages
+	var runs []*api.WorkflowRun
+	for page := 1; ; page++ {
+		list, err := s.workflowRunDB.GetListByStatus(api.WorkflowRunStatusRunning, page, orchestratorPerPage)
+		if err != nil {
+			s.logger.Errorf("Failed to get running workflow runs: %v", err)
+			return
+		}
+
+		runs = append(runs, list...)
+		if len(list) < orchestratorPerPage {
+			break
+		}
+	}
+
+	for _, run := range runs {
+		s.advanceWorkflowRunByID(run.UUID)
+	}
+}
+
+func (s *Server) advanceWorkflowRunByID(id string) {
+	l := s.loggerForWorkflowRun(id)
+
+	run, err := s.workflowRunDB.Get(id)
+	if err != nil {
+		l.Errorf("Failed to load workflow run: %v", err)
+		return
+	}
+
+	if run.IsFinished() {
+		return
+	}
+
+	workflow := &api.Workflow{}
+	err = s.workflowDB.GetVersion(run.Workflow, run.Version, workflow)
+	if err == database.ErrNotFound {
+		workflow = nil
+	} else if err != nil {
+		l.Errorf("Failed to load workflow %s: %v", api.VersionedID(run.Workflow, run.Version), err)
+		return
+	}
+
+	if err := s.advanceWorkflowRun(workflow, run); err != nil {
+		l.Errorf("Failed to advance workflow run: %v", err)
+	}
+}
+
+// advanceWorkflowRun updates the status of all steps of the run from their jobs, starts all steps
+// whose dependencies have finished and finishes the run once all of its steps have finished.
+func (s *Server) advanceWorkflowRun(workflow *api.Workflow, run *api.WorkflowRun) error {
+	l := s.loggerForWorkflowRun(run.UUID)
+	now := time.Now()
+
+	before := make([]api.WorkflowRunStep, len(run.Steps))
+	copy(before, run.Steps)
+
+	if workflow == nil {
+		run.Status = api.WorkflowRunStatusFailed
+		run.Error = fmt.Sprintf("workflow %s does not exist", api.VersionedID(run.Workflow, run.Version))
+	} else {
+		results, err := s.refreshWorkflowRunSteps(run)
+		if err != nil {
+			return err
+		}
+
+		if !run.IsFinished() {
+			if err := s.startWorkflowSteps(workflow, run, results, now); err != nil {
+				return err
+			}
+		}
+	}
+
+	finishWorkflowRun(run, now)
+
+	if !run.IsFinished() && reflect.DeepEqual(before, run.Steps) {
+		return nil
+	}
+
+	if err := s.workflowRunDB.Save(run); err != nil {
+		if err == database.ErrConflict {
+			// the run has been advanced concurrently, the step jobs are idempotent
+			l.Debugf("Workflow run has been updated concurrently, skipping.")
+			return nil
+		}
+
+		return err
+	}
+
+	l.Debugf("Advanced workflow run, status is %s.", run.Status)
+	return nil
+}
+
+// refreshWorkflowRunSteps updates the status of all started steps and returns the results of all
+// steps that are done, including the ones moved to the artifact store. The run fails if one of
+// them is lost.
+func (s *Server) refreshWorkflowRunSteps(run *api.WorkflowRun) (map[string]map[string]interface{}, error) {
+	results := make(map[string]map[string]interface{})
+	for i := range run.Steps {
+		step := &run.Steps[i]
+		if step.JobUUID == "" {
+			continue
+		}
+
+		job, err := s.db.Get(step.JobUUID)
+		if err == database.ErrNotFound {
+			// the job has been deleted
+			step.Status = api.JobStatusCancelled
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to load job of step %s: %v", step.Name, err)
+		}
+
+		step.Status = job.Status
+		if job.Status != api.JobStatusDone {
+			continue
+		}
+
+		stepResults, err := s.jobResults(job)
+		if lost, ok := err.(*lostResultError); ok {
+			run.Status = api.WorkflowRunStatusFailed
+			run.Error = fmt.Sprintf("step %s %v", step.Name, lost)
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to load results of step %s: %v", step.Name, err)
+		}
+		results[step.Name] = stepResults
+	}
+
+	return results, nil
+}
+
+// startWorkflowSteps creates the jobs of all pending steps whose dependencies are done. Steps with
+// a dependency that did not finish successfully or an unmet condition are skipped, which again
+// skips the steps depending on them.
+// nolint: gocyclo
+func (s *Server) startWorkflowSteps(workflow *api.Workflow, run *api.WorkflowRun, results map[string]map[string]interface{}, now time.Time) error {
+	for progress := true; progress; {
+		progress = false
+
+		for _, step := range workflow.Steps {
+			runStep := run.Step(step.Name)
+			if runStep == nil || runStep.Status != api.WorkflowStepStatusPending {
+				continue
+			}
+
+			ready, skip := true, false
+			for _, dep := range step.DependsOn {
+				status := run.Step(dep).Status
+				if !api.IsFinishedStatus(status) {
+					ready = false
+					break
+				}
+
+				skip = skip || status != api.JobStatusDone
+			}
+
+			if !ready {
+				continue
+			}
+
+			if skip || (step.Condition != nil && !step.Condition.Matches(results[step.Condition.Step])) {
+				runStep.Status = api.JobStatusSkipped
+				progress = true
+				continue
+			}
+
+			vars, err := step.ResolveVars(run.Params, results)
+			if err != nil {
+				run.Status = api.WorkflowRunStatusFailed
+				run.Error = fmt.Sprintf("step %s: %v", step.Name, err)
+				return nil
+			}
+
+			job := step.NewJob(workflowStepJobUUID(run.UUID, step.Name), run.UUID, vars, api.JSONTime{Time: now})
+			if err := s.db.Save(job); err != nil && err != database.ErrConflict {
+				return fmt.Errorf("failed to save job of step %s: %v", step.Name, err)
+			} else if err == nil {
+				s.publishJobEvent(api.JobEventStatus, job)
+			}
+
+			runStep.JobUUID = job.UUID
+			runStep.Status = api.JobStatusCreated
+		}
+	}
+
+	return nil
+}
+
+// finishWorkflowRun sets the final status of the run once all steps have finished
+func finishWorkflowRun(run *api.WorkflowRun, now time.Time) {
+	if run.IsFinished() {
+		if run.FinishedAt == nil {
+			run.FinishedAt = &api.JSONTime{Time: now}
+		}
+		return
+	}
+
+	status := api.WorkflowRunStatusDone
+	for _, step := range run.Steps {
+		if !api.IsFinishedStatus(step.Status) {
+			return
+		}
+
+		if step.Status != api.JobStatusDone && step.Status != api.JobStatusSkipped {
+			status = api.WorkflowRunStatusFailed
+		}
+	}
+
+	run.Status = status
+	run.FinishedAt = &api.JSONTime{Time: now}
+}
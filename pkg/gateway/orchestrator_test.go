@@ -0,0 +1,184 @@
+package gateway
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aklinkert/go-logging"
+
+	"github.com/scalify/puppet-master-gateway/pkg/api"
+	internalTesting "github.com/scalify/puppet-master-gateway/pkg/internal/testing"
+)
+
+func newTestWorkflow() *api.Workflow {
+	return &api.Workflow{
+		VersionMeta: api.VersionMeta{Name: "login-and-scrape", Version: 1},
+		Params:      []api.Param{{Name: "user", Required: true}},
+		Steps: []api.WorkflowStep{
+			{Name: "login", Code: "login", Vars: map[string]string{"user": "{{params.user}}"}},
+			{
+				Name:      "scrape",
+				Code:      "scrape",
+				DependsOn: []string{"login"},
+				Vars:      map[string]string{"cookies": "{{steps.login.results.cookies}}"},
+				Condition: &api.WorkflowCondition{Step: "login", Result: "success", Equals: "true"},
+			},
+			{Name: "report", Code: "report", DependsOn: []string{"scrape"}},
+		},
+	}
+}
+
+func TestServer_advanceWorkflowRun(t *testing.T) {
+	q := internalTesting.NewTestQueue()
+	db := internalTesting.NewTestDB()
+	workflowDB := internalTesting.NewTestVersionDB()
+	runDB := internalTesting.NewTestWorkflowRunDB()
+	l := logging.NewTestLogger(t)
+
+	s, err := NewServer(db, q, l, "test", true, true, WithWorkflowDB(workflowDB, runDB))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	workflow := newTestWorkflow()
+	run, err := workflow.NewRun("run", map[string]string{"user": "a"}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.advanceWorkflowRun(workflow, run); err != nil {
+		t.Fatal(err)
+	}
+
+	login := run.Step("login")
+	if login.Status != api.JobStatusCreated || login.JobUUID != workflowStepJobUUID("run", "login") {
+		t.Fatalf("Expected login step to be started, got %+v", login)
+	}
+
+	if run.Step("scrape").Status != api.WorkflowStepStatusPending {
+		t.Errorf("Expected scrape step to be pending, got %s", run.Step("scrape").Status)
+	}
+
+	if len(db.SavedJobs) != 1 || db.SavedJobs[0].Vars["user"] != "a" || db.SavedJobs[0].WorkflowRunID != "run" {
+		t.Fatalf("Unexpected saved jobs: %+v", db.SavedJobs)
+	}
+
+	loginJob := db.SavedJobs[0]
+	loginJob.Status = api.JobStatusDone
+	loginJob.Results = map[string]interface{}{"success": true, "cookies": "session=1"}
+	db.Jobs = append(db.Jobs, loginJob)
+
+	if err := s.advanceWorkflowRun(workflow, run); err != nil {
+		t.Fatal(err)
+	}
+
+	if run.Step("scrape").Status != api.JobStatusCreated {
+		t.Fatalf("Expected scrape step to be started, got %s", run.Step("scrape").Status)
+	}
+
+	if len(db.SavedJobs) != 2 || db.SavedJobs[1].Vars["cookies"] != "session=1" {
+		t.Fatalf("Unexpected saved jobs: %+v", db.SavedJobs)
+	}
+
+	scrapeJob := db.SavedJobs[1]
+	scrapeJob.Status = api.JobStatusFailed
+	db.Jobs = append(db.Jobs, scrapeJob)
+
+	if err := s.advanceWorkflowRun(workflow, run); err != nil {
+		t.Fatal(err)
+	}
+
+	if run.Step("report").Status != api.JobStatusSkipped {
+		t.Errorf("Expected report step to be skipped, got %s", run.Step("report").Status)
+	}
+
+	if run.Status != api.WorkflowRunStatusFailed || run.FinishedAt == nil {
+		t.Errorf("Expected run to have failed, got %s", run.Status)
+	}
+
+	if len(runDB.SavedRuns) != 3 {
+		t.Errorf("Unexpected count of saved runs: %d", len(runDB.SavedRuns))
+	}
+}
+
+func TestServer_advanceWorkflowRunCondition(t *testing.T) {
+	q := internalTesting.NewTestQueue()
+	db := internalTesting.NewTestDB()
+	workflowDB := internalTesting.NewTestVersionDB()
+	runDB := internalTesting.NewTestWorkflowRunDB()
+	l := logging.NewTestLogger(t)
+
+	s, err := NewServer(db, q, l, "test", true, true, WithWorkflowDB(workflowDB, runDB))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	workflow := newTestWorkflow()
+	run, err := workflow.NewRun("run", map[string]string{"user": "a"}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loginJob, _ := newTestJob(t, workflowStepJobUUID("run", "login"))
+	loginJob.Status = api.JobStatusDone
+	loginJob.Results = map[string]interface{}{"success": false}
+	db.Jobs = append(db.Jobs, loginJob)
+	run.Step("login").JobUUID = loginJob.UUID
+
+	if err := s.advanceWorkflowRun(workflow, run); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"scrape", "report"} {
+		if run.Step(name).Status != api.JobStatusSkipped {
+			t.Errorf("Expected step %s to be skipped, got %s", name, run.Step(name).Status)
+		}
+	}
+
+	if run.Status != api.WorkflowRunStatusDone {
+		t.Errorf("Expected run to be done, got %s", run.Status)
+	}
+
+	if len(db.SavedJobs) != 0 {
+		t.Errorf("Unexpected count of saved jobs: %d", len(db.SavedJobs))
+	}
+}
+
+func TestServer_advanceWorkflowRunLostResult(t *testing.T) {
+	q := internalTesting.NewTestQueue()
+	db := internalTesting.NewTestDB()
+	workflowDB := internalTesting.NewTestVersionDB()
+	runDB := internalTesting.NewTestWorkflowRunDB()
+	store := internalTesting.NewTestArtifactStore()
+	l := logging.NewTestLogger(t)
+
+	s, err := NewServer(db, q, l, "test", true, true, WithWorkflowDB(workflowDB, runDB), WithArtifactStore(store))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	workflow := newTestWorkflow()
+	run, err := workflow.NewRun("run", map[string]string{"user": "a"}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	login, _ := newTestJob(t, workflowStepJobUUID("run", "login"))
+	login.Status = api.JobStatusDone
+	login.Results = map[string]interface{}{"success": true}
+	login.Artifacts = []api.Artifact{{Name: "cookies.json", ContentType: api.ContentTypeJSON, Result: "cookies"}}
+	db.Jobs = append(db.Jobs, login)
+	run.Step("login").JobUUID = login.UUID
+
+	if err := s.advanceWorkflowRun(workflow, run); err != nil {
+		t.Fatal(err)
+	}
+
+	if run.Status != api.WorkflowRunStatusFailed || run.Error == "" {
+		t.Errorf("Expected run to fail because of the lost result, got status %s and error %q", run.Status, run.Error)
+	}
+
+	if run.Step("scrape").Status != api.WorkflowStepStatusPending || len(db.SavedJobs) != 0 {
+		t.Errorf("Expected no further steps to be started, got %+v", run.Steps)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/aklinkert/go-logging"
 	"github.com/streadway/amqp"
 
 	"github.com/scalify/puppet-master-gateway/pkg/api"
@@ -14,10 +15,15 @@ import (
 
 func (s *Server) ensureQueues() error {
 	var err error
-	var queues = []string{api.QueueNameJobs, api.QueueNameJobResults}
+	var queues = []string{api.QueueNameJobs, api.QueueNameJobStarts, api.QueueNameJobLogs, api.QueueNameJobResults}
 
 	for _, queueName := range queues {
-		_, err = s.queue.QueueDeclare(queueName, true, false, false, false, nil)
+		var args amqp.Table
+		if queueName == api.QueueNameJobs {
+			args = amqp.Table{"x-max-priority": int32(api.JobPriorityMax)}
+		}
+
+		_, err = s.queue.QueueDeclare(queueName, true, false, false, false, args)
 		if err != nil {
 			return fmt.Errorf("unable to create queue %s: %v", queueName, err)
 		}
@@ -25,29 +31,88 @@ func (s *Server) ensureQueues() error {
 		s.logger.Debugf("Checked queue %s for existence.", queueName)
 	}
 
+	for _, exchangeName := range []string{api.ExchangeNameJobCancellations, api.ExchangeNameJobEvents} {
+		err = s.queue.ExchangeDeclare(exchangeName, amqp.ExchangeFanout, true, false, false, false, nil)
+		if err != nil {
+			return fmt.Errorf("unable to create exchange %s: %v", exchangeName, err)
+		}
+
+		s.logger.Debugf("Checked exchange %s for existence.", exchangeName)
+	}
+
 	return nil
 }
 
+// publishNewJob sends the job to the executors, with all referenced modules resolved into its modules
 func (s *Server) publishNewJob(job *api.Job) error {
-	b, err := json.Marshal(job)
+	modules, err := s.resolveModules(job)
 	if err != nil {
 		return err
 	}
 
+	payload := *job
+	payload.Modules = modules
+	payload.ModuleRefs = nil
+
+	b, err := json.Marshal(&payload)
+	if err != nil {
+		return err
+	}
+
+	priority := job.Priority
+	if priority > api.JobPriorityMax {
+		priority = api.JobPriorityMax
+	}
+
+	// the labels are passed as headers as well, so they can be routed and inspected without decoding the job
+	headers := make(amqp.Table, len(job.Labels))
+	for key, value := range job.Labels {
+		headers[api.LabelHeaderPrefix+key] = value
+	}
+
 	return s.queue.Publish("", api.QueueNameJobs, false, false, amqp.Publishing{
 		ContentType: api.ContentTypeJSON,
+		Priority:    priority,
+		Headers:     headers,
 		Body:        b,
 	})
 }
 
-func (s *Server) consumeJobResults(ctx context.Context) {
-	if err := s.queue.Qos(1, 0, false); err != nil {
-		s.logger.Fatalf("Failed to set queue QOS: %v", err)
+// publishJobCancellation tells the executors to abort the given attempt of the job
+func (s *Server) publishJobCancellation(job *api.Job, attempt int) error {
+	b, err := json.Marshal(&api.JobCancellation{
+		UUID:        job.UUID,
+		Attempt:     attempt,
+		CancelledAt: api.JSONTime{Time: time.Now()},
+	})
+	if err != nil {
+		return err
 	}
 
-	consumer, err := s.queue.Consume(api.QueueNameJobResults, "coordinator", false, false, false, false, nil)
+	return s.queue.Publish(api.ExchangeNameJobCancellations, "", false, false, amqp.Publishing{
+		ContentType: api.ContentTypeJSON,
+		Body:        b,
+	})
+}
+
+func (s *Server) consumeJobStarts(ctx context.Context) {
+	s.consumeQueue(ctx, api.QueueNameJobStarts, s.handleJobStart)
+}
+
+func (s *Server) consumeJobLogs(ctx context.Context) {
+	s.consumeQueue(ctx, api.QueueNameJobLogs, s.handleJobLogs)
+}
+
+func (s *Server) consumeJobResults(ctx context.Context) {
+	s.consumeQueue(ctx, api.QueueNameJobResults, s.handleJobResult)
+}
+
+// consumeQueue passes all messages of the queue to the handler. All consumers share the channel of
+// the queue, which requires a distinct consumer tag per queue.
+func (s *Server) consumeQueue(ctx context.Context, queueName string, handler func(msg amqp.Delivery)) {
+	consumer, err := s.queue.Consume(queueName, "coordinator-"+queueName, false, false, false, false, nil)
 	if err != nil {
-		s.logger.Fatalf("Failed to create queue consumer: %v", err)
+		s.logger.Fatalf("Failed to create queue consumer for %s: %v", queueName, err)
 		return
 	}
 
@@ -62,7 +127,7 @@ func (s *Server) consumeJobResults(ctx context.Context) {
 				continue
 			}
 
-			s.handleJobResult(msg)
+			handler(msg)
 		}
 	}
 }
@@ -79,6 +144,132 @@ func (s *Server) ack(msg amqp.Delivery) {
 	}
 }
 
+// loadJobForMessage reads the job a consumed message refers to, the message is acked or nacked
+// if that fails.
+func (s *Server) loadJobForMessage(msg amqp.Delivery, id string) (*api.Job, logging.Logger, bool) {
+	l := s.loggerForJobID(id)
+	l.Debugf("Loading job from db")
+
+	job, err := s.db.Get(id)
+	if err != nil {
+		if err == database.ErrNotFound {
+			l.Errorf("Job %q does not exist in DB, skipping.", id)
+			s.ack(msg)
+			return nil, l, false
+		}
+
+		l.Errorf("Failed to load job from db: %v", err)
+		s.nack(msg, true)
+		return nil, l, false
+	}
+
+	return job, s.loggerForJob(job), true
+}
+
+func (s *Server) handleJobLogs(msg amqp.Delivery) {
+	s.logger.Debugf("Consuming message from queue: %v", string(msg.Body))
+
+	var logs api.JobLogs
+	if err := json.Unmarshal(msg.Body, &logs); err != nil {
+		s.logger.Errorf("Failed to unmarshal json body: %v", err)
+		s.nack(msg, false)
+		return
+	}
+
+	if logs.UUID == "" {
+		s.logger.Errorf("Failed to process job logs: object has no UUID")
+		s.nack(msg, false)
+		return
+	}
+
+	if len(logs.Logs) == 0 {
+		s.ack(msg)
+		return
+	}
+
+	job, l, ok := s.loadJobForMessage(msg, logs.UUID)
+	if !ok {
+		return
+	}
+
+	if !job.IsCurrentAttempt(logs.Attempt) {
+		l.Debugf("Ignoring logs of attempt %d, the job is at attempt %d.", *logs.Attempt, job.Attempt)
+		s.ack(msg)
+		return
+	}
+
+	if job.IsFinished() {
+		// the job result holds the complete logs already
+		l.Debugf("Ignoring logs for job with status %s.", job.Status)
+		s.ack(msg)
+		return
+	}
+
+	offset := len(job.Logs)
+	job.Logs = append(job.Logs, logs.Logs...)
+
+	if err := s.db.Save(job); err != nil {
+		l.Errorf("Failed to save job back to db: %v", err)
+		s.nack(msg, true)
+		return
+	}
+
+	s.publishJobLogEvent(job.UUID, offset, logs.Logs)
+	s.ack(msg)
+	l.Debugf("Appended %d log lines", len(logs.Logs))
+}
+
+func (s *Server) handleJobStart(msg amqp.Delivery) {
+	s.logger.Debugf("Consuming message from queue: %v", string(msg.Body))
+
+	var start api.JobStart
+	if err := json.Unmarshal(msg.Body, &start); err != nil {
+		s.logger.Errorf("Failed to unmarshal json body: %v", err)
+		s.nack(msg, false)
+		return
+	}
+
+	if start.UUID == "" {
+		s.logger.Errorf("Failed to process job start: object has no UUID")
+		s.nack(msg, false)
+		return
+	}
+
+	job, l, ok := s.loadJobForMessage(msg, start.UUID)
+	if !ok {
+		return
+	}
+
+	if !job.IsCurrentAttempt(start.Attempt) {
+		l.Debugf("Ignoring job start of attempt %d, the job is at attempt %d.", *start.Attempt, job.Attempt)
+		s.ack(msg)
+		return
+	}
+
+	if job.Status != api.JobStatusQueued {
+		// the result may have been consumed before the start event, never move a job backwards
+		l.Debugf("Ignoring job start for job with status %s.", job.Status)
+		s.ack(msg)
+		return
+	}
+
+	job.Status = api.JobStatusRunning
+	job.StartedAt = start.StartedAt
+	if job.StartedAt == nil {
+		job.StartedAt = &api.JSONTime{Time: time.Now()}
+	}
+
+	if err := s.db.Save(job); err != nil {
+		l.Errorf("Failed to save job back to db: %v", err)
+		s.nack(msg, true)
+		return
+	}
+
+	s.publishJobEvent(api.JobEventStatus, job)
+	s.ack(msg)
+	l.Debugf("Done processing job start")
+}
+
 func (s *Server) handleJobResult(msg amqp.Delivery) {
 	s.logger.Debugf("Consuming message from queue: %v", string(msg.Body))
 
@@ -94,7 +285,7 @@ func (s *Server) handleJobResult(msg amqp.Delivery) {
 		return
 	}
 
-	l := s.loggerForJob(result.UUID)
+	l := s.loggerForJobID(result.UUID)
 	l.Debugf("Loading job from db")
 
 	job, err := s.db.Get(result.UUID)
@@ -109,27 +300,78 @@ func (s *Server) handleJobResult(msg amqp.Delivery) {
 		s.nack(msg, true)
 		return
 	}
+	l = s.loggerForJob(job)
 
-	if job.Status == api.JobStatusDone {
-		l.Error("Consumed job result was already persisted - at least the job has the status == done.")
+	if !job.IsCurrentAttempt(result.Attempt) {
+		// the attempt has been abandoned after a timeout or failure, its result must not finish the retry
+		l.Infof("Ignoring job result of attempt %d, the job is at attempt %d.", *result.Attempt, job.Attempt)
+		s.ack(msg)
+		return
+	}
+
+	if job.Status == api.JobStatusDone || job.Status == api.JobStatusFailed {
+		l.Errorf("Consumed job result was already persisted - at least the job has the status == %s.", job.Status)
 		s.nack(msg, false)
 		return
 	}
 
-	job.Status = api.JobStatusDone
-	job.Logs = result.Logs
+	if job.Status == api.JobStatusTimedOut {
+		l.Info("Consumed job result for a timed out job, skipping.")
+		s.ack(msg)
+		return
+	}
+
+	if len(result.Logs) > 0 {
+		// the result holds all logs, replacing the ones streamed during the execution
+		job.Logs = result.Logs
+	}
 	job.Error = result.Error
+	if job.Error.IsEmpty() {
+		// executors send an empty error on success, the has_error filter must not select the job
+		job.Error = nil
+	}
 	job.Results = result.Results
-	job.StartedAt = result.StartedAt
+	if s.artifacts != nil {
+		if err := s.storeArtifacts(job, result.Artifacts, l); err != nil {
+			l.Errorf("Failed to store artifacts: %v", err)
+			s.nack(msg, true)
+			return
+		}
+	} else if len(result.Artifacts) > 0 {
+		l.Warnf("Dropping %d artifacts of job, there is no artifact store", len(result.Artifacts))
+	}
+	if result.StartedAt != nil {
+		job.StartedAt = result.StartedAt
+	}
 	job.FinishedAt = result.FinishedAt
 	job.Duration = result.Duration
 
+	job.RecordAttempt()
+
+	switch {
+	case job.Status == api.JobStatusCancelled:
+		l.Info("Consumed job result for a cancelled job, keeping the cancelled status.")
+	case result.Failed() && job.ShouldRetry():
+		job.Retry(time.Now())
+		l.Infof("Attempt %d of job failed, retrying at %s.", job.Attempt, job.RunAt)
+	case result.Failed():
+		job.Status = api.JobStatusFailed
+	default:
+		job.Status = api.JobStatusDone
+	}
+
+	if job.Status != api.JobStatusCreated {
+		job.ScheduleCallback(time.Now())
+	}
+
 	if err := s.db.Save(job); err != nil {
 		l.Errorf("Failed to save job back to db: %v", err)
 		s.nack(msg, true)
 		return
 	}
 
+	s.publishJobEvent(api.JobEventResult, job)
+	s.notifyWorkflowRun(job)
 	if err := msg.Ack(false); err != nil {
 		l.Errorf("Failed to ack message: %v", err)
 		return
@@ -148,7 +390,9 @@ func (s *Server) produceJobs(ctx context.Context) {
 		case <-ticker.C:
 		}
 
-		jobs, err := s.db.GetListByStatus(api.JobStatusCreated, 1, 100)
+		s.releaseWaitingJobs(time.Now())
+
+		jobs, err := s.db.GetDueListByStatus(api.JobStatusCreated, time.Now(), 1, 100)
 		if err != nil {
 			s.logger.Errorf("Failed to get created jobs: %v", err)
 		}
@@ -156,22 +400,50 @@ func (s *Server) produceJobs(ctx context.Context) {
 		s.logger.Debugf("Got %d created jobs from db.", len(jobs))
 
 		for _, job := range jobs {
-			l := s.loggerForJob(job.UUID)
+			l := s.loggerForJob(job)
 			if err := s.publishNewJob(job); err != nil {
 				if err == amqp.ErrClosed {
 					l.Fatalf("amqp connection is closed, aborting.")
 				}
 
+				if _, ok := err.(*moduleRefError); ok {
+					s.failUnpublishableJob(job, api.JobErrorKindModule, err)
+					continue
+				}
+
 				l.Errorf("Failed to queue job: %v", err)
 				continue
 			}
 
 			job.Status = api.JobStatusQueued
+			job.QueuedAt = &api.JSONTime{Time: time.Now()}
 			if err := s.db.Save(job); err != nil {
 				l.Errorf("Failed to save updated job: %v", err)
+				continue
 			}
 
+			s.publishJobEvent(api.JobEventStatus, job)
 			l.Debugf("Queued job.")
 		}
 	}
 }
+
+// failUnpublishableJob marks a job as failed which can never be published to the executors
+func (s *Server) failUnpublishableJob(job *api.Job, kind string, err error) {
+	l := s.loggerForJob(job)
+	now := time.Now()
+
+	job.Status = api.JobStatusFailed
+	job.Error = &api.JobError{Kind: kind, Message: err.Error()}
+	job.FinishedAt = &api.JSONTime{Time: now}
+	job.ScheduleCallback(now)
+
+	if err := s.db.Save(job); err != nil {
+		l.Errorf("Failed to save failed job: %v", err)
+		return
+	}
+
+	s.publishJobEvent(api.JobEventStatus, job)
+	s.notifyWorkflowRun(job)
+	l.Infof("Job can not be published: %v", err)
+}
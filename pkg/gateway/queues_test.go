@@ -3,11 +3,13 @@ package gateway
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"sort"
 	"testing"
 	"time"
 
 	"github.com/aklinkert/go-logging"
+	"github.com/streadway/amqp"
 
 	"github.com/scalify/puppet-master-gateway/pkg/api"
 	internalTesting "github.com/scalify/puppet-master-gateway/pkg/internal/testing"
@@ -29,7 +31,7 @@ func TestServer_ensureQueues(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	var queues = []string{api.QueueNameJobs, api.QueueNameJobResults}
+	var queues = []string{api.QueueNameJobs, api.QueueNameJobStarts, api.QueueNameJobLogs, api.QueueNameJobResults}
 	sort.Strings(q.QueuesDeclared)
 	for _, name := range queues {
 
@@ -39,6 +41,37 @@ func TestServer_ensureQueues(t *testing.T) {
 	}
 }
 
+func TestServerConsumerTags(t *testing.T) {
+	q := internalTesting.NewTestQueue()
+	db := internalTesting.NewTestDB()
+	l := logging.NewTestLogger(t)
+
+	s, err := NewServer(db, q, l, "test", false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := s.prepare(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	tags := q.Consumers()
+	if len(tags) != 3 {
+		t.Fatalf("Expected 3 consumers, got %v", tags)
+	}
+
+	seen := make(map[string]bool)
+	for _, tag := range tags {
+		if seen[tag] {
+			t.Errorf("Consumer tag %q is used twice on the channel", tag)
+		}
+		seen[tag] = true
+	}
+}
+
 func TestServer_publishNewJob(t *testing.T) {
 	q := internalTesting.NewTestQueue()
 	db := internalTesting.NewTestDB()
@@ -114,3 +147,354 @@ func TestServerConsumeJobResults(t *testing.T) {
 		t.Errorf("Expected to find %s, got %s", res2.UUID, db.SavedJobs[1].UUID)
 	}
 }
+
+func TestServer_handleJobResultCancelled(t *testing.T) {
+	q := internalTesting.NewTestQueue()
+	db := internalTesting.NewTestDB()
+	l := logging.NewTestLogger(t)
+
+	s, err := NewServer(db, q, l, "test", true, true)
+	if err != nil {
+		t.Log(err)
+		t.Fatal(err)
+	}
+
+	_, b := newTestJobResult(t, "asdf-1234-asdf-1234")
+	job, _ := newTestJob(t, "asdf-1234-asdf-1234")
+	job.Status = api.JobStatusCancelled
+	db.Jobs = []*api.Job{job}
+
+	s.handleJobResult(amqp.Delivery{Body: b, Acknowledger: &internalTesting.NoopAcknowledger{}})
+
+	if len(db.SavedJobs) != 1 {
+		t.Fatalf("Unexpected count of saved jobs: %v", len(db.SavedJobs))
+	}
+
+	if db.SavedJobs[0].Status != api.JobStatusCancelled {
+		t.Errorf("Expected job to keep status %s, got %s", api.JobStatusCancelled, db.SavedJobs[0].Status)
+	}
+}
+
+func TestServer_handleJobResultStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      *api.JobError
+		rawErr   string
+		status   string
+		hasError bool
+	}{
+		{"failed", &api.JobError{Kind: "TypeError", Message: "x is undefined"}, "", api.JobStatusFailed, true},
+		{"empty error", &api.JobError{}, "", api.JobStatusDone, false},
+		{"empty error message", nil, `""`, api.JobStatusDone, false},
+		{"done", nil, "", api.JobStatusDone, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			q := internalTesting.NewTestQueue()
+			db := internalTesting.NewTestDB()
+			l := logging.NewTestLogger(t)
+
+			s, err := NewServer(db, q, l, "test", true, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			res, _ := newTestJobResult(t, "asdf-1234-asdf-1234")
+			res.Error = test.err
+			b, err := json.Marshal(res)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.rawErr != "" {
+				b = bytes.Replace(b, []byte(`"error":null`), []byte(`"error":`+test.rawErr), 1)
+			}
+
+			job, _ := newTestJob(t, res.UUID)
+			job.Status = api.JobStatusQueued
+			db.Jobs = []*api.Job{job}
+
+			s.handleJobResult(amqp.Delivery{Body: b, Acknowledger: &internalTesting.NoopAcknowledger{}})
+
+			if len(db.SavedJobs) != 1 {
+				t.Fatalf("Unexpected count of saved jobs: %v", len(db.SavedJobs))
+			}
+
+			if db.SavedJobs[0].Status != test.status {
+				t.Errorf("Expected job to have status %s, got %s", test.status, db.SavedJobs[0].Status)
+			}
+
+			// the has_error filter selects jobs by the existence of the error
+			if hasError := db.SavedJobs[0].Error != nil; hasError != test.hasError {
+				t.Errorf("Expected job to have an error: %v, got %+v", test.hasError, db.SavedJobs[0].Error)
+			}
+		})
+	}
+}
+
+func TestServer_handleJobStart(t *testing.T) {
+	tests := []struct {
+		name, status, expectedStatus string
+	}{
+		{"queued", api.JobStatusQueued, api.JobStatusRunning},
+		{"done", api.JobStatusDone, api.JobStatusDone},
+		{"cancelled", api.JobStatusCancelled, api.JobStatusCancelled},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			q := internalTesting.NewTestQueue()
+			db := internalTesting.NewTestDB()
+			l := logging.NewTestLogger(t)
+
+			s, err := NewServer(db, q, l, "test", true, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			job, _ := newTestJob(t, "asdf-1234-asdf-1234")
+			job.Status = test.status
+			db.Jobs = []*api.Job{job}
+
+			b, err := json.Marshal(&api.JobStart{UUID: job.UUID, StartedAt: &testTime})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			s.handleJobStart(amqp.Delivery{Body: b, Acknowledger: &internalTesting.NoopAcknowledger{}})
+
+			if job.Status != test.expectedStatus {
+				t.Errorf("Expected job to have status %s, got %s", test.expectedStatus, job.Status)
+			}
+
+			if test.expectedStatus == api.JobStatusRunning && (len(db.SavedJobs) != 1 || job.StartedAt == nil) {
+				t.Errorf("Expected running job to be saved with a start time")
+			}
+		})
+	}
+}
+
+func TestServer_handleJobResultRetry(t *testing.T) {
+	q := internalTesting.NewTestQueue()
+	db := internalTesting.NewTestDB()
+	l := logging.NewTestLogger(t)
+
+	s, err := NewServer(db, q, l, "test", true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, b := newTestJobResult(t, "asdf-1234-asdf-1234")
+	job, _ := newTestJob(t, "asdf-1234-asdf-1234")
+	job.Status = api.JobStatusRunning
+	job.MaxRetries = 1
+	job.Backoff = &api.Backoff{Type: api.BackoffTypeFixed, BaseDelay: 1000}
+	db.Jobs = []*api.Job{job}
+
+	s.handleJobResult(amqp.Delivery{Body: b, Acknowledger: &internalTesting.NoopAcknowledger{}})
+
+	if job.Status != api.JobStatusCreated {
+		t.Fatalf("Expected job to be retried with status %s, got %s", api.JobStatusCreated, job.Status)
+	}
+
+	if job.RunAt == nil || !job.RunAt.After(time.Now()) {
+		t.Errorf("Expected retry to be delayed, got %v", job.RunAt)
+	}
+
+	job.Status = api.JobStatusRunning
+	s.handleJobResult(amqp.Delivery{Body: b, Acknowledger: &internalTesting.NoopAcknowledger{}})
+
+	if job.Status != api.JobStatusFailed {
+		t.Fatalf("Expected job to have status %s after the last attempt, got %s", api.JobStatusFailed, job.Status)
+	}
+
+	if job.Attempt != 2 || len(job.Attempts) != 2 {
+		t.Errorf("Expected 2 attempts to be recorded, got %d (%d)", job.Attempt, len(job.Attempts))
+	}
+}
+
+func TestServer_handleJobResultStaleAttempt(t *testing.T) {
+	q := internalTesting.NewTestQueue()
+	db := internalTesting.NewTestDB()
+	l := logging.NewTestLogger(t)
+
+	s, err := NewServer(db, q, l, "test", true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, _ := newTestJobResult(t, "asdf-1234-asdf-1234")
+	res.Error = nil
+	attempt := 0
+	res.Attempt = &attempt
+	b, err := json.Marshal(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the first attempt timed out and the job got retried
+	job, _ := newTestJob(t, res.UUID)
+	job.Status = api.JobStatusRunning
+	job.Attempt = 1
+	db.Jobs = []*api.Job{job}
+
+	s.handleJobResult(amqp.Delivery{Body: b, Acknowledger: &internalTesting.NoopAcknowledger{}})
+
+	if len(db.SavedJobs) != 0 {
+		t.Fatalf("Expected result of the abandoned attempt to be dropped, got %d saved jobs", len(db.SavedJobs))
+	}
+
+	if job.Status != api.JobStatusRunning {
+		t.Errorf("Expected job to keep status %s, got %s", api.JobStatusRunning, job.Status)
+	}
+
+	attempt = 1
+	b, err = json.Marshal(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.handleJobResult(amqp.Delivery{Body: b, Acknowledger: &internalTesting.NoopAcknowledger{}})
+
+	if job.Status != api.JobStatusDone {
+		t.Errorf("Expected result of the current attempt to finish the job, got status %s", job.Status)
+	}
+}
+
+func TestServer_produceJobs(t *testing.T) {
+	q := internalTesting.NewTestQueue()
+	db := internalTesting.NewTestDB()
+	l := logging.NewTestLogger(t)
+
+	s, err := NewServer(db, q, l, "test", true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	due, _ := newTestJob(t, "asdf-1234-asdf-1234")
+	due.Status = api.JobStatusCreated
+	due.RunAt = &api.JSONTime{Time: time.Now().Add(-time.Minute)}
+
+	scheduled, _ := newTestJob(t, "asdf-5678-asdf-5678")
+	scheduled.Status = api.JobStatusCreated
+	scheduled.RunAt = &api.JSONTime{Time: time.Now().Add(time.Hour)}
+	db.Jobs = []*api.Job{due, scheduled}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1500*time.Millisecond)
+	defer cancel()
+	s.produceJobs(ctx)
+
+	if len(q.Messages) != 1 {
+		t.Fatalf("Unexpected count of published jobs: %d", len(q.Messages))
+	}
+
+	if due.Status != api.JobStatusQueued || due.QueuedAt == nil {
+		t.Errorf("Expected due job to be queued, got status %s", due.Status)
+	}
+
+	if scheduled.Status != api.JobStatusCreated {
+		t.Errorf("Expected scheduled job to keep status %s, got %s", api.JobStatusCreated, scheduled.Status)
+	}
+}
+
+func TestServer_publishNewJobPriority(t *testing.T) {
+	q := internalTesting.NewTestQueue()
+	db := internalTesting.NewTestDB()
+	l := logging.NewTestLogger(t)
+
+	s, err := NewServer(db, q, l, "test", true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, priority := range []uint8{3, 200} {
+		job, _ := newTestJob(t, "asdf-1234-asdf-1234")
+		job.Priority = priority
+
+		if err := s.publishNewJob(job); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(q.Publishings) != 2 {
+		t.Fatalf("Unexpected count of sent Jobs: %d", len(q.Publishings))
+	}
+
+	if q.Publishings[0].Priority != 3 {
+		t.Errorf("Expected priority 3, got %d", q.Publishings[0].Priority)
+	}
+
+	if q.Publishings[1].Priority != api.JobPriorityMax {
+		t.Errorf("Expected priority to be capped at %d, got %d", api.JobPriorityMax, q.Publishings[1].Priority)
+	}
+}
+
+func TestServer_publishNewJobLabels(t *testing.T) {
+	q := internalTesting.NewTestQueue()
+	db := internalTesting.NewTestDB()
+	l := logging.NewTestLogger(t)
+
+	s, err := NewServer(db, q, l, "test", true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job, _ := newTestJob(t, "asdf-1234-asdf-1234")
+	job.Labels = map[string]string{"team": "growth"}
+
+	if err := s.publishNewJob(job); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(q.Publishings) != 1 {
+		t.Fatalf("Unexpected count of sent Jobs: %d", len(q.Publishings))
+	}
+
+	if header := q.Publishings[0].Headers[api.LabelHeaderPrefix+"team"]; header != "growth" {
+		t.Errorf("Expected label header growth, got %v", header)
+	}
+}
+
+func TestServer_handleJobLogs(t *testing.T) {
+	q := internalTesting.NewTestQueue()
+	db := internalTesting.NewTestDB()
+	l := logging.NewTestLogger(t)
+
+	s, err := NewServer(db, q, l, "test", true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job, _ := newTestJob(t, "asdf-1234-asdf-1234")
+	job.Status = api.JobStatusRunning
+	job.Logs = []api.Log{{Time: testTime, Level: "info", Message: "first"}}
+	db.Jobs = []*api.Job{job}
+
+	b, err := json.Marshal(&api.JobLogs{UUID: job.UUID, Logs: []api.Log{{Time: testTime, Level: "info", Message: "second"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.handleJobLogs(amqp.Delivery{Body: b, Acknowledger: &internalTesting.NoopAcknowledger{}})
+
+	if len(job.Logs) != 2 || job.Logs[1].Message != "second" {
+		t.Fatalf("Expected log line to be appended, got %+v", job.Logs)
+	}
+
+	if len(db.SavedJobs) != 1 {
+		t.Errorf("Unexpected count of saved jobs: %d", len(db.SavedJobs))
+	}
+
+	if len(q.Events) != 1 {
+		t.Fatalf("Unexpected count of published events: %d", len(q.Events))
+	}
+
+	event := new(api.JobEvent)
+	if err := json.Unmarshal(q.Events[0], event); err != nil {
+		t.Fatal(err)
+	}
+
+	if event.Type != api.JobEventLog || len(event.Logs) != 1 || event.Offset != 1 {
+		t.Errorf("Unexpected log event: %+v", event)
+	}
+}
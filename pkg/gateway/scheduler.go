@@ -0,0 +1,126 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/scalify/puppet-master-gateway/pkg/api"
+	"github.com/scalify/puppet-master-gateway/pkg/database"
+)
+
+const (
+	schedulerInterval = 1 * time.Second
+	schedulerPerPage  = 100
+)
+
+var cronParser = cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// validateSchedule checks the user supplied fields of the schedule and returns its next run after
+// now. The job template is validated like a submitted job, as every job created from it is.
+func validateSchedule(schedule *api.Schedule, now time.Time) (time.Time, error) {
+	if schedule.Job == nil {
+		return time.Time{}, errors.New("the job must be given")
+	}
+
+	if err := api.ValidateNewJob(schedule.Job.Job()); err != nil {
+		return time.Time{}, fmt.Errorf("invalid job: %v", err)
+	}
+
+	return nextScheduleRun(schedule, now)
+}
+
+// nextScheduleRun returns the first time after the given one the schedule is due
+func nextScheduleRun(schedule *api.Schedule, after time.Time) (time.Time, error) {
+	loc := time.UTC
+	if schedule.Timezone != "" {
+		var err error
+		if loc, err = time.LoadLocation(schedule.Timezone); err != nil {
+			return time.Time{}, fmt.Errorf("invalid timezone %q: %v", schedule.Timezone, err)
+		}
+	}
+
+	sched, err := cronParser.Parse(schedule.Cron)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid cron expression %q: %v", schedule.Cron, err)
+	}
+
+	next := sched.Next(after.In(loc))
+	if next.IsZero() {
+		return time.Time{}, fmt.Errorf("cron expression %q is never due", schedule.Cron)
+	}
+
+	return next, nil
+}
+
+// scheduledJobUUID derives the job UUID from the schedule and its run time, so that a run
+// is never materialized twice, even with multiple gateways running the scheduler.
+func scheduledJobUUID(schedule *api.Schedule, runAt *api.JSONTime) string {
+	name := fmt.Sprintf("https://puppet-master.io/schedules/%s/%s", schedule.UUID, runAt)
+	return uuid.NewV5(uuid.NamespaceURL, name).String()
+}
+
+// runSchedules periodically creates jobs for all due schedules
+func (s *Server) runSchedules(ctx context.Context) {
+	ticker := time.NewTicker(schedulerInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		now := time.Now()
+		schedules, err := s.scheduleDB.GetDueList(now, 1, schedulerPerPage)
+		if err != nil {
+			s.logger.Errorf("Failed to get due schedules: %v", err)
+			continue
+		}
+
+		s.logger.Debugf("Got %d due schedules from db.", len(schedules))
+
+		for _, schedule := range schedules {
+			s.materializeSchedule(schedule, now)
+		}
+	}
+}
+
+func (s *Server) materializeSchedule(schedule *api.Schedule, now time.Time) {
+	l := s.loggerForSchedule(schedule.UUID)
+
+	job := schedule.NewJob(scheduledJobUUID(schedule, schedule.NextRunAt), api.JSONTime{Time: now})
+	if err := s.db.Save(job); err != nil {
+		if err != database.ErrConflict {
+			l.Errorf("Failed to save scheduled job: %v", err)
+			return
+		}
+
+		l.Debugf("Job %s of schedule already exists.", job.UUID)
+	} else {
+		s.publishJobEvent(api.JobEventStatus, job)
+	}
+
+	schedule.LastRunAt = &api.JSONTime{Time: now}
+	schedule.LastJobUUID = job.UUID
+
+	next, err := nextScheduleRun(schedule, now)
+	if err != nil {
+		l.Errorf("Failed to calculate next run, pausing schedule: %v", err)
+		schedule.Paused = true
+	} else {
+		schedule.NextRunAt = &api.JSONTime{Time: next}
+	}
+
+	if err := s.scheduleDB.Save(schedule); err != nil {
+		l.Errorf("Failed to save schedule: %v", err)
+		return
+	}
+
+	l.Debugf("Created job %s from schedule, next run at %s.", job.UUID, schedule.NextRunAt)
+}
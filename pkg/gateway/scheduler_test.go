@@ -0,0 +1,97 @@
+package gateway
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aklinkert/go-logging"
+
+	"github.com/scalify/puppet-master-gateway/pkg/api"
+	internalTesting "github.com/scalify/puppet-master-gateway/pkg/internal/testing"
+)
+
+func newTestSchedule(uuid string) *api.Schedule {
+	schedule := api.NewSchedule()
+	schedule.UUID = uuid
+	schedule.Cron = "*/5 * * * *"
+	schedule.Job.Code = "test-" + uuid
+	schedule.Job.Vars = map[string]string{"1234": "1234567890"}
+
+	return schedule
+}
+
+func Test_nextScheduleRun(t *testing.T) {
+	after := time.Date(2020, 3, 1, 10, 2, 0, 0, time.UTC)
+
+	tests := []struct {
+		name, cron, timezone string
+		expected             time.Time
+		err                  bool
+	}{
+		{"every 5 minutes", "*/5 * * * *", "", time.Date(2020, 3, 1, 10, 5, 0, 0, time.UTC), false},
+		{"daily in timezone", "0 12 * * *", "Europe/Berlin", time.Date(2020, 3, 1, 11, 0, 0, 0, time.UTC), false},
+		{"descriptor", "@hourly", "", time.Date(2020, 3, 1, 11, 0, 0, 0, time.UTC), false},
+		{"invalid cron", "* * *", "", time.Time{}, true},
+		{"invalid timezone", "* * * * *", "Mars/Olympus", time.Time{}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			schedule := newTestSchedule("asdf-1234-asdf-1234")
+			schedule.Cron = test.cron
+			schedule.Timezone = test.timezone
+
+			next, err := nextScheduleRun(schedule, after)
+			if (err != nil) != test.err {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if !next.Equal(test.expected) {
+				t.Errorf("Expected next run at %v, got %v", test.expected, next)
+			}
+		})
+	}
+}
+
+func TestServer_materializeSchedule(t *testing.T) {
+	q := internalTesting.NewTestQueue()
+	db := internalTesting.NewTestDB()
+	scheduleDB := internalTesting.NewTestScheduleDB()
+	l := logging.NewTestLogger(t)
+
+	s, err := NewServer(db, q, l, "test", true, true, WithScheduleDB(scheduleDB))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	schedule := newTestSchedule("asdf-1234-asdf-1234")
+	schedule.NextRunAt = &api.JSONTime{Time: now.Add(-time.Second)}
+
+	s.materializeSchedule(schedule, now)
+
+	if len(db.SavedJobs) != 1 {
+		t.Fatalf("Unexpected count of saved jobs: %d", len(db.SavedJobs))
+	}
+
+	job := db.SavedJobs[0]
+	if job.Status != api.JobStatusCreated || job.Code != schedule.Job.Code || job.Vars["1234"] != "1234567890" {
+		t.Errorf("Job was not created from the schedule template: %+v", job)
+	}
+
+	if job.UUID != scheduledJobUUID(schedule, &api.JSONTime{Time: now.Add(-time.Second)}) {
+		t.Errorf("Unexpected job UUID %s", job.UUID)
+	}
+
+	if len(scheduleDB.SavedSchedules) != 1 {
+		t.Fatalf("Unexpected count of saved schedules: %d", len(scheduleDB.SavedSchedules))
+	}
+
+	if schedule.LastJobUUID != job.UUID || schedule.LastRunAt == nil {
+		t.Errorf("Expected last run to be recorded, got %v and %q", schedule.LastRunAt, schedule.LastJobUUID)
+	}
+
+	if !schedule.NextRunAt.After(now) {
+		t.Errorf("Expected next run after %v, got %v", now, schedule.NextRunAt)
+	}
+}
@@ -0,0 +1,207 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/aklinkert/go-logging"
+	"github.com/gorilla/mux"
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/scalify/puppet-master-gateway/pkg/api"
+	"github.com/scalify/puppet-master-gateway/pkg/database"
+)
+
+// CreateSchedule validates a schedule and stores it in the database
+func (s *Server) CreateSchedule(rw http.ResponseWriter, req *http.Request) {
+	rw.Header().Add(api.ContentTypeHeader, api.ContentTypeJSON)
+
+	schedule := api.NewSchedule()
+	if err := json.NewDecoder(req.Body).Decode(schedule); err != nil {
+		s.logger.Errorf("Failed to decode json body: %v", err)
+		writeError(rw, api.NewError(http.StatusBadRequest, api.ErrorCodeInvalidBody, "failed to decode json body: %v", err), s.logger)
+		return
+	}
+
+	if schedule.UUID == "" {
+		schedule.UUID = uuid.NewV4().String()
+	}
+
+	now := time.Now()
+	schedule.Rev = ""
+	schedule.CreatedAt = api.JSONTime{Time: now}
+	schedule.LastRunAt = nil
+	schedule.LastJobUUID = ""
+
+	s.saveSchedule(rw, schedule, now, http.StatusCreated)
+}
+
+// UpdateSchedule replaces the user supplied fields of a schedule
+func (s *Server) UpdateSchedule(rw http.ResponseWriter, req *http.Request) {
+	rw.Header().Add(api.ContentTypeHeader, api.ContentTypeJSON)
+
+	vars := mux.Vars(req)
+	scheduleID := vars["id"]
+	logger := s.loggerForSchedule(scheduleID)
+
+	existing, ok := s.loadSchedule(rw, scheduleID, logger)
+	if !ok {
+		return
+	}
+
+	schedule := api.NewSchedule()
+	if err := json.NewDecoder(req.Body).Decode(schedule); err != nil {
+		logger.Errorf("Failed to decode json body: %v", err)
+		writeError(rw, api.NewError(http.StatusBadRequest, api.ErrorCodeInvalidBody, "failed to decode json body: %v", err), logger)
+		return
+	}
+
+	schedule.UUID = existing.UUID
+	schedule.Rev = existing.Rev
+	schedule.CreatedAt = existing.CreatedAt
+	schedule.LastRunAt = existing.LastRunAt
+	schedule.LastJobUUID = existing.LastJobUUID
+
+	s.saveSchedule(rw, schedule, time.Now(), http.StatusOK)
+}
+
+// PauseSchedule stops the schedule from creating new jobs
+func (s *Server) PauseSchedule(rw http.ResponseWriter, req *http.Request) {
+	s.setSchedulePaused(rw, req, true)
+}
+
+// ResumeSchedule lets a paused schedule create jobs again, starting with its next run from now on
+func (s *Server) ResumeSchedule(rw http.ResponseWriter, req *http.Request) {
+	s.setSchedulePaused(rw, req, false)
+}
+
+func (s *Server) setSchedulePaused(rw http.ResponseWriter, req *http.Request, paused bool) {
+	rw.Header().Add(api.ContentTypeHeader, api.ContentTypeJSON)
+
+	vars := mux.Vars(req)
+	scheduleID := vars["id"]
+	logger := s.loggerForSchedule(scheduleID)
+
+	schedule, ok := s.loadSchedule(rw, scheduleID, logger)
+	if !ok {
+		return
+	}
+
+	schedule.Paused = paused
+	s.saveSchedule(rw, schedule, time.Now(), http.StatusOK)
+}
+
+// saveSchedule validates the schedule, calculates its next run and writes it to the database
+func (s *Server) saveSchedule(rw http.ResponseWriter, schedule *api.Schedule, now time.Time, status int) {
+	logger := s.loggerForSchedule(schedule.UUID)
+
+	next, err := validateSchedule(schedule, now)
+	if err != nil {
+		logger.Debugf("Invalid schedule: %v", err)
+		writeError(rw, api.NewError(http.StatusBadRequest, api.ErrorCodeInvalidResource, "invalid schedule: %v", err), logger)
+		return
+	}
+	schedule.NextRunAt = &api.JSONTime{Time: next}
+
+	if err := s.scheduleDB.Save(schedule); err != nil {
+		logger.Errorf("Failed to save schedule: %v", err)
+		writeError(rw, saveError("schedule", err), logger)
+		return
+	}
+
+	rw.WriteHeader(status)
+	schedule.Rev = ""
+	scheduleResponse := &api.ScheduleResponse{Data: schedule}
+	if err := json.NewEncoder(rw).Encode(scheduleResponse); err != nil {
+		logger.Errorf("Failed to encode schedule: %v", err)
+	}
+}
+
+// loadSchedule reads the schedule from the database and writes an error response if that fails
+func (s *Server) loadSchedule(rw http.ResponseWriter, scheduleID string, logger logging.Logger) (*api.Schedule, bool) {
+	schedule, err := s.scheduleDB.Get(scheduleID)
+	if err != nil {
+		if err == database.ErrNotFound {
+			logger.Debugf("Failed to find schedule in database")
+			writeError(rw, api.NewError(http.StatusNotFound, api.ErrorCodeNotFound, "schedule %s not found", scheduleID), logger)
+			return nil, false
+		}
+
+		logger.Errorf("Failed to load schedule: %v", err)
+		writeError(rw, api.NewError(http.StatusInternalServerError, api.ErrorCodeInternal, "failed to fetch schedule: %v", err), logger)
+		return nil, false
+	}
+
+	return schedule, true
+}
+
+// GetSchedules returns a paginated list of schedules
+func (s *Server) GetSchedules(rw http.ResponseWriter, req *http.Request) {
+	rw.Header().Add(api.ContentTypeHeader, api.ContentTypeJSON)
+
+	page, perPage, err := s.getPageAndPerPage(req)
+	if err != nil {
+		s.logger.Debugf("Invalid pagination params: %v", err)
+		writeError(rw, api.NewError(http.StatusBadRequest, api.ErrorCodeInvalidParameter, "%v", err), s.logger)
+		return
+	}
+
+	schedules, err := s.scheduleDB.GetList(page, perPage)
+	if err != nil {
+		s.logger.Errorf("Failed to load schedules: %v", err)
+		writeError(rw, api.NewError(http.StatusInternalServerError, api.ErrorCodeInternal, "failed to fetch schedule list: %v", err), s.logger)
+		return
+	}
+
+	for i := range schedules {
+		schedules[i].Rev = ""
+	}
+
+	schedulesResponse := &api.SchedulesResponse{Data: schedules}
+	if err := json.NewEncoder(rw).Encode(schedulesResponse); err != nil {
+		s.logger.Errorf("Failed to encode schedules: %v", err)
+	}
+}
+
+// GetSchedule reads the schedule from the database and returns it
+func (s *Server) GetSchedule(rw http.ResponseWriter, req *http.Request) {
+	rw.Header().Add(api.ContentTypeHeader, api.ContentTypeJSON)
+
+	vars := mux.Vars(req)
+	scheduleID := vars["id"]
+	logger := s.loggerForSchedule(scheduleID)
+
+	schedule, ok := s.loadSchedule(rw, scheduleID, logger)
+	if !ok {
+		return
+	}
+
+	schedule.Rev = ""
+	scheduleResponse := &api.ScheduleResponse{Data: schedule}
+	if err := json.NewEncoder(rw).Encode(scheduleResponse); err != nil {
+		logger.Errorf("Failed to encode schedule: %v", err)
+	}
+}
+
+// DeleteSchedule deletes a schedule from the database, already created jobs are kept
+func (s *Server) DeleteSchedule(rw http.ResponseWriter, req *http.Request) {
+	rw.Header().Add(api.ContentTypeHeader, api.ContentTypeJSON)
+
+	vars := mux.Vars(req)
+	scheduleID := vars["id"]
+	logger := s.loggerForSchedule(scheduleID)
+
+	schedule, ok := s.loadSchedule(rw, scheduleID, logger)
+	if !ok {
+		return
+	}
+
+	if err := s.scheduleDB.Delete(schedule); err != nil {
+		logger.Errorf("Failed to delete schedule: %v", err)
+		writeError(rw, api.NewError(http.StatusInternalServerError, api.ErrorCodeInternal, "failed to delete schedule: %v", err), logger)
+		return
+	}
+
+	rw.WriteHeader(http.StatusNoContent)
+}
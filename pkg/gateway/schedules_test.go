@@ -0,0 +1,153 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aklinkert/go-logging"
+
+	"github.com/scalify/puppet-master-gateway/pkg/api"
+	internalTesting "github.com/scalify/puppet-master-gateway/pkg/internal/testing"
+)
+
+func TestServerCreateSchedule(t *testing.T) {
+	q := internalTesting.NewTestQueue()
+	db := internalTesting.NewTestDB()
+	scheduleDB := internalTesting.NewTestScheduleDB()
+	l := logging.NewTestLogger(t)
+
+	s, err := NewServer(db, q, l, "test", true, false, WithScheduleDB(scheduleDB))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	go startServer(ctx, t, s)
+	time.Sleep(100 * time.Millisecond)
+
+	b, err := json.Marshal(newTestSchedule("asdf-1234-asdf-1234"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/schedules", bytes.NewReader(b))
+	addAPITokenHeader(req, "test")
+	rw := httptest.NewRecorder()
+	s.srv.Handler.ServeHTTP(rw, req)
+
+	if rw.Code != 201 {
+		t.Errorf("Unexpected http response: %v", rw.Result().Status)
+	}
+
+	t.Logf("CreateSchedule response: %q", rw.Body.String())
+
+	if len(scheduleDB.SavedSchedules) != 1 {
+		t.Fatalf("Unexpected count of saved schedules: %d", len(scheduleDB.SavedSchedules))
+	}
+
+	responseSchedule := &api.ScheduleResponse{}
+	if err := json.Unmarshal(rw.Body.Bytes(), responseSchedule); err != nil {
+		t.Fatalf("Failed to decode response body: %v", err)
+	}
+
+	if responseSchedule.Data.UUID != "asdf-1234-asdf-1234" || responseSchedule.Data.NextRunAt == nil {
+		t.Fatalf("Unexpected schedule in response: %+v", responseSchedule.Data)
+	}
+}
+
+func TestServerCreateScheduleInvalid(t *testing.T) {
+	q := internalTesting.NewTestQueue()
+	db := internalTesting.NewTestDB()
+	scheduleDB := internalTesting.NewTestScheduleDB()
+	l := logging.NewTestLogger(t)
+
+	s, err := NewServer(db, q, l, "test", true, false, WithScheduleDB(scheduleDB))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	go startServer(ctx, t, s)
+	time.Sleep(100 * time.Millisecond)
+
+	tests := []struct {
+		name   string
+		modify func(schedule *api.Schedule)
+	}{
+		{"cron", func(schedule *api.Schedule) { schedule.Cron = "every now and then" }},
+		{"no job", func(schedule *api.Schedule) { schedule.Job = nil }},
+		{"empty code", func(schedule *api.Schedule) { schedule.Job.Code = "" }},
+		{"label key", func(schedule *api.Schedule) { schedule.Job.Labels = map[string]string{"team.name": "growth"} }},
+		{"module name", func(schedule *api.Schedule) { schedule.Job.Modules = map[string]string{"../helper": "x"} }},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			schedule := newTestSchedule("asdf-1234-asdf-1234")
+			test.modify(schedule)
+			b, err := json.Marshal(schedule)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/schedules", bytes.NewReader(b))
+			addAPITokenHeader(req, "test")
+			rw := httptest.NewRecorder()
+			s.srv.Handler.ServeHTTP(rw, req)
+
+			if rw.Code != 400 {
+				t.Errorf("Unexpected http response: %v", rw.Result().Status)
+			}
+		})
+	}
+
+	if len(scheduleDB.SavedSchedules) != 0 {
+		t.Fatalf("Unexpected count of saved schedules: %d", len(scheduleDB.SavedSchedules))
+	}
+}
+
+func TestServerPauseAndResumeSchedule(t *testing.T) {
+	q := internalTesting.NewTestQueue()
+	db := internalTesting.NewTestDB()
+	scheduleDB := internalTesting.NewTestScheduleDB()
+	l := logging.NewTestLogger(t)
+
+	s, err := NewServer(db, q, l, "test", true, false, WithScheduleDB(scheduleDB))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	go startServer(ctx, t, s)
+	time.Sleep(100 * time.Millisecond)
+
+	schedule := newTestSchedule("asdf-1234-asdf-1234")
+	scheduleDB.Schedules = append(scheduleDB.Schedules, schedule)
+
+	for _, action := range []string{"pause", "resume"} {
+		req := httptest.NewRequest(http.MethodPost, "/schedules/asdf-1234-asdf-1234/"+action, nil)
+		addAPITokenHeader(req, "test")
+		rw := httptest.NewRecorder()
+		s.srv.Handler.ServeHTTP(rw, req)
+
+		if rw.Code != 200 {
+			t.Errorf("Unexpected http response on %s: %v", action, rw.Result().Status)
+		}
+
+		if schedule.Paused != (action == "pause") {
+			t.Errorf("Unexpected paused state after %s: %v", action, schedule.Paused)
+		}
+	}
+
+	if len(scheduleDB.SavedSchedules) != 2 {
+		t.Fatalf("Unexpected count of saved schedules: %d", len(scheduleDB.SavedSchedules))
+	}
+}
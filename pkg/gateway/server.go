@@ -3,6 +3,7 @@ package gateway
 import (
 	"context"
 	"fmt"
+	"net"
 	"net/http"
 	"time"
 
@@ -14,22 +15,98 @@ import (
 type Server struct {
 	logger                logging.Logger
 	db                    db
+	scheduleDB            scheduleDB
+	workflowDB            versionDB
+	workflowRunDB         workflowRunDB
+	workflowRuns          chan string
+	templateDB            versionDB
+	moduleDB              versionDB
+	modules               *moduleCache
+	artifacts             artifactStore
 	queue                 queue
 	srv                   *http.Server
+	callbackClient        *http.Client
+	events                *jobEventBroker
 	apiToken              string
 	enableAPI, enableJobs bool
 }
 
+// An Option configures optional features of the server
+type Option func(s *Server)
+
+// WithScheduleDB enables the schedules api and the scheduler, backed by the given database
+func WithScheduleDB(db scheduleDB) Option {
+	return func(s *Server) {
+		s.scheduleDB = db
+	}
+}
+
+// WithWorkflowDB enables the workflows api and the workflow orchestrator, backed by the given databases
+func WithWorkflowDB(workflows versionDB, runs workflowRunDB) Option {
+	return func(s *Server) {
+		s.workflowDB = workflows
+		s.workflowRunDB = runs
+	}
+}
+
+// WithTemplateDB enables the templates api, backed by the given database
+func WithTemplateDB(db versionDB) Option {
+	return func(s *Server) {
+		s.templateDB = db
+	}
+}
+
+// WithModuleDB enables the modules api and the resolution of module references of jobs, backed
+// by the given database
+func WithModuleDB(db versionDB) Option {
+	return func(s *Server) {
+		s.moduleDB = db
+	}
+}
+
+// WithArtifactStore enables the artifacts of jobs, which are kept in the given store instead of the
+// job database. Without it large results stay within the jobs and uploaded artifacts are dropped.
+func WithArtifactStore(store artifactStore) Option {
+	return func(s *Server) {
+		s.artifacts = store
+	}
+}
+
+// WithPrivateCallbacksBlocked rejects callbacks to loopback, private and link-local addresses,
+// so clients can't reach services within the network of the gateway through callbacks. Callbacks
+// are sent without the proxy of the environment then, as the proxy would be checked instead.
+func WithPrivateCallbacksBlocked() Option {
+	return func(s *Server) {
+		dialer := &net.Dialer{Timeout: callbackTimeout, Control: blockPrivateAddress}
+		s.callbackClient.Transport = &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: callbackTimeout,
+		}
+	}
+}
+
 // NewServer creates a new server
-func NewServer(db db, queue queue, logger logging.Logger, apiToken string, enableAPI, enableJobs bool) (*Server, error) {
-	return &Server{
+func NewServer(db db, queue queue, logger logging.Logger, apiToken string, enableAPI, enableJobs bool, opts ...Option) (*Server, error) {
+	s := &Server{
 		logger:     logger,
 		queue:      queue,
 		db:         db,
 		apiToken:   apiToken,
 		enableAPI:  enableAPI,
 		enableJobs: enableJobs,
-	}, nil
+		callbackClient: &http.Client{
+			Timeout: callbackTimeout,
+		},
+		events:       newJobEventBroker(),
+		workflowRuns: make(chan string, workflowRunsBuffer),
+		modules:      newModuleCache(),
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s, nil
 }
 
 func (s *Server) prepare(ctx context.Context, listenPort uint) error {
@@ -38,11 +115,34 @@ func (s *Server) prepare(ctx context.Context, listenPort uint) error {
 	}
 
 	if s.enableJobs {
+		// every consumer gets a single unacked message at once
+		if err := s.queue.Qos(1, 0, false); err != nil {
+			return fmt.Errorf("unable to set queue qos: %v", err)
+		}
+
+		go s.consumeJobStarts(ctx)
+		go s.consumeJobLogs(ctx)
 		go s.consumeJobResults(ctx)
 		go s.produceJobs(ctx)
+		go s.watchJobTimeouts(ctx)
+		go s.deliverCallbacks(ctx)
+
+		if s.scheduleDB != nil {
+			go s.runSchedules(ctx)
+		}
+
+		if s.workflowDB != nil {
+			go s.orchestrateWorkflows(ctx)
+		}
 	}
 
 	if s.enableAPI {
+		queueName, err := s.bindJobEvents()
+		if err != nil {
+			return err
+		}
+		go s.consumeJobEvents(ctx, queueName)
+
 		if err := s.setupAPI(ctx, listenPort); err != nil {
 			return err
 		}
@@ -65,14 +165,75 @@ func (s *Server) Start(ctx context.Context, listenPort uint) error {
 
 func (s *Server) setupAPI(ctx context.Context, listenPort uint) error {
 	r := mux.NewRouter()
+	r.NotFoundHandler = http.HandlerFunc(s.notFoundHandler)
+	r.MethodNotAllowedHandler = http.HandlerFunc(s.methodNotAllowedHandler)
 	authHandler := newAuthHandler(s.logger, s.apiToken)
 
+	// streaming routes are registered in front of the jobs routes, as they must not be limited by the write timeout
+	r.Handle("/jobs/events", authHandler.Middleware(http.HandlerFunc(s.StreamJobEvents))).Methods(http.MethodGet)
+	r.Handle("/jobs/{id}/events", authHandler.Middleware(http.HandlerFunc(s.StreamJobEventsByID))).Methods(http.MethodGet)
+	r.Handle("/jobs/{id}/logs", authHandler.Middleware(http.HandlerFunc(s.GetJobLogs))).Methods(http.MethodGet)
+	if s.artifacts != nil {
+		// artifacts may be too large to be sent within the write timeout
+		r.Handle("/jobs/{id}/artifacts/{name}", authHandler.Middleware(http.HandlerFunc(s.GetJobArtifact))).Methods(http.MethodGet)
+	}
+
 	jobs := r.PathPrefix("/jobs").Subrouter()
-	jobs.Use(authHandler.Middleware)
+	jobs.Use(authHandler.Middleware, timeoutMiddleware)
 	jobs.HandleFunc("", s.GetJobs).Methods(http.MethodGet)
 	jobs.HandleFunc("", s.CreateJob).Methods(http.MethodPost)
+	jobs.HandleFunc("/batch", s.CreateJobs).Methods(http.MethodPost)
 	jobs.HandleFunc("/{id}", s.GetJob).Methods(http.MethodGet)
 	jobs.HandleFunc("/{id}", s.DeleteJob).Methods(http.MethodDelete)
+	jobs.HandleFunc("/{id}/cancel", s.CancelJob).Methods(http.MethodPost)
+
+	batches := r.PathPrefix("/batches").Subrouter()
+	batches.Use(authHandler.Middleware, timeoutMiddleware)
+	batches.HandleFunc("/{id}", s.GetBatch).Methods(http.MethodGet)
+	batches.HandleFunc("/{id}", s.DeleteBatch).Methods(http.MethodDelete)
+	batches.HandleFunc("/{id}/cancel", s.CancelBatch).Methods(http.MethodPost)
+
+	if s.scheduleDB != nil {
+		schedules := r.PathPrefix("/schedules").Subrouter()
+		schedules.Use(authHandler.Middleware, timeoutMiddleware)
+		schedules.HandleFunc("", s.GetSchedules).Methods(http.MethodGet)
+		schedules.HandleFunc("", s.CreateSchedule).Methods(http.MethodPost)
+		schedules.HandleFunc("/{id}", s.GetSchedule).Methods(http.MethodGet)
+		schedules.HandleFunc("/{id}", s.UpdateSchedule).Methods(http.MethodPut)
+		schedules.HandleFunc("/{id}", s.DeleteSchedule).Methods(http.MethodDelete)
+		schedules.HandleFunc("/{id}/pause", s.PauseSchedule).Methods(http.MethodPost)
+		schedules.HandleFunc("/{id}/resume", s.ResumeSchedule).Methods(http.MethodPost)
+	}
+
+	if s.workflowDB != nil {
+		workflows := r.PathPrefix("/workflows").Subrouter()
+		workflows.Use(authHandler.Middleware, timeoutMiddleware)
+		workflows.HandleFunc("", s.GetWorkflows).Methods(http.MethodGet)
+		workflows.HandleFunc("", s.CreateWorkflow).Methods(http.MethodPost)
+		workflows.HandleFunc("/{name}", s.GetWorkflow).Methods(http.MethodGet)
+		workflows.HandleFunc("/{name}/versions/{version:[0-9]+}", s.GetWorkflow).Methods(http.MethodGet)
+		workflows.HandleFunc("/{name}/runs", s.CreateWorkflowRun).Methods(http.MethodPost)
+		workflows.HandleFunc("/{name}/runs/{id}", s.GetWorkflowRun).Methods(http.MethodGet)
+	}
+
+	if s.templateDB != nil {
+		templates := r.PathPrefix("/templates").Subrouter()
+		templates.Use(authHandler.Middleware, timeoutMiddleware)
+		templates.HandleFunc("", s.GetTemplates).Methods(http.MethodGet)
+		templates.HandleFunc("", s.CreateTemplate).Methods(http.MethodPost)
+		templates.HandleFunc("/{name}", s.GetTemplate).Methods(http.MethodGet)
+		templates.HandleFunc("/{name}/versions/{version:[0-9]+}", s.GetTemplate).Methods(http.MethodGet)
+		templates.HandleFunc("/{name}/jobs", s.CreateTemplateJob).Methods(http.MethodPost)
+	}
+
+	if s.moduleDB != nil {
+		modules := r.PathPrefix("/modules").Subrouter()
+		modules.Use(authHandler.Middleware, timeoutMiddleware)
+		modules.HandleFunc("", s.GetModules).Methods(http.MethodGet)
+		modules.HandleFunc("", s.CreateModule).Methods(http.MethodPost)
+		modules.HandleFunc("/{name}", s.GetModule).Methods(http.MethodGet)
+		modules.HandleFunc("/{name}/versions/{version:[0-9]+}", s.GetModule).Methods(http.MethodGet)
+	}
 
 	r.Methods(http.MethodGet).Path("/healthz").HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
 		if _, err := fmt.Fprint(rw, "ok"); err != nil {
@@ -80,13 +241,15 @@ func (s *Server) setupAPI(ctx context.Context, listenPort uint) error {
 		}
 	})
 
+	// there is no WriteTimeout as it would close the event streams, the timeoutMiddleware
+	// limits all other requests instead.
 	s.srv = &http.Server{
-		Addr:         fmt.Sprintf("0.0.0.0:%d", listenPort),
-		WriteTimeout: time.Second * 15,
-		ReadTimeout:  time.Second * 15,
-		IdleTimeout:  time.Second * 60,
-		Handler:      r,
+		Addr:        fmt.Sprintf("0.0.0.0:%d", listenPort),
+		ReadTimeout: time.Second * 15,
+		IdleTimeout: time.Second * 60,
+		Handler:     requestIDMiddleware(r),
 	}
+	s.srv.RegisterOnShutdown(s.events.close)
 
 	go func() {
 		<-ctx.Done()
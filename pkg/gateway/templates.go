@@ -0,0 +1,92 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/aklinkert/go-logging"
+	"github.com/gorilla/mux"
+
+	"github.com/scalify/puppet-master-gateway/pkg/api"
+)
+
+func (s *Server) loggerForTemplate(name string) logging.Logger {
+	return s.loggerWithField(api.LogFieldTemplate, name)
+}
+
+func (s *Server) templateResource() *versionedResource {
+	return &versionedResource{
+		kind:   "template",
+		db:     s.templateDB,
+		newDoc: func() api.Versioned { return &api.Template{} },
+		logger: s.loggerForTemplate,
+	}
+}
+
+// CreateTemplate validates a template and stores it as the next version of the template with its name
+func (s *Server) CreateTemplate(rw http.ResponseWriter, req *http.Request) {
+	s.createVersion(rw, req, s.templateResource())
+}
+
+// GetTemplates returns a paginated list of all versions of all templates
+func (s *Server) GetTemplates(rw http.ResponseWriter, req *http.Request) {
+	s.getVersions(rw, req, s.templateResource())
+}
+
+// loadTemplate reads the given version of the template from the database, or the latest one if
+// version is 0, and writes an error response if that fails
+func (s *Server) loadTemplate(rw http.ResponseWriter, name string, version int, logger logging.Logger) (*api.Template, bool) {
+	template := &api.Template{}
+	if !s.loadVersion(rw, s.templateResource(), name, version, template, logger) {
+		return nil, false
+	}
+
+	return template, true
+}
+
+// GetTemplate returns the requested version of a template, the latest one if no version is given
+func (s *Server) GetTemplate(rw http.ResponseWriter, req *http.Request) {
+	s.getVersion(rw, req, s.templateResource())
+}
+
+// CreateTemplateJob creates a job from the code and modules of a template and the vars of the
+// request body. The latest version of the template is used unless the version query param is set.
+func (s *Server) CreateTemplateJob(rw http.ResponseWriter, req *http.Request) {
+	rw.Header().Add(api.ContentTypeHeader, api.ContentTypeJSON)
+
+	name := mux.Vars(req)["name"]
+	logger := s.loggerForTemplate(name)
+
+	version, err := s.getQueryParamAsInt(req, "version", 0)
+	if err != nil {
+		logger.Debugf("Invalid template version: %v", err)
+		writeError(rw, api.NewError(http.StatusBadRequest, api.ErrorCodeInvalidResource, "invalid template job: %v", err), logger)
+		return
+	}
+
+	job := api.NewJob()
+	if err := json.NewDecoder(http.MaxBytesReader(rw, req.Body, maxJobRequestSize)).Decode(job); err != nil {
+		s.writeDecodeError(rw, err, maxJobRequestSize, logger)
+		return
+	}
+
+	template, ok := s.loadTemplate(rw, name, version, logger)
+	if !ok {
+		return
+	}
+
+	if err := template.Apply(job); err != nil {
+		logger.Debugf("Invalid template job: %v", err)
+		writeError(rw, api.NewError(http.StatusBadRequest, api.ErrorCodeInvalidResource, "invalid template job: %v", err), logger)
+		return
+	}
+
+	if err := api.ValidateNewJob(job); err != nil {
+		s.writeInvalidJob(rw, err, logger)
+		return
+	}
+
+	// the reference is set after validation, as clients must not set it themselves
+	job.Template = api.VersionedID(template.Name, template.Version)
+	s.createJob(rw, job)
+}
@@ -0,0 +1,135 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aklinkert/go-logging"
+
+	"github.com/scalify/puppet-master-gateway/pkg/api"
+	internalTesting "github.com/scalify/puppet-master-gateway/pkg/internal/testing"
+)
+
+func newTestTemplate(version int) *api.Template {
+	return &api.Template{
+		VersionMeta: api.VersionMeta{UUID: api.VersionedID("scrape", version), Name: "scrape", Version: version},
+		Code:        fmt.Sprintf("scrape(%d)", version),
+		Modules:     map[string]string{"helper": "export default 1"},
+		Vars: []api.Param{
+			{Name: "url", Required: true},
+			{Name: "depth", Default: "1"},
+		},
+	}
+}
+
+func TestServerCreateTemplate(t *testing.T) {
+	q := internalTesting.NewTestQueue()
+	db := internalTesting.NewTestDB()
+	templateDB := internalTesting.NewTestVersionDB()
+	l := logging.NewTestLogger(t)
+
+	s, err := NewServer(db, q, l, "test", true, false, WithTemplateDB(templateDB))
+	if err != nil {
+		t.Log(err)
+		t.Fatal(fmt.Sprintf("failed to start server: %v", err))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	go startServer(ctx, t, s)
+	time.Sleep(100 * time.Millisecond)
+
+	templateDB.Docs = append(templateDB.Docs, newTestTemplate(1))
+
+	b, err := json.Marshal(newTestTemplate(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/templates", bytes.NewReader(b))
+	addAPITokenHeader(req, "test")
+	rw := httptest.NewRecorder()
+	s.srv.Handler.ServeHTTP(rw, req)
+
+	if rw.Code != 201 {
+		t.Errorf("Unexpected http response: %v", rw.Result().Status)
+	}
+
+	t.Logf("CreateTemplate response: %q", rw.Body.String())
+
+	if len(templateDB.Saved) != 1 {
+		t.Fatalf("Unexpected count of saved templates: %d", len(templateDB.Saved))
+	}
+
+	if saved := templateDB.Saved[0].Meta(); saved.Version != 2 || saved.UUID != "scrape@2" {
+		t.Errorf("Expected the next version to be saved, got %s", saved.UUID)
+	}
+}
+
+func TestServerCreateTemplateJob(t *testing.T) {
+	q := internalTesting.NewTestQueue()
+	db := internalTesting.NewTestDB()
+	templateDB := internalTesting.NewTestVersionDB()
+	l := logging.NewTestLogger(t)
+
+	s, err := NewServer(db, q, l, "test", true, false, WithTemplateDB(templateDB))
+	if err != nil {
+		t.Log(err)
+		t.Fatal(fmt.Sprintf("failed to start server: %v", err))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	go startServer(ctx, t, s)
+	time.Sleep(100 * time.Millisecond)
+
+	templateDB.Docs = append(templateDB.Docs, newTestTemplate(1), newTestTemplate(2))
+
+	req := httptest.NewRequest(http.MethodPost, "/templates/scrape/jobs?version=1", bytes.NewBufferString(`{"vars":{"url":"https://example.com"},"priority":3}`))
+	addAPITokenHeader(req, "test")
+	rw := httptest.NewRecorder()
+	s.srv.Handler.ServeHTTP(rw, req)
+
+	if rw.Code != 201 {
+		t.Errorf("Unexpected http response: %v", rw.Result().Status)
+	}
+
+	t.Logf("CreateTemplateJob response: %q", rw.Body.String())
+
+	if len(db.SavedJobs) != 1 {
+		t.Fatalf("Unexpected count of saved jobs: %d", len(db.SavedJobs))
+	}
+
+	job := db.SavedJobs[0]
+	if job.Code != "scrape(1)" || job.Template != "scrape@1" || job.Priority != 3 {
+		t.Errorf("Expected job from template version 1, got %+v", job)
+	}
+
+	if job.Vars["url"] != "https://example.com" || job.Vars["depth"] != "1" || job.Status != api.JobStatusCreated {
+		t.Errorf("Unexpected job: %+v", job)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/templates/scrape/jobs", bytes.NewBufferString(`{"vars":{}}`))
+	addAPITokenHeader(req, "test")
+	rw = httptest.NewRecorder()
+	s.srv.Handler.ServeHTTP(rw, req)
+
+	if rw.Code != 400 {
+		t.Errorf("Unexpected http response for missing vars: %v", rw.Result().Status)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/templates/unknown/jobs", bytes.NewBufferString(`{"vars":{}}`))
+	addAPITokenHeader(req, "test")
+	rw = httptest.NewRecorder()
+	s.srv.Handler.ServeHTTP(rw, req)
+
+	if rw.Code != 404 {
+		t.Errorf("Unexpected http response for unknown template: %v", rw.Result().Status)
+	}
+}
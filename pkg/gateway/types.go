@@ -1,21 +1,60 @@
 package gateway
 
 import (
+	"io"
+	"time"
+
 	"github.com/streadway/amqp"
 
 	"github.com/scalify/puppet-master-gateway/pkg/api"
+	"github.com/scalify/puppet-master-gateway/pkg/database"
 )
 
 type db interface {
-	GetList(page, perPage int) ([]*api.Job, error)
-	GetListByStatus(status string, page, perPage int) ([]*api.Job, error)
+	GetListByStatus(status string, fields []string, page, perPage int) ([]*api.Job, error)
+	GetListByUUIDs(ids []string, fields []string) ([]*api.Job, error)
+	GetListByBatchID(batchID, status string, fields []string, bookmark string, perPage int) ([]*api.Job, string, error)
+	GetPage(query *database.JobQuery) (*database.JobPage, error)
+	GetDueListByStatus(status string, now time.Time, page, perPage int) ([]*api.Job, error)
+	GetPendingCallbackList(now time.Time, page, perPage int) ([]*api.Job, error)
 	Get(id string) (*api.Job, error)
 	Save(job *api.Job) error
+	SaveMany(jobs []*api.Job) ([]error, error)
 	Delete(job *api.Job) error
+	DeleteMany(jobs []*api.Job) ([]error, error)
+}
+
+type scheduleDB interface {
+	GetList(page, perPage int) ([]*api.Schedule, error)
+	GetDueList(now time.Time, page, perPage int) ([]*api.Schedule, error)
+	Get(id string) (*api.Schedule, error)
+	Save(schedule *api.Schedule) error
+	Delete(schedule *api.Schedule) error
+}
+
+type versionDB interface {
+	GetList(page, perPage int, newDoc func() api.Versioned) ([]api.Versioned, error)
+	GetLatest(name string, doc api.Versioned) error
+	GetVersion(name string, version int, doc api.Versioned) error
+	Save(doc api.Versioned) error
+}
+
+type workflowRunDB interface {
+	GetListByStatus(status string, page, perPage int) ([]*api.WorkflowRun, error)
+	Get(id string) (*api.WorkflowRun, error)
+	Save(run *api.WorkflowRun) error
+}
+
+type artifactStore interface {
+	Put(jobID, name, contentType string, data []byte) error
+	Get(jobID, name string) (io.ReadCloser, error)
+	Delete(jobID, name string) error
 }
 
 type queue interface {
+	ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error
 	QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error)
+	QueueBind(name, key, exchange string, noWait bool, args amqp.Table) error
 	Consume(queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args amqp.Table) (<-chan amqp.Delivery, error)
 	Publish(exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error
 	Qos(prefetchCount, prefetchSize int, global bool) error
@@ -28,10 +28,23 @@ func newTestJob(t *testing.T, uuid string) (*api.Job, []byte) {
 	return job, b
 }
 
+// newTestSubmittedJob returns a test job as submitted by a client, without server owned fields
+func newTestSubmittedJob(t *testing.T, uuid string) (*api.Job, []byte) {
+	job, _ := newTestJob(t, uuid)
+	job.CreatedAt = api.JSONTime{}
+
+	b, err := json.Marshal(job)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return job, b
+}
+
 func newTestJobResult(t *testing.T, uuid string) (*api.JobResult, []byte) {
 	res := api.NewJobResult()
 	res.UUID = uuid
-	res.Error = "test-" + uuid
+	res.Error = &api.JobError{Kind: "Error", Message: "test-" + uuid}
 	res.StartedAt = &testTime
 	res.FinishedAt = &testTime
 	res.Results = map[string]interface{}{
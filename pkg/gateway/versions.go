@@ -0,0 +1,161 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aklinkert/go-logging"
+	"github.com/gorilla/mux"
+
+	"github.com/scalify/puppet-master-gateway/pkg/api"
+	"github.com/scalify/puppet-master-gateway/pkg/database"
+)
+
+// versionedResource describes a resource that is stored as immutable versions, like templates,
+// modules and workflows, for the handlers shared between them
+type versionedResource struct {
+	kind   string
+	db     versionDB
+	newDoc func() api.Versioned
+	logger func(name string) logging.Logger
+	// prepare is called with every new version right before it is saved
+	prepare func(doc api.Versioned)
+}
+
+type versionResponse struct {
+	Data api.Versioned `json:"data"`
+}
+
+type versionsResponse struct {
+	Data []api.Versioned `json:"data"`
+}
+
+// getVersionOrLatest reads the given version of a resource into doc, or the latest one if version is 0
+func getVersionOrLatest(db versionDB, name string, version int, doc api.Versioned) error {
+	if version > 0 {
+		return db.GetVersion(name, version, doc)
+	}
+
+	return db.GetLatest(name, doc)
+}
+
+// createVersion validates the resource of the request body and stores it as the next version of
+// the resource with its name
+func (s *Server) createVersion(rw http.ResponseWriter, req *http.Request, r *versionedResource) {
+	rw.Header().Add(api.ContentTypeHeader, api.ContentTypeJSON)
+
+	doc := r.newDoc()
+	if err := json.NewDecoder(req.Body).Decode(doc); err != nil {
+		s.logger.Errorf("Failed to decode json body: %v", err)
+		writeError(rw, api.NewError(http.StatusBadRequest, api.ErrorCodeInvalidBody, "failed to decode json body: %v", err), s.logger)
+		return
+	}
+
+	meta := doc.Meta()
+	logger := r.logger(meta.Name)
+	if err := doc.Validate(); err != nil {
+		logger.Debugf("Invalid %s: %v", r.kind, err)
+		writeError(rw, api.NewError(http.StatusBadRequest, api.ErrorCodeInvalidResource, "invalid %s: %v", r.kind, err), logger)
+		return
+	}
+
+	meta.Version = 1
+	latest := r.newDoc()
+	err := r.db.GetLatest(meta.Name, latest)
+	switch {
+	case err == nil:
+		meta.Version = latest.Meta().Version + 1
+	case err != database.ErrNotFound:
+		logger.Errorf("Failed to load latest %s version: %v", r.kind, err)
+		writeError(rw, api.NewError(http.StatusInternalServerError, api.ErrorCodeInternal, "failed to fetch %s: %v", r.kind, err), logger)
+		return
+	}
+
+	meta.Rev = ""
+	meta.CreatedAt = api.JSONTime{Time: time.Now()}
+	if r.prepare != nil {
+		r.prepare(doc)
+	}
+
+	if err := r.db.Save(doc); err != nil {
+		// a conflict means the same version has been created concurrently
+		logger.Errorf("Failed to save %s: %v", r.kind, err)
+		writeError(rw, saveError(r.kind, err), logger)
+		return
+	}
+
+	rw.WriteHeader(http.StatusCreated)
+	meta.Rev = ""
+	if err := json.NewEncoder(rw).Encode(&versionResponse{Data: doc}); err != nil {
+		logger.Errorf("Failed to encode %s: %v", r.kind, err)
+	}
+}
+
+// getVersions returns a paginated list of all versions of all resources
+func (s *Server) getVersions(rw http.ResponseWriter, req *http.Request, r *versionedResource) {
+	rw.Header().Add(api.ContentTypeHeader, api.ContentTypeJSON)
+
+	page, perPage, err := s.getPageAndPerPage(req)
+	if err != nil {
+		s.logger.Debugf("Invalid pagination params: %v", err)
+		writeError(rw, api.NewError(http.StatusBadRequest, api.ErrorCodeInvalidParameter, "%v", err), s.logger)
+		return
+	}
+
+	docs, err := r.db.GetList(page, perPage, r.newDoc)
+	if err != nil {
+		s.logger.Errorf("Failed to load %ss: %v", r.kind, err)
+		writeError(rw, api.NewError(http.StatusInternalServerError, api.ErrorCodeInternal, "failed to fetch %s list: %v", r.kind, err), s.logger)
+		return
+	}
+
+	for _, doc := range docs {
+		doc.Meta().Rev = ""
+	}
+
+	if err := json.NewEncoder(rw).Encode(&versionsResponse{Data: docs}); err != nil {
+		s.logger.Errorf("Failed to encode %ss: %v", r.kind, err)
+	}
+}
+
+// loadVersion reads the given version of the resource from the database into doc, or the latest
+// one if version is 0, and writes an error response if that fails
+func (s *Server) loadVersion(rw http.ResponseWriter, r *versionedResource, name string, version int, doc api.Versioned, logger logging.Logger) bool {
+	if err := getVersionOrLatest(r.db, name, version, doc); err != nil {
+		if err == database.ErrNotFound {
+			logger.Debugf("Failed to find %s in database", r.kind)
+			writeError(rw, api.NewError(http.StatusNotFound, api.ErrorCodeNotFound, "%s %s not found", r.kind, name), logger)
+			return false
+		}
+
+		logger.Errorf("Failed to load %s: %v", r.kind, err)
+		writeError(rw, api.NewError(http.StatusInternalServerError, api.ErrorCodeInternal, "failed to fetch %s: %v", r.kind, err), logger)
+		return false
+	}
+
+	return true
+}
+
+// getVersion returns the requested version of a resource, the latest one if no version is given
+func (s *Server) getVersion(rw http.ResponseWriter, req *http.Request, r *versionedResource) {
+	rw.Header().Add(api.ContentTypeHeader, api.ContentTypeJSON)
+
+	vars := mux.Vars(req)
+	name := vars["name"]
+	logger := r.logger(name)
+
+	// the route only matches digits
+	version, _ := strconv.Atoi(vars["version"])
+
+	doc := r.newDoc()
+	if !s.loadVersion(rw, r, name, version, doc, logger) {
+		return
+	}
+
+	doc.Meta().Rev = ""
+	if err := json.NewEncoder(rw).Encode(&versionResponse{Data: doc}); err != nil {
+		logger.Errorf("Failed to encode %s: %v", r.kind, err)
+	}
+}
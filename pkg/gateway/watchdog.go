@@ -0,0 +1,93 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/scalify/puppet-master-gateway/pkg/api"
+)
+
+const (
+	watchdogInterval = 5 * time.Second
+	watchdogPerPage  = 100
+)
+
+// watchJobTimeouts periodically looks for queued and running jobs which exceeded their timeout
+func (s *Server) watchJobTimeouts(ctx context.Context) {
+	ticker := time.NewTicker(watchdogInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for _, status := range []string{api.JobStatusQueued, api.JobStatusRunning} {
+			s.checkJobTimeouts(status, time.Now())
+		}
+	}
+}
+
+func (s *Server) checkJobTimeouts(status string, now time.Time) {
+	// all timed out jobs are collected first, as timing them out moves them out of the status and
+	// shifts the later pages
+	var timedOut []*api.Job
+	for page := 1; ; page++ {
+		jobs, err := s.db.GetListByStatus(status, nil, page, watchdogPerPage)
+		if err != nil {
+			s.logger.Errorf("Failed to get %s jobs: %v", status, err)
+			return
+		}
+
+		for _, job := range jobs {
+			if job.IsTimedOut(now) {
+				timedOut = append(timedOut, job)
+			}
+		}
+
+		if len(jobs) < watchdogPerPage {
+			break
+		}
+	}
+
+	for _, job := range timedOut {
+		s.timeoutJob(job, now)
+	}
+}
+
+func (s *Server) timeoutJob(job *api.Job, now time.Time) {
+	l := s.loggerForJob(job)
+	attempt := job.Attempt
+
+	job.Error = &api.JobError{
+		Kind:    api.JobErrorKindTimeout,
+		Message: fmt.Sprintf("job did not finish within %dms", job.Timeout),
+	}
+	job.FinishedAt = &api.JSONTime{Time: now}
+	job.RecordAttempt()
+
+	if job.ShouldRetry() {
+		job.Retry(now)
+		l.Infof("Attempt %d of job timed out, retrying at %s.", job.Attempt, job.RunAt)
+	} else {
+		job.Status = api.JobStatusTimedOut
+		job.ScheduleCallback(now)
+		l.Infof("Job timed out after %dms.", job.Timeout)
+	}
+
+	if err := s.db.Save(job); err != nil {
+		l.Errorf("Failed to save timed out job: %v", err)
+		return
+	}
+
+	s.publishJobEvent(api.JobEventStatus, job)
+	s.notifyWorkflowRun(job)
+
+	// the executor might still be working on the timed out attempt, tell it to stop
+	if err := s.publishJobCancellation(job, attempt); err != nil {
+		l.Errorf("Failed to publish job cancellation: %v", err)
+	}
+}
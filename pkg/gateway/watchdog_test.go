@@ -0,0 +1,107 @@
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aklinkert/go-logging"
+
+	"github.com/scalify/puppet-master-gateway/pkg/api"
+	internalTesting "github.com/scalify/puppet-master-gateway/pkg/internal/testing"
+)
+
+func TestServer_checkJobTimeouts(t *testing.T) {
+	q := internalTesting.NewTestQueue()
+	db := internalTesting.NewTestDB()
+	l := logging.NewTestLogger(t)
+
+	s, err := NewServer(db, q, l, "test", true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	queuedAt := &api.JSONTime{Time: now.Add(-time.Minute)}
+
+	timedOut, _ := newTestJob(t, "asdf-1234-asdf-1234")
+	timedOut.Status = api.JobStatusRunning
+	timedOut.QueuedAt = queuedAt
+	timedOut.Timeout = 1000
+
+	retried, _ := newTestJob(t, "asdf-5678-asdf-5678")
+	retried.Status = api.JobStatusRunning
+	retried.QueuedAt = queuedAt
+	retried.Timeout = 1000
+	retried.MaxRetries = 1
+
+	withinTimeout, _ := newTestJob(t, "asdf-9012-asdf-9012")
+	withinTimeout.Status = api.JobStatusRunning
+	withinTimeout.QueuedAt = queuedAt
+	withinTimeout.Timeout = 120000
+
+	db.Jobs = []*api.Job{timedOut, retried, withinTimeout}
+
+	s.checkJobTimeouts(api.JobStatusRunning, now)
+
+	if timedOut.Status != api.JobStatusTimedOut {
+		t.Errorf("Expected job to have status %s, got %s", api.JobStatusTimedOut, timedOut.Status)
+	}
+
+	if retried.Status != api.JobStatusCreated {
+		t.Errorf("Expected job to be retried with status %s, got %s", api.JobStatusCreated, retried.Status)
+	}
+
+	if withinTimeout.Status != api.JobStatusRunning {
+		t.Errorf("Expected job to keep status %s, got %s", api.JobStatusRunning, withinTimeout.Status)
+	}
+
+	if len(db.SavedJobs) != 2 {
+		t.Errorf("Unexpected count of saved jobs: %d", len(db.SavedJobs))
+	}
+
+	if len(q.Messages) != 2 {
+		t.Errorf("Unexpected count of published cancellations: %d", len(q.Messages))
+	}
+
+	for _, msg := range q.Messages {
+		cancellation := &api.JobCancellation{}
+		if err := json.Unmarshal(msg, cancellation); err != nil {
+			t.Fatal(err)
+		}
+
+		// the retry runs as attempt 1, only the timed out attempt must be aborted
+		if cancellation.Attempt != 0 {
+			t.Errorf("Expected cancellation of %s to abort attempt 0, got %d", cancellation.UUID, cancellation.Attempt)
+		}
+	}
+}
+
+func TestServer_checkJobTimeoutsPages(t *testing.T) {
+	q := internalTesting.NewTestQueue()
+	db := internalTesting.NewTestDB()
+	l := logging.NewTestLogger(t)
+
+	s, err := NewServer(db, q, l, "test", true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	for i := 0; i < 2*watchdogPerPage+1; i++ {
+		job, _ := newTestJob(t, fmt.Sprintf("job-%d", i))
+		job.Status = api.JobStatusRunning
+		job.QueuedAt = &api.JSONTime{Time: now.Add(-time.Minute)}
+		job.Timeout = 1000
+		db.Jobs = append(db.Jobs, job)
+	}
+
+	s.checkJobTimeouts(api.JobStatusRunning, now)
+
+	for _, job := range db.Jobs {
+		if job.Status != api.JobStatusTimedOut {
+			t.Fatalf("Expected job %s to have status %s, got %s", job.UUID, api.JobStatusTimedOut, job.Status)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/aklinkert/go-logging"
+	"github.com/gorilla/mux"
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/scalify/puppet-master-gateway/pkg/api"
+	"github.com/scalify/puppet-master-gateway/pkg/database"
+)
+
+func (s *Server) loggerForWorkflow(name string) logging.Logger {
+	return s.loggerWithField(api.LogFieldWorkflow, name)
+}
+
+func (s *Server) loggerForWorkflowRun(id string) logging.Logger {
+	return s.loggerWithField(api.LogFieldWorkflowRunID, id)
+}
+
+func (s *Server) workflowResource() *versionedResource {
+	return &versionedResource{
+		kind:   "workflow",
+		db:     s.workflowDB,
+		newDoc: func() api.Versioned { return &api.Workflow{} },
+		logger: s.loggerForWorkflow,
+	}
+}
+
+// CreateWorkflow validates a workflow and stores it as the next version of the workflow with its name
+func (s *Server) CreateWorkflow(rw http.ResponseWriter, req *http.Request) {
+	s.createVersion(rw, req, s.workflowResource())
+}
+
+// GetWorkflows returns a paginated list of all versions of all workflows
+func (s *Server) GetWorkflows(rw http.ResponseWriter, req *http.Request) {
+	s.getVersions(rw, req, s.workflowResource())
+}
+
+// loadWorkflow reads the given version of the workflow from the database, or the latest one if
+// version is 0, and writes an error response if that fails
+func (s *Server) loadWorkflow(rw http.ResponseWriter, name string, version int, logger logging.Logger) (*api.Workflow, bool) {
+	workflow := &api.Workflow{}
+	if !s.loadVersion(rw, s.workflowResource(), name, version, workflow, logger) {
+		return nil, false
+	}
+
+	return workflow, true
+}
+
+// GetWorkflow returns the requested version of a workflow, the latest one if no version is given
+func (s *Server) GetWorkflow(rw http.ResponseWriter, req *http.Request) {
+	s.getVersion(rw, req, s.workflowResource())
+}
+
+// CreateWorkflowRun starts a new run of a workflow and creates the jobs of its first steps
+func (s *Server) CreateWorkflowRun(rw http.ResponseWriter, req *http.Request) {
+	rw.Header().Add(api.ContentTypeHeader, api.ContentTypeJSON)
+
+	vars := mux.Vars(req)
+	name := vars["name"]
+	logger := s.loggerForWorkflow(name)
+
+	runRequest := &api.WorkflowRunRequest{}
+	if err := json.NewDecoder(req.Body).Decode(runRequest); err != nil {
+		logger.Errorf("Failed to decode json body: %v", err)
+		writeError(rw, api.NewError(http.StatusBadRequest, api.ErrorCodeInvalidBody, "failed to decode json body: %v", err), logger)
+		return
+	}
+
+	workflow, ok := s.loadWorkflow(rw, name, runRequest.Version, logger)
+	if !ok {
+		return
+	}
+
+	run, err := workflow.NewRun(uuid.NewV4().String(), runRequest.Params, time.Now())
+	if err != nil {
+		logger.Debugf("Invalid workflow run: %v", err)
+		writeError(rw, api.NewError(http.StatusBadRequest, api.ErrorCodeInvalidResource, "invalid workflow run: %v", err), logger)
+		return
+	}
+
+	logger = s.loggerForWorkflowRun(run.UUID)
+	if err := s.workflowRunDB.Save(run); err != nil {
+		logger.Errorf("Failed to save workflow run: %v", err)
+		writeError(rw, api.NewError(http.StatusInternalServerError, api.ErrorCodeInternal, "failed to save workflow run: %v", err), logger)
+		return
+	}
+
+	if err := s.advanceWorkflowRun(workflow, run); err != nil {
+		// the orchestrator retries this on its next sweep
+		logger.Errorf("Failed to advance workflow run: %v", err)
+	}
+
+	rw.WriteHeader(http.StatusCreated)
+	run.Rev = ""
+	runResponse := &api.WorkflowRunResponse{Data: run}
+	if err := json.NewEncoder(rw).Encode(runResponse); err != nil {
+		logger.Errorf("Failed to encode workflow run: %v", err)
+	}
+}
+
+// GetWorkflowRun returns a run of a workflow with the job and status of each step
+func (s *Server) GetWorkflowRun(rw http.ResponseWriter, req *http.Request) {
+	rw.Header().Add(api.ContentTypeHeader, api.ContentTypeJSON)
+
+	vars := mux.Vars(req)
+	runID := vars["id"]
+	logger := s.loggerForWorkflowRun(runID)
+
+	run, err := s.workflowRunDB.Get(runID)
+	if err == nil && run.Workflow != vars["name"] {
+		err = database.ErrNotFound
+	}
+
+	if err != nil {
+		if err == database.ErrNotFound {
+			logger.Debugf("Failed to find workflow run in database")
+			writeError(rw, api.NewError(http.StatusNotFound, api.ErrorCodeNotFound, "workflow run %s not found", runID), logger)
+			return
+		}
+
+		logger.Errorf("Failed to load workflow run: %v", err)
+		writeError(rw, api.NewError(http.StatusInternalServerError, api.ErrorCodeInternal, "failed to fetch workflow run: %v", err), logger)
+		return
+	}
+
+	run.Rev = ""
+	runResponse := &api.WorkflowRunResponse{Data: run}
+	if err := json.NewEncoder(rw).Encode(runResponse); err != nil {
+		logger.Errorf("Failed to encode workflow run: %v", err)
+	}
+}
@@ -0,0 +1,132 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aklinkert/go-logging"
+
+	"github.com/scalify/puppet-master-gateway/pkg/api"
+	internalTesting "github.com/scalify/puppet-master-gateway/pkg/internal/testing"
+)
+
+func TestServerCreateWorkflow(t *testing.T) {
+	q := internalTesting.NewTestQueue()
+	db := internalTesting.NewTestDB()
+	workflowDB := internalTesting.NewTestVersionDB()
+	runDB := internalTesting.NewTestWorkflowRunDB()
+	l := logging.NewTestLogger(t)
+
+	s, err := NewServer(db, q, l, "test", true, false, WithWorkflowDB(workflowDB, runDB))
+	if err != nil {
+		t.Log(err)
+		t.Fatal(fmt.Sprintf("failed to start server: %v", err))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	go startServer(ctx, t, s)
+	time.Sleep(100 * time.Millisecond)
+
+	workflowDB.Docs = append(workflowDB.Docs, newTestWorkflow())
+
+	b, err := json.Marshal(newTestWorkflow())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/workflows", bytes.NewReader(b))
+	addAPITokenHeader(req, "test")
+	rw := httptest.NewRecorder()
+	s.srv.Handler.ServeHTTP(rw, req)
+
+	if rw.Code != 201 {
+		t.Errorf("Unexpected http response: %v", rw.Result().Status)
+	}
+
+	t.Logf("CreateWorkflow response: %q", rw.Body.String())
+
+	if len(workflowDB.Saved) != 1 {
+		t.Fatalf("Unexpected count of saved workflows: %d", len(workflowDB.Saved))
+	}
+
+	if saved := workflowDB.Saved[0].Meta(); saved.Version != 2 || saved.UUID != "login-and-scrape@2" {
+		t.Errorf("Expected the next version to be saved, got %s", saved.UUID)
+	}
+
+	invalid := newTestWorkflow()
+	invalid.Steps[0].DependsOn = []string{"report"}
+	b, err = json.Marshal(invalid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/workflows", bytes.NewReader(b))
+	addAPITokenHeader(req, "test")
+	rw = httptest.NewRecorder()
+	s.srv.Handler.ServeHTTP(rw, req)
+
+	if rw.Code != 400 {
+		t.Errorf("Unexpected http response for invalid workflow: %v", rw.Result().Status)
+	}
+}
+
+func TestServerCreateWorkflowRun(t *testing.T) {
+	q := internalTesting.NewTestQueue()
+	db := internalTesting.NewTestDB()
+	workflowDB := internalTesting.NewTestVersionDB()
+	runDB := internalTesting.NewTestWorkflowRunDB()
+	l := logging.NewTestLogger(t)
+
+	s, err := NewServer(db, q, l, "test", true, false, WithWorkflowDB(workflowDB, runDB))
+	if err != nil {
+		t.Log(err)
+		t.Fatal(fmt.Sprintf("failed to start server: %v", err))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	go startServer(ctx, t, s)
+	time.Sleep(100 * time.Millisecond)
+
+	workflowDB.Docs = append(workflowDB.Docs, newTestWorkflow())
+
+	req := httptest.NewRequest(http.MethodPost, "/workflows/login-and-scrape/runs", bytes.NewBufferString(`{"params":{"user":"a"}}`))
+	addAPITokenHeader(req, "test")
+	rw := httptest.NewRecorder()
+	s.srv.Handler.ServeHTTP(rw, req)
+
+	if rw.Code != 201 {
+		t.Errorf("Unexpected http response: %v", rw.Result().Status)
+	}
+
+	t.Logf("CreateWorkflowRun response: %q", rw.Body.String())
+
+	response := &api.WorkflowRunResponse{}
+	if err := json.Unmarshal(rw.Body.Bytes(), response); err != nil {
+		t.Fatalf("Failed to decode response body: %v", err)
+	}
+
+	if login := response.Data.Step("login"); login.JobUUID == "" || login.Status != api.JobStatusCreated {
+		t.Errorf("Expected login step to be started, got %+v", login)
+	}
+
+	if len(db.SavedJobs) != 1 {
+		t.Errorf("Unexpected count of saved jobs: %d", len(db.SavedJobs))
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/workflows/login-and-scrape/runs", bytes.NewBufferString(`{"params":{}}`))
+	addAPITokenHeader(req, "test")
+	rw = httptest.NewRecorder()
+	s.srv.Handler.ServeHTTP(rw, req)
+
+	if rw.Code != 400 {
+		t.Errorf("Unexpected http response for missing params: %v", rw.Result().Status)
+	}
+}
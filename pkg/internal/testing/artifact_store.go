@@ -0,0 +1,47 @@
+package testing
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+
+	"github.com/scalify/puppet-master-gateway/pkg/artifact"
+)
+
+// TestArtifactStore is an artifact store implementation used for testing
+type TestArtifactStore struct {
+	Artifacts    map[string][]byte
+	ContentTypes map[string]string
+}
+
+// NewTestArtifactStore returns a new TestArtifactStore instance
+func NewTestArtifactStore() *TestArtifactStore {
+	return &TestArtifactStore{
+		Artifacts:    make(map[string][]byte),
+		ContentTypes: make(map[string]string),
+	}
+}
+
+// Put adds the artifact to the Artifacts and ContentTypes fields, keyed by job id and name
+func (t *TestArtifactStore) Put(jobID, name, contentType string, data []byte) error {
+	t.Artifacts[jobID+"/"+name] = data
+	t.ContentTypes[jobID+"/"+name] = contentType
+	return nil
+}
+
+// Get returns the artifact from the Artifacts field
+func (t *TestArtifactStore) Get(jobID, name string) (io.ReadCloser, error) {
+	data, ok := t.Artifacts[jobID+"/"+name]
+	if !ok {
+		return nil, artifact.ErrNotFound
+	}
+
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
+
+// Delete removes the artifact from the Artifacts field
+func (t *TestArtifactStore) Delete(jobID, name string) error {
+	delete(t.Artifacts, jobID+"/"+name)
+	delete(t.ContentTypes, jobID+"/"+name)
+	return nil
+}
@@ -1,13 +1,21 @@
 package testing
 
 import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
 	"github.com/scalify/puppet-master-gateway/pkg/api"
 	"github.com/scalify/puppet-master-gateway/pkg/database"
 )
 
-// TestDB is a db implementation used for testing
+// TestDB is a db implementation used for testing. SaveErrors are returned by the next calls of
+// Save, in their order, before saving succeeds again. SaveManyCalls counts the bulk writes.
 type TestDB struct {
 	SavedJobs, DeletedJobs, Jobs []*api.Job
+	SaveErrors                   []error
+	SaveManyCalls                int
 }
 
 // NewTestDB returns a new TestDB instance
@@ -19,9 +27,154 @@ func NewTestDB() *TestDB {
 	}
 }
 
-// GetListByStatus returns all jobs withing the Jobs field
-func (t *TestDB) GetListByStatus(status string, page, perPage int) ([]*api.Job, error) {
-	return t.Jobs, nil
+// GetListByStatus returns the given page of jobs withing the Jobs field with the given status,
+// the jobs are never limited to the given fields
+func (t *TestDB) GetListByStatus(status string, fields []string, page, perPage int) ([]*api.Job, error) {
+	jobs := make([]*api.Job, 0, len(t.Jobs))
+	for _, j := range t.Jobs {
+		if j.Status == status {
+			jobs = append(jobs, j)
+		}
+	}
+
+	return paginate(jobs, page, perPage), nil
+}
+
+// GetListByUUIDs returns the jobs withing the Jobs field with one of the given UUIDs
+func (t *TestDB) GetListByUUIDs(ids []string, fields []string) ([]*api.Job, error) {
+	jobs := make([]*api.Job, 0, len(ids))
+	for _, id := range ids {
+		if j, err := t.Get(id); err == nil {
+			jobs = append(jobs, j)
+		}
+	}
+
+	return jobs, nil
+}
+
+// GetListByBatchID returns the page of jobs withing the Jobs field which belong to the given batch,
+// the bookmark is the offset of the page
+func (t *TestDB) GetListByBatchID(batchID, status string, fields []string, bookmark string, perPage int) ([]*api.Job, string, error) {
+	jobs := make([]*api.Job, 0, len(t.Jobs))
+	for _, j := range t.Jobs {
+		if j.BatchID == batchID && (status == "" || j.Status == status) {
+			jobs = append(jobs, j)
+		}
+	}
+
+	offset := 0
+	if bookmark != "" {
+		var err error
+		if offset, err = strconv.Atoi(bookmark); err != nil {
+			return nil, "", err
+		}
+	}
+
+	page := paginateFrom(jobs, offset, perPage)
+	return page, strconv.Itoa(offset + len(page)), nil
+}
+
+// GetPage returns the page of jobs withing the Jobs field selected by the query, bookmarks are
+// the offset of the next page. Sorting is supported by created_at and priority only, the fields
+// of the query are ignored.
+func (t *TestDB) GetPage(query *database.JobQuery) (*database.JobPage, error) {
+	jobs := make([]*api.Job, 0, len(t.Jobs))
+	for _, j := range t.Jobs {
+		if matchJobFilter(&query.JobFilter, j) {
+			jobs = append(jobs, j)
+		}
+	}
+
+	if query.Sort != nil {
+		less := func(i, k int) bool {
+			if query.Sort.Field == database.JobSortPriority {
+				return jobs[i].Priority < jobs[k].Priority
+			}
+			return jobs[i].CreatedAt.Before(jobs[k].CreatedAt.Time)
+		}
+
+		sort.SliceStable(jobs, func(i, k int) bool {
+			if query.Sort.Descending {
+				return less(k, i)
+			}
+			return less(i, k)
+		})
+	}
+
+	offset := (query.Page - 1) * query.PerPage
+	if query.Bookmark != "" {
+		var err error
+		if offset, err = strconv.Atoi(query.Bookmark); err != nil {
+			return nil, err
+		}
+	}
+
+	total := len(jobs)
+	page := paginateFrom(jobs, offset, query.PerPage)
+	return &database.JobPage{
+		Jobs:     page,
+		Total:    &total,
+		Bookmark: strconv.Itoa(offset + len(page)),
+	}, nil
+}
+
+// nolint: gocyclo
+func matchJobFilter(f *database.JobFilter, j *api.Job) bool {
+	inRange := func(t *api.JSONTime, since, until *time.Time) bool {
+		if since == nil && until == nil {
+			return true
+		}
+		return t != nil && (since == nil || !t.Before(*since)) && (until == nil || t.Before(*until))
+	}
+
+	return (f.Status == "" || j.Status == f.Status) &&
+		(f.BatchID == "" || j.BatchID == f.BatchID) &&
+		inRange(&j.CreatedAt, f.CreatedSince, f.CreatedUntil) &&
+		inRange(j.StartedAt, f.StartedSince, f.StartedUntil) &&
+		inRange(j.FinishedAt, f.FinishedSince, f.FinishedUntil) &&
+		(f.MinDuration == nil || j.Duration >= *f.MinDuration) &&
+		(f.MaxDuration == nil || j.Duration <= *f.MaxDuration) &&
+		(f.HasError == nil || *f.HasError == (j.Error != nil)) &&
+		(f.Search == "" || strings.Contains(strings.ToLower(j.Code), strings.ToLower(f.Search))) &&
+		matchLabels(f.Labels, j.Labels)
+}
+
+func matchLabels(selector, labels map[string]string) bool {
+	for key, value := range selector {
+		if v, ok := labels[key]; !ok || v != value {
+			return false
+		}
+	}
+	return true
+}
+
+// GetDueListByStatus returns all jobs withing the Jobs field which have no run_at in the future,
+// highest priority first
+func (t *TestDB) GetDueListByStatus(status string, now time.Time, page, perPage int) ([]*api.Job, error) {
+	jobs := make([]*api.Job, 0, len(t.Jobs))
+	for _, j := range t.Jobs {
+		if j.RunAt == nil || !j.RunAt.After(now) {
+			jobs = append(jobs, j)
+		}
+	}
+
+	sort.SliceStable(jobs, func(i, k int) bool {
+		return jobs[i].Priority > jobs[k].Priority
+	})
+
+	return jobs, nil
+}
+
+// GetPendingCallbackList returns all jobs withing the Jobs field which have a due pending callback
+func (t *TestDB) GetPendingCallbackList(now time.Time, page, perPage int) ([]*api.Job, error) {
+	jobs := make([]*api.Job, 0, len(t.Jobs))
+	for _, j := range t.Jobs {
+		if j.Callback != nil && j.Callback.Status == api.CallbackStatusPending && !j.Callback.NextAttemptAt.After(now) {
+			jobs = append(jobs, j)
+		}
+	}
+
+	return jobs, nil
 }
 
 // GetList returns all jobs withing the Jobs field
@@ -40,18 +193,67 @@ func (t *TestDB) Get(id string) (*api.Job, error) {
 	return nil, database.ErrNotFound
 }
 
-// Save adds the given job to the savedJobs field
+// Save adds the given job to the savedJobs field, unless there is an error left in SaveErrors
 func (t *TestDB) Save(job *api.Job) error {
+	if len(t.SaveErrors) > 0 {
+		err := t.SaveErrors[0]
+		t.SaveErrors = t.SaveErrors[1:]
+		if err != nil {
+			return err
+		}
+	}
+
 	t.SavedJobs = append(t.SavedJobs, job)
 	return nil
 }
 
+// SaveMany adds the given jobs to the savedJobs field, jobs with an UUID of another job within
+// the Jobs field are rejected with a conflict
+func (t *TestDB) SaveMany(jobs []*api.Job) ([]error, error) {
+	t.SaveManyCalls++
+
+	errs := make([]error, len(jobs))
+	for i, job := range jobs {
+		if existing, err := t.Get(job.UUID); err == nil && existing != job {
+			errs[i] = database.ErrConflict
+			continue
+		}
+
+		t.SavedJobs = append(t.SavedJobs, job)
+	}
+
+	return errs, nil
+}
+
 // Delete adds the given job to the deletedJobs field
 func (t *TestDB) Delete(job *api.Job) error {
 	t.DeletedJobs = append(t.DeletedJobs, job)
 	return nil
 }
 
+// DeleteMany adds the given jobs to the deletedJobs field
+func (t *TestDB) DeleteMany(jobs []*api.Job) ([]error, error) {
+	t.DeletedJobs = append(t.DeletedJobs, jobs...)
+	return make([]error, len(jobs)), nil
+}
+
+func paginate(jobs []*api.Job, page, perPage int) []*api.Job {
+	return paginateFrom(jobs, (page-1)*perPage, perPage)
+}
+
+func paginateFrom(jobs []*api.Job, start, perPage int) []*api.Job {
+	if start >= len(jobs) {
+		return []*api.Job{}
+	}
+
+	end := start + perPage
+	if end > len(jobs) {
+		end = len(jobs)
+	}
+
+	return jobs[start:end]
+}
+
 // GetUUIDs returns the UUIDs of the given jobs
 func (t *TestDB) GetUUIDs(jobs []*api.Job) (ids []string) {
 	for _, j := range jobs {
@@ -1,21 +1,46 @@
 package testing
 
-import "github.com/streadway/amqp"
+import (
+	"fmt"
+	"sync"
+
+	"github.com/streadway/amqp"
+
+	"github.com/scalify/puppet-master-gateway/pkg/api"
+)
 
 // TestQueue for tests which buffers the messages
 type TestQueue struct {
-	QueuesDeclared []string
-	Messages       [][]byte
+	ExchangesDeclared []string
+	QueuesDeclared    []string
+	Messages          [][]byte
+	Publishings       []amqp.Publishing
+	Events            [][]byte
+
+	consumersMu sync.Mutex
+	consumers   []string
+
+	eventsMu       sync.Mutex
+	eventQueues    map[string]bool
+	eventConsumers []chan amqp.Delivery
 }
 
 // NewTestQueue returns a new TestQueue instance
 func NewTestQueue() *TestQueue {
 	return &TestQueue{
-		QueuesDeclared: make([]string, 0),
-		Messages:       make([][]byte, 0),
+		ExchangesDeclared: make([]string, 0),
+		QueuesDeclared:    make([]string, 0),
+		Messages:          make([][]byte, 0),
+		Publishings:       make([]amqp.Publishing, 0),
 	}
 }
 
+// ExchangeDeclare adds the given exchange name to the ExchangesDeclared field.
+func (t *TestQueue) ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error {
+	t.ExchangesDeclared = append(t.ExchangesDeclared, name)
+	return nil
+}
+
 // QueueDeclare doesn't really do something.
 func (t *TestQueue) QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error) {
 	return amqp.Queue{
@@ -23,8 +48,27 @@ func (t *TestQueue) QueueDeclare(name string, durable, autoDelete, exclusive, no
 	}, nil
 }
 
-// Consume just pushes all messages from the Messages field into the channel.
+// Consume just pushes all messages from the Messages field into the channel. Like the broker it
+// rejects a consumer tag that is in use already.
 func (t *TestQueue) Consume(queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args amqp.Table) (<-chan amqp.Delivery, error) {
+	t.consumersMu.Lock()
+	for _, tag := range t.consumers {
+		if consumer != "" && tag == consumer {
+			t.consumersMu.Unlock()
+			return nil, fmt.Errorf("NOT_ALLOWED - attempt to reuse consumer tag '%s'", consumer)
+		}
+	}
+	t.consumers = append(t.consumers, consumer)
+	t.consumersMu.Unlock()
+
+	t.eventsMu.Lock()
+	defer t.eventsMu.Unlock()
+	if t.eventQueues[queue] {
+		c := make(chan amqp.Delivery, 64)
+		t.eventConsumers = append(t.eventConsumers, c)
+		return c, nil
+	}
+
 	c := make(chan amqp.Delivery, len(t.Messages))
 
 	for _, msg := range t.Messages {
@@ -37,9 +81,49 @@ func (t *TestQueue) Consume(queue, consumer string, autoAck, exclusive, noLocal,
 	return c, nil
 }
 
-// Publish adds the given message to the Messages field.
+// Consumers returns the tags of all consumers
+func (t *TestQueue) Consumers() []string {
+	t.consumersMu.Lock()
+	defer t.consumersMu.Unlock()
+
+	return append([]string(nil), t.consumers...)
+}
+
+// QueueBind remembers the queues bound to the job events exchange, their consumers receive all
+// published job events.
+func (t *TestQueue) QueueBind(name, key, exchange string, noWait bool, args amqp.Table) error {
+	if exchange != api.ExchangeNameJobEvents {
+		return nil
+	}
+
+	t.eventsMu.Lock()
+	defer t.eventsMu.Unlock()
+
+	if t.eventQueues == nil {
+		t.eventQueues = make(map[string]bool)
+	}
+	t.eventQueues[name] = true
+
+	return nil
+}
+
+// Publish adds the given message to the Messages and Publishings fields. Job events are added to
+// the Events field instead, as they are no messages to executors, and sent to the consumers of
+// the queues bound to the job events exchange.
 func (t *TestQueue) Publish(exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error {
+	if exchange == api.ExchangeNameJobEvents {
+		t.eventsMu.Lock()
+		defer t.eventsMu.Unlock()
+
+		t.Events = append(t.Events, msg.Body)
+		for _, c := range t.eventConsumers {
+			c <- amqp.Delivery{Body: msg.Body, Acknowledger: &NoopAcknowledger{}}
+		}
+		return nil
+	}
+
 	t.Messages = append(t.Messages, msg.Body)
+	t.Publishings = append(t.Publishings, msg)
 
 	return nil
 }
@@ -0,0 +1,62 @@
+package testing
+
+import (
+	"time"
+
+	"github.com/scalify/puppet-master-gateway/pkg/api"
+	"github.com/scalify/puppet-master-gateway/pkg/database"
+)
+
+// TestScheduleDB is a schedule db implementation used for testing
+type TestScheduleDB struct {
+	SavedSchedules, DeletedSchedules, Schedules []*api.Schedule
+}
+
+// NewTestScheduleDB returns a new TestScheduleDB instance
+func NewTestScheduleDB() *TestScheduleDB {
+	return &TestScheduleDB{
+		Schedules:        make([]*api.Schedule, 0),
+		SavedSchedules:   make([]*api.Schedule, 0),
+		DeletedSchedules: make([]*api.Schedule, 0),
+	}
+}
+
+// GetList returns all schedules withing the Schedules field
+func (t *TestScheduleDB) GetList(page, perPage int) ([]*api.Schedule, error) {
+	return t.Schedules, nil
+}
+
+// GetDueList returns all schedules withing the Schedules field which are not paused and due
+func (t *TestScheduleDB) GetDueList(now time.Time, page, perPage int) ([]*api.Schedule, error) {
+	schedules := make([]*api.Schedule, 0, len(t.Schedules))
+	for _, s := range t.Schedules {
+		if !s.Paused && s.NextRunAt != nil && !s.NextRunAt.After(now) {
+			schedules = append(schedules, s)
+		}
+	}
+
+	return schedules, nil
+}
+
+// Get returns the first schedule from the Schedules field with an equal UUID
+func (t *TestScheduleDB) Get(id string) (*api.Schedule, error) {
+	for _, s := range t.Schedules {
+		if s.UUID == id {
+			return s, nil
+		}
+	}
+
+	return nil, database.ErrNotFound
+}
+
+// Save adds the given schedule to the SavedSchedules field
+func (t *TestScheduleDB) Save(schedule *api.Schedule) error {
+	t.SavedSchedules = append(t.SavedSchedules, schedule)
+	return nil
+}
+
+// Delete adds the given schedule to the DeletedSchedules field
+func (t *TestScheduleDB) Delete(schedule *api.Schedule) error {
+	t.DeletedSchedules = append(t.DeletedSchedules, schedule)
+	return nil
+}
@@ -0,0 +1,85 @@
+package testing
+
+import (
+	"encoding/json"
+
+	"github.com/scalify/puppet-master-gateway/pkg/api"
+	"github.com/scalify/puppet-master-gateway/pkg/database"
+)
+
+// TestVersionDB is a version db implementation for templates, modules or workflows used for testing
+type TestVersionDB struct {
+	Saved, Docs []api.Versioned
+}
+
+// NewTestVersionDB returns a new TestVersionDB instance
+func NewTestVersionDB() *TestVersionDB {
+	return &TestVersionDB{
+		Docs:  make([]api.Versioned, 0),
+		Saved: make([]api.Versioned, 0),
+	}
+}
+
+// copyDoc copies the given document into doc, like it would be decoded from the database
+func copyDoc(from, doc api.Versioned) error {
+	data, err := json.Marshal(from)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, doc)
+}
+
+// GetList returns copies of all documents within the Docs field
+func (t *TestVersionDB) GetList(page, perPage int, newDoc func() api.Versioned) ([]api.Versioned, error) {
+	list := make([]api.Versioned, len(t.Docs))
+	for i, d := range t.Docs {
+		list[i] = newDoc()
+		if err := copyDoc(d, list[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return list, nil
+}
+
+// GetLatest reads the document from the Docs field with the given name and the highest version into doc
+func (t *TestVersionDB) GetLatest(name string, doc api.Versioned) error {
+	var latest api.Versioned
+	for _, d := range t.Docs {
+		if d.Meta().Name == name && (latest == nil || d.Meta().Version > latest.Meta().Version) {
+			latest = d
+		}
+	}
+
+	if latest == nil {
+		return database.ErrNotFound
+	}
+
+	return copyDoc(latest, doc)
+}
+
+// GetVersion reads the document from the Docs field with the given name and version into doc
+func (t *TestVersionDB) GetVersion(name string, version int, doc api.Versioned) error {
+	for _, d := range t.Docs {
+		if d.Meta().Name == name && d.Meta().Version == version {
+			return copyDoc(d, doc)
+		}
+	}
+
+	return database.ErrNotFound
+}
+
+// Save adds the given document to the Saved field, an existing version is rejected with a conflict
+func (t *TestVersionDB) Save(doc api.Versioned) error {
+	meta := doc.Meta()
+	for _, d := range t.Docs {
+		if d.Meta().Name == meta.Name && d.Meta().Version == meta.Version {
+			return database.ErrConflict
+		}
+	}
+
+	meta.UUID = api.VersionedID(meta.Name, meta.Version)
+	t.Saved = append(t.Saved, doc)
+	return nil
+}
@@ -0,0 +1,48 @@
+package testing
+
+import (
+	"github.com/scalify/puppet-master-gateway/pkg/api"
+	"github.com/scalify/puppet-master-gateway/pkg/database"
+)
+
+// TestWorkflowRunDB is a workflow run db implementation used for testing
+type TestWorkflowRunDB struct {
+	SavedRuns, Runs []*api.WorkflowRun
+}
+
+// NewTestWorkflowRunDB returns a new TestWorkflowRunDB instance
+func NewTestWorkflowRunDB() *TestWorkflowRunDB {
+	return &TestWorkflowRunDB{
+		Runs:      make([]*api.WorkflowRun, 0),
+		SavedRuns: make([]*api.WorkflowRun, 0),
+	}
+}
+
+// GetListByStatus returns all workflow runs withing the Runs field with the given status
+func (t *TestWorkflowRunDB) GetListByStatus(status string, page, perPage int) ([]*api.WorkflowRun, error) {
+	runs := make([]*api.WorkflowRun, 0, len(t.Runs))
+	for _, r := range t.Runs {
+		if r.Status == status {
+			runs = append(runs, r)
+		}
+	}
+
+	return runs, nil
+}
+
+// Get returns the first workflow run from the Runs field with an equal UUID
+func (t *TestWorkflowRunDB) Get(id string) (*api.WorkflowRun, error) {
+	for _, r := range t.Runs {
+		if r.UUID == id {
+			return r, nil
+		}
+	}
+
+	return nil, database.ErrNotFound
+}
+
+// Save adds the given workflow run to the SavedRuns field
+func (t *TestWorkflowRunDB) Save(run *api.WorkflowRun) error {
+	t.SavedRuns = append(t.SavedRuns, run)
+	return nil
+}